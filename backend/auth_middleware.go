@@ -1,34 +0,0 @@
-package main
-
-import (
-	"net/http"
-	"strings"
-
-	"github.com/gin-gonic/gin"
-)
-
-// AuthMiddleware checks for a valid user token in the Authorization header
-func AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		token := c.GetHeader("Authorization")
-		if strings.HasPrefix(token, "Bearer ") {
-			token = strings.TrimPrefix(token, "Bearer ")
-		}
-		if token == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid token"})
-			c.Abort()
-			return
-		}
-		dbMutex.RLock()
-		user, exists := usersByToken[token]
-		dbMutex.RUnlock()
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
-		}
-		// Attach user info to context for downstream handlers
-		c.Set("user", user)
-		c.Next()
-	}
-}
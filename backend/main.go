@@ -1,67 +1,195 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
-	"net/http"
-	"sync"
+	"os"
+	"strings"
+	"time"
 
-	"github.com/gin-gonic/gin"
-)
+	"fullstack-shopping-cart/media"
+	"fullstack-shopping-cart/server"
+	"fullstack-shopping-cart/sqlstore"
 
-// In-memory database using maps
-var (
-	users     = make(map[uint]*User)
-	items     = make(map[uint]*Item)
-	carts     = make(map[uint]*Cart)
-	cartItems = make(map[uint]*CartItem)
-	orders    = make(map[uint]*Order)
-	orderItems = make(map[uint]*OrderItem)
-	usersByUsername = make(map[string]*User)
-	usersByToken = make(map[string]*User)
-	nextUserID uint = 1
-	nextItemID uint = 1
-	nextCartID uint = 1
-	nextCartItemID uint = 1
-	nextOrderID uint = 1
-	nextOrderItemID uint = 1
-	dbMutex sync.RWMutex
+	"github.com/joho/godotenv"
 )
 
 func main() {
-	log.Println("Starting shopping cart backend with in-memory database...")
+	// .env is optional; real environment variables always win.
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Failed to load .env: %v", err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	router := gin.Default()
+	cfg, err := server.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := openStore(cfg.Currency)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sweepInterval, err := server.EnvDuration("SESSION_SWEEP_INTERVAL")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if sweepInterval == 0 {
+		sweepInterval = 10 * time.Minute
+	}
+	server.StartSweeper(context.Background(), store, sweepInterval)
 
-	// Health check
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
-	})
+	// The first admin has to come from somewhere: create it from the
+	// environment if it does not exist yet.
+	if username := os.Getenv("ADMIN_USERNAME"); username != "" {
+		if err := server.EnsureAdmin(context.Background(), store, cfg.PasswordHasher, username, os.Getenv("ADMIN_PASSWORD")); err != nil {
+			log.Fatalf("Failed to create admin user: %v", err)
+		}
+	}
 
-	// User endpoints
-	router.POST("/users", createNewUser)
-	router.GET("/users", listAllUsers)
-	router.POST("/users/login", handleUserLogin)
+	mediaStorage, mediaDir, err := openMedia()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// Item endpoints
-	router.POST("/items", createNewItem)
-	router.GET("/items", listAllItems)
+	cfg.Store = store
+	cfg.Media = mediaStorage
+	cfg.RequestLogging = true
+	router := server.NewRouter(cfg)
+	if mediaDir != "" {
+		router.Static("/media", mediaDir)
+	}
 
-	// Cart endpoints (protected)
-	cartGroup := router.Group("/carts")
-	cartGroup.Use(AuthMiddleware())
-	{
-		cartGroup.POST("", addItemToCart)
-		cartGroup.GET("", fetchCartItems)
+	addr := ":" + getEnv("PORT", "8080")
+	log.Printf("Server starting on %s", addr)
+	if err := router.Run(addr); err != nil {
+		log.Fatal(err)
 	}
+}
 
-	// Order endpoints (protected)
-	orderGroup := router.Group("/orders")
-	orderGroup.Use(AuthMiddleware())
-	{
-		orderGroup.POST("", createOrder)
-		orderGroup.GET("", orderHistoryList)
+// openStore opens the backend selected by STORAGE. SQL databases are brought
+// up to the latest schema unless MIGRATE_ON_START=false, in which case the
+// schema is left to "migrate up". Existing prices are taken to be in
+// currency.
+func openStore(currency string) (server.Store, error) {
+	sqlStore, err := openSQLStore()
+	if err != nil {
+		return nil, err
+	}
+	if sqlStore == nil {
+		log.Println("Starting shopping cart backend with in-memory database...")
+		return server.NewMemoryStore(), nil
 	}
 
-	log.Println("Server starting on :8080")
-	router.Run(":8080")
+	if getEnv("MIGRATE_ON_START", "true") != "false" {
+		migrator, err := sqlStore.Migrator()
+		if err != nil {
+			return nil, err
+		}
+		migrator.Currency = currency
+		applied, err := migrator.Up(context.Background())
+		for _, m := range applied {
+			log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sqlStore, nil
+}
+
+// openSQLStore picks the storage backend from STORAGE:
+//
+//	memory               in-process maps, lost on restart
+//	postgres             PostgreSQL configured by the DB_* variables
+//	postgres://...       PostgreSQL at the given URL
+//	sqlite://path        a single SQLite file at path
+//
+// When STORAGE is unset, PostgreSQL is used if DB_HOST is set and the
+// in-memory store otherwise. It returns a nil store for memory.
+func openSQLStore() (*sqlstore.Store, error) {
+	storage := os.Getenv("STORAGE")
+	if storage == "" && os.Getenv("DB_HOST") != "" {
+		storage = "postgres"
+	}
+
+	switch {
+	case storage == "" || storage == "memory":
+		return nil, nil
+
+	case storage == "postgres":
+		cfg := sqlstore.PostgresConfig{
+			Host:     getEnv("DB_HOST", "localhost"),
+			Port:     getEnv("DB_PORT", "5432"),
+			User:     getEnv("DB_USER", "postgres"),
+			Password: os.Getenv("DB_PASSWORD"),
+			Name:     getEnv("DB_NAME", "shopping_cart"),
+			SSLMode:  os.Getenv("DB_SSLMODE"),
+		}
+		log.Printf("Using PostgreSQL at %s:%s/%s", cfg.Host, cfg.Port, cfg.Name)
+		return sqlstore.OpenPostgres(cfg.DSN())
+
+	case strings.HasPrefix(storage, "postgres://"), strings.HasPrefix(storage, "postgresql://"):
+		log.Println("Using PostgreSQL")
+		return sqlstore.OpenPostgres(storage)
+
+	case strings.HasPrefix(storage, "sqlite://"):
+		path := strings.TrimPrefix(storage, "sqlite://")
+		if path == "" {
+			return nil, fmt.Errorf("STORAGE=%s: missing database file path", storage)
+		}
+		log.Printf("Using SQLite at %s", path)
+		return sqlstore.OpenSQLite(path)
+	}
+	return nil, fmt.Errorf("unknown STORAGE %q (want memory, postgres, postgres://... or sqlite://path)", storage)
+}
+
+// openMedia picks where uploaded images are kept from MEDIA_STORAGE:
+//
+//	local   the MEDIA_DIR directory, served at /media (the default)
+//	s3      a bucket of S3 or an S3-compatible service such as MinIO,
+//	        configured by the S3_* variables
+//	none    image uploads are disabled
+//
+// It returns the directory this process should serve at /media, if any.
+// MEDIA_BASE_URL changes the address local files are linked under, e.g.
+// when the frontend proxies the API or a web server serves MEDIA_DIR.
+func openMedia() (media.Storage, string, error) {
+	switch storage := getEnv("MEDIA_STORAGE", "local"); storage {
+	case "local":
+		dir := getEnv("MEDIA_DIR", "uploads")
+		local, err := media.NewLocal(dir, getEnv("MEDIA_BASE_URL", "/media"))
+		if err != nil {
+			return nil, "", err
+		}
+		log.Printf("Storing images in %s", dir)
+		return local, local.Dir(), nil
+
+	case "s3":
+		s3, err := media.NewS3(server.S3ConfigFromEnv())
+		if err != nil {
+			return nil, "", err
+		}
+		log.Printf("Storing images in S3 bucket %s", os.Getenv("S3_BUCKET"))
+		return s3, "", nil
+
+	case "none":
+		return nil, "", nil
+	default:
+		return nil, "", fmt.Errorf("unknown MEDIA_STORAGE %q (want local, s3 or none)", storage)
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
 }
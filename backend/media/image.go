@@ -0,0 +1,110 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+
+	// Register the decoders of the other accepted formats.
+	_ "golang.org/x/image/webp"
+	_ "image/gif"
+)
+
+// Errors returned by DecodeImage.
+var (
+	ErrUnsupportedImage = errors.New("not a JPEG, PNG, GIF or WebP image")
+	ErrImageTooLarge    = errors.New("image has too many pixels")
+)
+
+// imageExtensions are the file extensions of the image formats accepted
+// for upload, by content type.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// DecodeImage works out the content type of data from its contents,
+// whatever the uploader claimed, and decodes it. Only JPEG, PNG, GIF and
+// WebP images are accepted, and only if they have at most maxPixels pixels,
+// so that a small file cannot expand into a huge bitmap. Animated images
+// decode to their first frame.
+func DecodeImage(data []byte, maxPixels int) (image.Image, string, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := imageExtensions[contentType]; !ok {
+		return nil, "", ErrUnsupportedImage
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxPixels/cfg.Height {
+		return nil, "", ErrImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	return img, contentType, nil
+}
+
+// Extension returns the file extension, such as ".jpg", of an image content
+// type returned by DecodeImage.
+func Extension(contentType string) string {
+	return imageExtensions[contentType]
+}
+
+// ThumbnailType returns the content type thumbnails of an image of
+// contentType are encoded in: JPEG for photos uploaded as JPEG and PNG for
+// everything else, which keeps transparency.
+func ThumbnailType(contentType string) string {
+	if contentType == "image/jpeg" {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// Fit scales img down so that its longer side is at most side pixels,
+// keeping its aspect ratio. Images that already fit are returned as they
+// are.
+func Fit(img image.Image, side int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= side && h <= side {
+		return img
+	}
+	if w >= h {
+		w, h = side, max(1, h*side/w)
+	} else {
+		w, h = max(1, w*side/h), side
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// Encode encodes img as contentType, which must be what ThumbnailType
+// returns.
+func Encode(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	case "image/png":
+		err = png.Encode(&buf, img)
+	default:
+		err = fmt.Errorf("cannot encode %s", contentType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("media: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,192 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Config locates a bucket of Amazon S3 or of a service speaking its API,
+// such as MinIO, Cloudflare R2 or DigitalOcean Spaces.
+type S3Config struct {
+	// Endpoint is the service's base URL, e.g. "http://localhost:9000".
+	// Defaults to Amazon S3 in Region.
+	Endpoint string
+	// Region is the bucket's region. Defaults to "us-east-1", which is also
+	// what most S3-compatible services accept.
+	Region string
+	Bucket string
+
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// PublicURL is where clients fetch objects from, e.g. a CDN in front of
+	// the bucket. Defaults to the bucket's own URL, which only works if the
+	// bucket allows anonymous reads.
+	PublicURL string
+
+	// Client sends the requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// S3 is a Storage in an S3 bucket. Objects are addressed path-style, as
+// Endpoint/Bucket/key, which every S3-compatible service understands.
+// Requests are signed with AWS Signature Version 4.
+type S3 struct {
+	cfg      S3Config
+	endpoint *url.URL
+}
+
+// NewS3 checks cfg and returns a Storage in its bucket.
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("media: S3 bucket is not set")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("media: S3 credentials are not set")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("media: invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.PublicURL == "" {
+		cfg.PublicURL = endpoint.String() + "/" + uriEncode(cfg.Bucket, false)
+	}
+	cfg.PublicURL = strings.TrimSuffix(cfg.PublicURL, "/")
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &S3{cfg: cfg, endpoint: endpoint}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key, contentType string, data []byte) error {
+	return s.do(ctx, http.MethodPut, key, contentType, data)
+}
+
+// Delete succeeds for missing objects, as S3 does.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	return s.do(ctx, http.MethodDelete, key, "", nil)
+}
+
+func (s *S3) URL(key string) string {
+	return s.cfg.PublicURL + "/" + uriEncode(key, true)
+}
+
+// do sends a signed request for the object under key and fails unless the
+// service answers 2xx.
+func (s *S3) do(ctx context.Context, method, key, contentType string, body []byte) error {
+	u := *s.endpoint
+	u.Path += "/" + s.cfg.Bucket + "/" + key
+	u.RawPath = s.endpoint.EscapedPath() + "/" + uriEncode(s.cfg.Bucket, false) + "/" + uriEncode(key, true)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("media: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, body, time.Now().UTC())
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("media: %s %s: %w", method, key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("media: %s %s: %s: %s", method, key, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// sign adds the headers of AWS Signature Version 4 to req, whose body is
+// body. See
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html.
+func (s *S3) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256Hex(body)
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// The signed headers, in the sorted order the signature needs.
+	headers := [][2]string{
+		{"content-type", req.Header.Get("Content-Type")},
+		{"host", req.URL.Host},
+		{"x-amz-content-sha256", payloadHash},
+		{"x-amz-date", amzDate},
+	}
+	if headers[0][1] == "" {
+		headers = headers[1:]
+	}
+	var canonicalHeaders strings.Builder
+	names := make([]string, len(headers))
+	for i, h := range headers {
+		canonicalHeaders.WriteString(h[0] + ":" + strings.TrimSpace(h[1]) + "\n")
+		names[i] = h[0]
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), date)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.cfg.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode percent-encodes s the way Signature Version 4 expects: every
+// byte but unreserved characters, and slashes if keepSlash is false.
+func uriEncode(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
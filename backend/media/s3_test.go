@@ -0,0 +1,265 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+// testSignature signs a canonical request the way the S3 documentation
+// spells it out, independently of S3.sign.
+func testSignature(secret, amzDate, region, canonicalRequest string) string {
+	mac := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	date := amzDate[:8]
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + date + "/" + region + "/s3/aws4_request\n" + hex.EncodeToString(hash[:])
+	key := mac(mac(mac(mac([]byte("AWS4"+secret), date), region), "s3"), "aws4_request")
+	return hex.EncodeToString(mac(key, stringToSign))
+}
+
+func TestS3SignCanonicalRequest(t *testing.T) {
+	s, err := NewS3(S3Config{
+		Endpoint:        "https://storage.example.com",
+		Region:          "eu-west-1",
+		Bucket:          "shop",
+		AccessKeyID:     testAccessKey,
+		SecretAccessKey: testSecretKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte("image data")
+	sum := sha256.Sum256(body)
+	bodyHash := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name, method, key, contentType string
+		body                           []byte
+		canonical                      string
+		signedHeaders                  string
+	}{
+		{
+			name: "put", method: http.MethodPut, key: "items/7/a b+c.png", contentType: "image/png", body: body,
+			canonical: "PUT\n" +
+				"/shop/items/7/a%20b%2Bc.png\n" +
+				"\n" +
+				"content-type:image/png\n" +
+				"host:storage.example.com\n" +
+				"x-amz-content-sha256:" + bodyHash + "\n" +
+				"x-amz-date:20240102T030405Z\n" +
+				"\n" +
+				"content-type;host;x-amz-content-sha256;x-amz-date\n" +
+				bodyHash,
+			signedHeaders: "content-type;host;x-amz-content-sha256;x-amz-date",
+		},
+		{
+			name: "delete", method: http.MethodDelete, key: "items/7/a.png",
+			canonical: "DELETE\n" +
+				"/shop/items/7/a.png\n" +
+				"\n" +
+				"host:storage.example.com\n" +
+				"x-amz-content-sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n" +
+				"x-amz-date:20240102T030405Z\n" +
+				"\n" +
+				"host;x-amz-content-sha256;x-amz-date\n" +
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			signedHeaders: "host;x-amz-content-sha256;x-amz-date",
+		},
+	}
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Capture the request do builds and sign it again at a fixed
+			// time.
+			var signed *http.Request
+			s.cfg.Client = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				signed = req
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil
+			})}
+			if err := s.do(context.Background(), tt.method, tt.key, tt.contentType, tt.body); err != nil {
+				t.Fatal(err)
+			}
+			s.sign(signed, tt.body, now)
+
+			want := "AWS4-HMAC-SHA256 Credential=" + testAccessKey + "/20240102/eu-west-1/s3/aws4_request, SignedHeaders=" +
+				tt.signedHeaders + ", Signature=" + testSignature(testSecretKey, "20240102T030405Z", "eu-west-1", tt.canonical)
+			if got := signed.Header.Get("Authorization"); got != want {
+				t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+			}
+			if got := signed.Header.Get("X-Amz-Date"); got != "20240102T030405Z" {
+				t.Errorf("X-Amz-Date = %q", got)
+			}
+		})
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// fakeS3 is a bucket that checks the signature of every request the way S3
+// does and keeps the objects put into it.
+type fakeS3 struct {
+	secret  string
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	methods []string
+}
+
+type fakeObject struct {
+	contentType string
+	data        []byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	auth := r.Header.Get("Authorization")
+	_, signedHeaders, _ := strings.Cut(auth, "SignedHeaders=")
+	signedHeaders, gotSignature, _ := strings.Cut(signedHeaders, ", Signature=")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential="+testAccessKey+"/") {
+		http.Error(w, "bad credential", http.StatusForbidden)
+		return
+	}
+	sum := sha256.Sum256(body)
+	if hash := hex.EncodeToString(sum[:]); r.Header.Get("X-Amz-Content-Sha256") != hash {
+		http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+		return
+	}
+
+	var headers strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + value + "\n")
+	}
+	canonical := strings.Join([]string{
+		r.Method, r.URL.EscapedPath(), r.URL.RawQuery, headers.String(), signedHeaders,
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	amzDate := r.Header.Get("X-Amz-Date")
+	if gotSignature != testSignature(f.secret, amzDate, "us-east-1", canonical) {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.methods = append(f.methods, r.Method+" "+r.URL.EscapedPath())
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[r.URL.Path] = fakeObject{r.Header.Get("Content-Type"), body}
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
+	}
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{secret: testSecretKey, objects: map[string]fakeObject{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func TestS3PutDelete(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	s, err := NewS3(S3Config{
+		Endpoint:        srv.URL,
+		Bucket:          "shop",
+		AccessKeyID:     testAccessKey,
+		SecretAccessKey: testSecretKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	data := []byte("\x89PNG fake")
+	if err := s.Put(ctx, "items/7/a b.png", "image/png", data); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	obj, ok := fake.objects["/shop/items/7/a b.png"]
+	if !ok || obj.contentType != "image/png" || !bytes.Equal(obj.data, data) {
+		t.Fatalf("bucket has %+v; want the PNG under /shop/items/7/a b.png", fake.objects)
+	}
+	if err := s.Delete(ctx, "items/7/a b.png"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if len(fake.objects) != 0 {
+		t.Errorf("bucket still has %+v after Delete", fake.objects)
+	}
+	want := []string{"PUT /shop/items/7/a%20b.png", "DELETE /shop/items/7/a%20b.png"}
+	if strings.Join(fake.methods, ", ") != strings.Join(want, ", ") {
+		t.Errorf("requests = %q; want %q", fake.methods, want)
+	}
+
+	if got, want := s.URL("items/7/a b.png"), srv.URL+"/shop/items/7/a%20b.png"; got != want {
+		t.Errorf("URL = %q; want %q", got, want)
+	}
+}
+
+func TestS3RejectedRequest(t *testing.T) {
+	_, srv := newFakeS3(t)
+	s, err := NewS3(S3Config{
+		Endpoint:        srv.URL,
+		Bucket:          "shop",
+		AccessKeyID:     testAccessKey,
+		SecretAccessKey: "wrong secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Put(context.Background(), "items/7/a.png", "image/png", []byte("x"))
+	if err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("Put with a wrong secret = %v; want a 403 error with the service's message", err)
+	}
+}
+
+func TestNewS3(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           S3Config
+		wantErr       bool
+		wantPublicURL string
+	}{
+		{"no bucket", S3Config{AccessKeyID: "a", SecretAccessKey: "s"}, true, ""},
+		{"no credentials", S3Config{Bucket: "shop"}, true, ""},
+		{"bad endpoint", S3Config{Bucket: "shop", AccessKeyID: "a", SecretAccessKey: "s", Endpoint: "localhost:9000"}, true, ""},
+		{"amazon", S3Config{Bucket: "shop", AccessKeyID: "a", SecretAccessKey: "s", Region: "eu-west-1"}, false,
+			"https://s3.eu-west-1.amazonaws.com/shop"},
+		{"public url", S3Config{Bucket: "shop", AccessKeyID: "a", SecretAccessKey: "s", PublicURL: "https://cdn.example.com/"}, false,
+			"https://cdn.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewS3(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewS3 error = %v; want error %v", err, tt.wantErr)
+			}
+			if err == nil && s.cfg.PublicURL != tt.wantPublicURL {
+				t.Errorf("PublicURL = %q; want %q", s.cfg.PublicURL, tt.wantPublicURL)
+			}
+		})
+	}
+}
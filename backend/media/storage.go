@@ -0,0 +1,105 @@
+// Package media stores uploaded files, such as product images, and prepares
+// images for the web: it checks what an upload really is and scales it down
+// into thumbnails. Files live in a Storage, either a local directory or an
+// S3-compatible bucket.
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Storage keeps files under slash-separated keys such as
+// "items/12/3f9a.jpg" and says where clients can fetch them.
+type Storage interface {
+	// Put stores data under key with the given content type, replacing
+	// any file already there.
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	// Delete removes the file under key. Deleting a missing file is not an
+	// error.
+	Delete(ctx context.Context, key string) error
+	// URL returns the address clients fetch the file under key from.
+	URL(key string) string
+}
+
+// Local is a Storage in a directory of the local filesystem. It does not
+// serve the files itself; something must serve Dir at BaseURL.
+type Local struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocal returns a Storage keeping files in dir, which is created if
+// needed, and telling clients to fetch them from under baseURL, such as
+// "/media" or "https://cdn.example.com".
+func NewLocal(dir, baseURL string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("media: %w", err)
+	}
+	return &Local{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// Dir returns the directory the files are kept in.
+func (l *Local) Dir() string {
+	return l.dir
+}
+
+// Put writes the file to a temporary name first and renames it into place,
+// so that it is never served half-written.
+func (l *Local) Put(ctx context.Context, key, contentType string, data []byte) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("media: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("media: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("media: %w", err)
+	}
+	return nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("media: %w", err)
+	}
+	return nil
+}
+
+func (l *Local) URL(key string) string {
+	return l.baseURL + "/" + key
+}
+
+// path returns where the file under key is kept, refusing keys that would
+// leave the directory.
+func (l *Local) path(key string) (string, error) {
+	rel := filepath.FromSlash(key)
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("media: invalid key %q", key)
+	}
+	return filepath.Join(l.dir, rel), nil
+}
@@ -0,0 +1,65 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "uploads")
+	l, err := NewLocal(dir, "https://cdn.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	path := filepath.Join(dir, "items", "7", "a.png")
+
+	for _, data := range []string{"first", "second"} {
+		if err := l.Put(ctx, "items/7/a.png", "image/png", []byte(data)); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil || string(got) != data {
+			t.Fatalf("file holds %q, %v; want %q", got, err, data)
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("file mode = %v, %v; want 0644", info.Mode(), err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, "items", "7", ".upload-*")); len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+	if got, want := l.URL("items/7/a.png"), "https://cdn.example.com/items/7/a.png"; got != want {
+		t.Errorf("URL = %q; want %q", got, want)
+	}
+
+	if err := l.Delete(ctx, "items/7/a.png"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file still there after Delete: %v", err)
+	}
+	if err := l.Delete(ctx, "items/7/a.png"); err != nil {
+		t.Errorf("Delete of a missing file = %v; want nil", err)
+	}
+}
+
+func TestLocalRejectsKeysOutsideDir(t *testing.T) {
+	l, err := NewLocal(t.TempDir(), "/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, key := range []string{"../escape.png", "items/../../escape.png", "/etc/passwd", ""} {
+		if err := l.Put(ctx, key, "image/png", []byte("x")); err == nil {
+			t.Errorf("Put(%q) succeeded; want an error", key)
+		}
+		if err := l.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) succeeded; want an error", key)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"fullstack-shopping-cart/server"
+	"fullstack-shopping-cart/sqlstore"
+)
+
+const migrateUsage = `usage: backend migrate <command>
+
+commands:
+  up                 apply all pending migrations
+  down [n]           roll back the last n migrations (default 1)
+  status             list migrations and when they were applied
+  create [-dir d] <name>
+                     add empty up/down files for every dialect under d
+                     (default ` + sqlstore.MigrationsDir + `)
+
+The database is selected by STORAGE / DB_* exactly as when serving, and
+existing prices are taken to be in CURRENCY.`
+
+var (
+	migrationNameRE    = regexp.MustCompile(`^[a-z0-9_]+$`)
+	migrationVersionRE = regexp.MustCompile(`^(\d+)_`)
+)
+
+// runMigrate implements the "migrate" subcommand.
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	if args[0] == "create" {
+		return createMigration(args[1:])
+	}
+
+	store, err := openSQLStore()
+	if err != nil {
+		return err
+	}
+	if store == nil {
+		return errors.New("migrate needs a SQL database; set STORAGE or DB_HOST")
+	}
+	defer store.Close()
+
+	migrator, err := store.Migrator()
+	if err != nil {
+		return err
+	}
+	if migrator.Currency, err = server.CurrencyFromEnv(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied  %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("already up to date")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("down: invalid step count %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+
+	case "status":
+		list, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range list {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = st.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", st.Version, st.Name, applied)
+		}
+		return nil
+	}
+	return errors.New(migrateUsage)
+}
+
+// createMigration writes the next numbered pair of empty migration files for
+// every dialect. It works on the source tree, so the binary must be rebuilt
+// for the new migration to be embedded.
+func createMigration(args []string) error {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	dir := fs.String("dir", sqlstore.MigrationsDir, "migrations source directory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || !migrationNameRE.MatchString(fs.Arg(0)) {
+		return errors.New("create: need exactly one name of lowercase letters, digits and underscores")
+	}
+	name := fs.Arg(0)
+
+	// Number from the files on disk rather than the embedded set so that
+	// several migrations can be created before rebuilding.
+	next := 1
+	for _, dialect := range sqlstore.Dialects {
+		files, err := filepath.Glob(filepath.Join(*dir, dialect, "*.sql"))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			m := migrationVersionRE.FindStringSubmatch(filepath.Base(f))
+			if m == nil {
+				continue
+			}
+			if v, _ := strconv.Atoi(m[1]); v >= next {
+				next = v + 1
+			}
+		}
+	}
+
+	for _, dialect := range sqlstore.Dialects {
+		for _, direction := range []string{"up", "down"} {
+			path := filepath.Join(*dir, dialect, fmt.Sprintf("%04d_%s.%s.sql", next, name, direction))
+			body := fmt.Sprintf("-- %04d_%s (%s, %s)\n", next, name, dialect, direction)
+			if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+				return err
+			}
+			fmt.Println("created", path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+// Package money represents amounts of money exactly, as an integer number of
+// a currency's minor units (cents for USD), so that sums never drift the way
+// float64 amounts do.
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in a currency. The zero value is zero in no particular
+// currency, which combines with an amount in any currency; this lets a sum
+// start from Money{}.
+type Money struct {
+	// Amount is in minor units of Currency, e.g. 1234 for USD 12.34.
+	Amount int64 `gorm:"not null"`
+	// Currency is an ISO 4217 code such as "USD".
+	Currency string `gorm:"not null"`
+}
+
+// ErrInvalid is returned for amounts that are not decimal numbers.
+var ErrInvalid = errors.New("money: invalid amount")
+
+// ErrCurrencyMismatch is returned by Sum for amounts in different
+// currencies.
+var ErrCurrencyMismatch = errors.New("money: mixing currencies")
+
+// ErrOverflow is returned for results too large to hold in minor units.
+var ErrOverflow = errors.New("money: amount out of range")
+
+// minorDigits lists the currencies whose minor unit is not a hundredth.
+var minorDigits = map[string]int{
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0,
+	"XAF": 0, "XOF": 0, "XPF": 0,
+}
+
+// Digits returns how many decimal places the currency's minor unit has: 2
+// for most currencies, 0 for e.g. JPY and 3 for e.g. KWD.
+func Digits(currency string) int {
+	if d, ok := minorDigits[currency]; ok {
+		return d
+	}
+	return 2
+}
+
+// New returns amount minor units of currency.
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Parse reads a decimal such as "12.34" or "-0.5" as an amount of currency.
+// Digits beyond the currency's minor unit are rounded half to even.
+func Parse(s, currency string) (Money, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || strings.Contains(s, "/") {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+	r.Mul(r, new(big.Rat).SetInt(pow10(Digits(currency))))
+	amount, ok := roundHalfEven(r)
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %q is out of range", ErrInvalid, s)
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// String formats m as a decimal with the currency's number of decimal
+// places, e.g. "12.30"; the currency itself is not included.
+func (m Money) String() string {
+	digits := Digits(m.Currency)
+	s := strconv.FormatInt(m.Amount, 10)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	if digits > 0 {
+		if len(s) <= digits {
+			s = strings.Repeat("0", digits-len(s)+1) + s
+		}
+		s = s[:len(s)-digits] + "." + s[len(s)-digits:]
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool { return m.Amount == 0 }
+
+// IsNegative reports whether the amount is below zero.
+func (m Money) IsNegative() bool { return m.Amount < 0 }
+
+// Add returns m + o. It panics if both have a currency and they differ.
+func (m Money) Add(o Money) Money {
+	return Money{Amount: m.Amount + o.Amount, Currency: m.common(o)}
+}
+
+// Sum returns the total of amounts. Unlike Add it returns an error rather
+// than panicking if two of them are in different currencies, for sums of
+// amounts that come from stored data, and ErrOverflow if the total does not
+// fit in an int64.
+func Sum(amounts ...Money) (Money, error) {
+	var total Money
+	for _, m := range amounts {
+		currency, err := total.commonCurrency(m)
+		if err != nil {
+			return Money{}, err
+		}
+		if m.Amount > 0 && total.Amount > math.MaxInt64-m.Amount ||
+			m.Amount < 0 && total.Amount < math.MinInt64-m.Amount {
+			return Money{}, ErrOverflow
+		}
+		total = Money{Amount: total.Amount + m.Amount, Currency: currency}
+	}
+	return total, nil
+}
+
+// Sub returns m - o. It panics if both have a currency and they differ.
+func (m Money) Sub(o Money) Money {
+	return Money{Amount: m.Amount - o.Amount, Currency: m.common(o)}
+}
+
+// Mul returns m times n, e.g. a unit price times a quantity. It returns
+// ErrOverflow if the product does not fit in an int64.
+func (m Money) Mul(n int64) (Money, error) {
+	product := m.Amount * n
+	if n != 0 && (product/n != m.Amount || n == -1 && m.Amount == math.MinInt64) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// MulRat returns m times r rounded half to even to a minor unit, e.g. a tax
+// amount from a rate. Pass rates parsed with ParseRate so that they are
+// exact. A nil r counts as zero.
+func (m Money) MulRat(r *big.Rat) Money {
+	if r == nil {
+		return Money{Currency: m.Currency}
+	}
+	x := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), r)
+	amount, _ := roundHalfEven(x)
+	return Money{Amount: amount, Currency: m.Currency}
+}
+
+// Convert returns m in another currency at rate, the number of units of
+// currency that one unit of m's currency buys, rounded half to even to a
+// minor unit of currency.
+func (m Money) Convert(currency string, rate *big.Rat) Money {
+	x := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), ConversionFactor(m.Currency, currency, rate))
+	amount, _ := roundHalfEven(x)
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ConversionFactor returns what Convert multiplies an amount in minor units
+// of from by, before rounding, to get minor units of to at rate.
+func ConversionFactor(from, to string, rate *big.Rat) *big.Rat {
+	return new(big.Rat).Mul(rate, new(big.Rat).SetFrac(pow10(Digits(to)), pow10(Digits(from))))
+}
+
+// Cmp compares m and o, returning -1, 0 or +1. It panics if both have a
+// currency and they differ.
+func (m Money) Cmp(o Money) int {
+	m.common(o)
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	}
+	return 0
+}
+
+// Allocate splits m into parts proportional to weights without losing or
+// inventing a minor unit: the parts always add up to m. Minor units left
+// over after rounding down go to the parts that lost the most to rounding,
+// earlier parts first on ties. If every weight is zero m is split evenly.
+func (m Money) Allocate(weights ...int64) []Money {
+	parts := make([]Money, len(weights))
+	if len(weights) == 0 {
+		return parts
+	}
+	var total int64
+	for _, w := range weights {
+		if w < 0 {
+			panic("money: negative allocation weight")
+		}
+		total += w
+	}
+	if total == 0 {
+		weights = make([]int64, len(weights))
+		for i := range weights {
+			weights[i] = 1
+		}
+		total = int64(len(weights))
+	}
+
+	sign := int64(1)
+	amount := m.Amount
+	if amount < 0 {
+		sign, amount = -1, -amount
+	}
+	remainders := make([]*big.Int, len(weights))
+	left := amount
+	for i, w := range weights {
+		q, r := new(big.Int).QuoRem(
+			new(big.Int).Mul(big.NewInt(amount), big.NewInt(w)), big.NewInt(total), new(big.Int))
+		parts[i] = Money{Amount: q.Int64(), Currency: m.Currency}
+		remainders[i] = r
+		left -= q.Int64()
+	}
+	for ; left > 0; left-- {
+		best := 0
+		for i := range remainders {
+			if remainders[i].Cmp(remainders[best]) > 0 {
+				best = i
+			}
+		}
+		parts[best].Amount++
+		remainders[best].SetInt64(-1)
+	}
+	for i := range parts {
+		parts[i].Amount *= sign
+	}
+	return parts
+}
+
+// common returns the currency of a sum of m and o. It panics if both have a
+// currency and they differ.
+func (m Money) common(o Money) string {
+	currency, err := m.commonCurrency(o)
+	if err != nil {
+		panic(err.Error())
+	}
+	return currency
+}
+
+// commonCurrency returns the currency of a sum of m and o.
+func (m Money) commonCurrency(o Money) (string, error) {
+	switch {
+	case m.Currency == "":
+		return o.Currency, nil
+	case o.Currency == "" || o.Currency == m.Currency:
+		return m.Currency, nil
+	}
+	return "", fmt.Errorf("%w %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+}
+
+// MarshalJSON encodes m as a decimal string such as "12.34", which clients
+// can parse without going through a binary float.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON decodes a decimal string or, for older clients, a JSON
+// number, in m's currency. Set m.Currency before decoding for currencies
+// whose minor unit is not a hundredth.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	var d Decimal
+	if err := d.UnmarshalJSON(b); err != nil {
+		return err
+	}
+	parsed, err := Parse(string(d), m.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Decimal is an amount in a request whose currency is only known later. It
+// accepts both a decimal string and a JSON number, keeping the number's
+// digits exactly as sent; convert it with Parse.
+type Decimal string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	var s string
+	if len(b) > 0 && b[0] == '"' {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+	} else {
+		var n json.Number
+		if err := json.Unmarshal(b, &n); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalid, b)
+		}
+		s = n.String()
+	}
+	if _, ok := new(big.Rat).SetString(s); !ok || strings.Contains(s, "/") {
+		return fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+	*d = Decimal(s)
+	return nil
+}
+
+// ParseRate reads a decimal such as "0.0825" exactly, for use with MulRat.
+func ParseRate(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || strings.Contains(s, "/") {
+		return nil, fmt.Errorf("money: invalid rate %q", s)
+	}
+	return r, nil
+}
+
+// roundHalfEven rounds r to the nearest integer, ties to even. It reports
+// false if the result does not fit in an int64.
+func roundHalfEven(r *big.Rat) (int64, bool) {
+	q, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	// Compare twice the remainder with the denominator to find which side
+	// of one half the fraction is on.
+	twice := new(big.Int).Abs(rem)
+	twice.Lsh(twice, 1)
+	switch c := twice.Cmp(r.Denom()); {
+	case c > 0, c == 0 && q.Bit(0) == 1:
+		if rem.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	if !q.IsInt64() {
+		return 0, false
+	}
+	return q.Int64(), true
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
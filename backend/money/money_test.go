@@ -0,0 +1,203 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestParseAndString(t *testing.T) {
+	tests := []struct {
+		in       string
+		currency string
+		amount   int64
+		str      string
+	}{
+		{"12.34", "USD", 1234, "12.34"},
+		{"12.3", "USD", 1230, "12.30"},
+		{" 7 ", "USD", 700, "7.00"},
+		{"0.05", "USD", 5, "0.05"},
+		{"-0.5", "USD", -50, "-0.50"},
+		{"-12.34", "USD", -1234, "-12.34"},
+		{"1234", "JPY", 1234, "1234"},
+		{"1.234", "KWD", 1234, "1.234"},
+		{"0.001", "KWD", 1, "0.001"},
+		// Digits beyond the minor unit round half to even.
+		{"0.125", "USD", 12, "0.12"},
+		{"0.135", "USD", 14, "0.14"},
+		{"0.1251", "USD", 13, "0.13"},
+		{"-0.125", "USD", -12, "-0.12"},
+		{"-0.135", "USD", -14, "-0.14"},
+		{"2.5", "JPY", 2, "2"},
+		{"3.5", "JPY", 4, "4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.currency+" "+tt.in, func(t *testing.T) {
+			m, err := Parse(tt.in, tt.currency)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m != New(tt.amount, tt.currency) {
+				t.Errorf("Parse = %+v; want %d %s", m, tt.amount, tt.currency)
+			}
+			if got := m.String(); got != tt.str {
+				t.Errorf("String = %q; want %q", got, tt.str)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, in := range []string{"", "abc", "1/2", "1.2.3", "1e30"} {
+		if m, err := Parse(in, "USD"); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) = %+v, %v; want ErrInvalid", in, m, err)
+		}
+	}
+}
+
+func TestMulRatRoundsHalfToEven(t *testing.T) {
+	tests := []struct {
+		amount int64
+		rate   string
+		want   int64
+	}{
+		{1000, "0.08", 80},
+		{1000, "0.0825", 82},  // 82.5
+		{1100, "0.0825", 91},  // 90.75
+		{1800, "0.0825", 148}, // 148.5
+		{-1000, "0.0825", -82},
+		{-1800, "0.0825", -148},
+		{999, "0", 0},
+	}
+	for _, tt := range tests {
+		got := New(tt.amount, "USD").MulRat(mustRate(t, tt.rate))
+		if got != New(tt.want, "USD") {
+			t.Errorf("%d × %s = %+v; want %d", tt.amount, tt.rate, got, tt.want)
+		}
+	}
+	if got := New(1000, "USD").MulRat(nil); got != New(0, "USD") {
+		t.Errorf("MulRat(nil) = %+v; want 0", got)
+	}
+}
+
+func TestMul(t *testing.T) {
+	tests := []struct {
+		amount, n int64
+		want      int64
+		err       error
+	}{
+		{1234, 3, 3702, nil},
+		{1234, 0, 0, nil},
+		{-250, 4, -1000, nil},
+		{250, -4, -1000, nil},
+		{math.MaxInt64, 1, math.MaxInt64, nil},
+		{math.MaxInt64 / 2, 3, 0, ErrOverflow},
+		{math.MaxInt64, -1, -math.MaxInt64, nil},
+		{math.MinInt64, -1, 0, ErrOverflow},
+		{math.MinInt64, 2, 0, ErrOverflow},
+		{1 << 32, 1 << 32, 0, ErrOverflow},
+	}
+	for _, tt := range tests {
+		got, err := New(tt.amount, "USD").Mul(tt.n)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%d × %d: error %v; want %v", tt.amount, tt.n, err, tt.err)
+			continue
+		}
+		if err == nil && got != New(tt.want, "USD") {
+			t.Errorf("%d × %d = %+v; want %d", tt.amount, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSum(t *testing.T) {
+	tests := []struct {
+		name    string
+		amounts []Money
+		want    Money
+		err     error
+	}{
+		{"none", nil, Money{}, nil},
+		{"same currency", []Money{New(100, "EUR"), New(250, "EUR"), New(-50, "EUR")}, New(300, "EUR"), nil},
+		{"zero value", []Money{{}, New(100, "EUR"), {}}, New(100, "EUR"), nil},
+		{"mixed currencies", []Money{New(100, "EUR"), New(100, "USD")}, Money{}, ErrCurrencyMismatch},
+		{"overflow", []Money{New(math.MaxInt64, "EUR"), New(1, "EUR")}, Money{}, ErrOverflow},
+		{"underflow", []Money{New(math.MinInt64, "EUR"), New(-1, "EUR")}, Money{}, ErrOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sum(tt.amounts...)
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Errorf("Sum = %+v, %v; want %+v, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		from Money
+		to   string
+		rate string
+		want int64
+	}{
+		{New(1000, "USD"), "EUR", "0.9", 900},
+		{New(1000, "USD"), "JPY", "150", 1500},
+		{New(1000, "JPY"), "USD", "0.0067", 670},
+		{New(1000, "USD"), "KWD", "0.307", 3070},
+		{New(1, "USD"), "EUR", "0.5", 0},   // 0.5 rounds to even
+		{New(3, "USD"), "EUR", "0.5", 2},   // 1.5 rounds to even
+		{New(-3, "USD"), "EUR", "0.5", -2}, // as do negative amounts
+		{New(1999, "USD"), "EUR", "0.92", 1839},
+	}
+	for _, tt := range tests {
+		got := tt.from.Convert(tt.to, mustRate(t, tt.rate))
+		if got != New(tt.want, tt.to) {
+			t.Errorf("%s %s at %s = %+v; want %d %s", tt.from, tt.from.Currency, tt.rate, got, tt.want, tt.to)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int64
+		weights []int64
+		want    []int64
+	}{
+		{"even", 900, []int64{1, 1, 1}, []int64{300, 300, 300}},
+		{"remainder to earlier parts on ties", 100, []int64{1, 1, 1}, []int64{34, 33, 33}},
+		{"remainder to the largest fraction", 10, []int64{1, 2}, []int64{3, 7}},
+		{"remainders by lost fraction", 101, []int64{1, 2, 3}, []int64{17, 34, 50}},
+		{"two units left over", 5, []int64{1, 1, 1}, []int64{2, 2, 1}},
+		{"proportional", 500, []int64{1000, 3000}, []int64{125, 375}},
+		{"zero weight", 100, []int64{0, 5}, []int64{0, 100}},
+		{"all weights zero", 10, []int64{0, 0, 0}, []int64{4, 3, 3}},
+		{"negative", -100, []int64{1, 1, 1}, []int64{-34, -33, -33}},
+		{"zero", 0, []int64{1, 2}, []int64{0, 0}},
+		{"no weights", 100, nil, []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := New(tt.amount, "EUR").Allocate(tt.weights...)
+			if len(parts) != len(tt.want) {
+				t.Fatalf("got %d parts; want %d", len(parts), len(tt.want))
+			}
+			for i, p := range parts {
+				if p != New(tt.want[i], "EUR") {
+					t.Errorf("parts = %v; want %v", parts, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func mustRate(t *testing.T, s string) *big.Rat {
+	t.Helper()
+	r, err := ParseRate(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
@@ -0,0 +1,288 @@
+// Package search is an in-memory full-text index. It ranks documents with
+// BM25, stems English words, matches the last word of a query as a prefix
+// for type-ahead and tolerates small typos, so the catalog can be searched
+// without an external search service.
+package search
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BM25 parameters.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Weights of the ways a query word can match an indexed term, relative to
+// an exact match of its stem.
+const (
+	prefixWeight = 0.8
+	typoWeight   = 0.6
+)
+
+// Field is a piece of a document's text. Occurrences of a word count Weight
+// times, so that e.g. a match in a product's name outranks one in its
+// description.
+type Field struct {
+	Text   string
+	Weight float64
+}
+
+// Hit is a matching document and its relevance; higher is better.
+type Hit struct {
+	ID    uint
+	Score float64
+}
+
+// Index maps words to the documents containing them. It is safe for
+// concurrent use.
+type Index struct {
+	mu sync.RWMutex
+
+	docs     map[uint]*document
+	postings map[string]map[uint]float64 // stem -> document -> weighted count
+	totalLen float64
+
+	// words are the unstemmed words seen, with the stem each maps to and
+	// how many documents use them; sortedWords lists them in order for
+	// prefix lookups.
+	words       map[string]*word
+	sortedWords []string
+}
+
+type document struct {
+	terms  map[string]float64
+	words  []string
+	length float64
+}
+
+type word struct {
+	stem string
+	docs int
+}
+
+// NewIndex returns an empty index.
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[uint]*document),
+		postings: make(map[string]map[uint]float64),
+		words:    make(map[string]*word),
+	}
+}
+
+// Tokenize splits text into lower-case words of letters and digits.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Put indexes a document, replacing any earlier version with the same ID.
+func (ix *Index) Put(id uint, fields ...Field) {
+	doc := &document{terms: make(map[string]float64)}
+	seen := make(map[string]bool)
+	for _, f := range fields {
+		for _, w := range Tokenize(f.Text) {
+			doc.terms[Stem(w)] += f.Weight
+			doc.length += f.Weight
+			if !seen[w] {
+				seen[w] = true
+				doc.words = append(doc.words, w)
+			}
+		}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.delete(id)
+	ix.docs[id] = doc
+	ix.totalLen += doc.length
+	for term, tf := range doc.terms {
+		if ix.postings[term] == nil {
+			ix.postings[term] = make(map[uint]float64)
+		}
+		ix.postings[term][id] = tf
+	}
+	for _, w := range doc.words {
+		if entry, ok := ix.words[w]; ok {
+			entry.docs++
+			continue
+		}
+		ix.words[w] = &word{stem: Stem(w), docs: 1}
+		i, _ := slices.BinarySearch(ix.sortedWords, w)
+		ix.sortedWords = slices.Insert(ix.sortedWords, i, w)
+	}
+}
+
+// Delete removes a document. Deleting an unknown ID does nothing.
+func (ix *Index) Delete(id uint) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.delete(id)
+}
+
+// delete must be called with ix.mu held.
+func (ix *Index) delete(id uint) {
+	doc, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+	delete(ix.docs, id)
+	ix.totalLen -= doc.length
+	for term := range doc.terms {
+		delete(ix.postings[term], id)
+		if len(ix.postings[term]) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	for _, w := range doc.words {
+		entry := ix.words[w]
+		if entry.docs--; entry.docs > 0 {
+			continue
+		}
+		delete(ix.words, w)
+		if i, found := slices.BinarySearch(ix.sortedWords, w); found {
+			ix.sortedWords = slices.Delete(ix.sortedWords, i, i+1)
+		}
+	}
+}
+
+// Search returns up to limit documents matching every word of query, best
+// first; ties go to the lower ID. Unless query ends in a space, its last
+// word also matches words it is a prefix of.
+func (ix *Index) Search(query string, limit int) []Hit {
+	words := Tokenize(query)
+	if len(words) == 0 || limit <= 0 {
+		return nil
+	}
+	typeAhead := !strings.HasSuffix(query, " ")
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	var scores map[uint]float64
+	for i, w := range words {
+		wordScores := ix.scoreWord(w, typeAhead && i == len(words)-1)
+		if scores == nil {
+			scores = wordScores
+			continue
+		}
+		// Every word must match: drop documents this one does not.
+		for id, s := range scores {
+			if ws, ok := wordScores[id]; ok {
+				scores[id] = s + ws
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, s := range scores {
+		hits = append(hits, Hit{ID: id, Score: s})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// scoreWord scores every document matching one query word by its best
+// matching term. It must be called with ix.mu held.
+func (ix *Index) scoreWord(w string, prefix bool) map[uint]float64 {
+	terms := map[string]float64{}
+	if _, ok := ix.postings[Stem(w)]; ok {
+		terms[Stem(w)] = 1
+	}
+	if prefix {
+		i, _ := slices.BinarySearch(ix.sortedWords, w)
+		for ; i < len(ix.sortedWords) && strings.HasPrefix(ix.sortedWords[i], w); i++ {
+			stem := ix.words[ix.sortedWords[i]].stem
+			terms[stem] = max(terms[stem], prefixWeight)
+		}
+	}
+	if len(terms) == 0 {
+		if maxEdits := allowedTypos(w); maxEdits > 0 {
+			for candidate, entry := range ix.words {
+				if editDistance(w, candidate, maxEdits) <= maxEdits {
+					terms[entry.stem] = max(terms[entry.stem], typoWeight)
+				}
+			}
+		}
+	}
+
+	scores := map[uint]float64{}
+	n := float64(len(ix.docs))
+	avgLen := ix.totalLen / n
+	for term, weight := range terms {
+		docs := ix.postings[term]
+		df := float64(len(docs))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range docs {
+			norm := tf * (k1 + 1) / (tf + k1*(1-b+b*ix.docs[id].length/avgLen))
+			scores[id] = max(scores[id], weight*idf*norm)
+		}
+	}
+	return scores
+}
+
+// allowedTypos is how many edits a query word may be from an indexed word:
+// none for short words, where a typo is as likely to be another word.
+func allowedTypos(w string) int {
+	switch n := len([]rune(w)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance returns the number of insertions, deletions, substitutions
+// and transpositions of adjacent characters turning from into to, or
+// limit+1 if it is more than limit.
+func editDistance(from, to string, limit int) int {
+	s, t := []rune(from), []rune(to)
+	if d := len(s) - len(t); d > limit || -d > limit {
+		return limit + 1
+	}
+	prev2 := make([]int, len(t)+1)
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return min(prev[len(t)], limit+1)
+}
@@ -0,0 +1,176 @@
+package search
+
+import (
+	"slices"
+	"testing"
+)
+
+// catalog returns an index of a few products, each with a name weighted
+// three times as much as its description.
+func catalog() *Index {
+	ix := NewIndex()
+	for id, doc := range map[uint][2]string{
+		1: {"Running shoes", "Light shoes for road running"},
+		2: {"Trail sneakers", "Grippy soles for running off road"},
+		3: {"Rain jacket", "Keeps you dry on long runs"},
+		4: {"Wool socks", "Warm socks for cold hikes"},
+		5: {"Shoelaces", "Spare laces for boots and shoes"},
+		6: {"Car charger", "Charges a phone in the car"},
+	} {
+		ix.Put(id, Field{Text: doc[0], Weight: 3}, Field{Text: doc[1], Weight: 1})
+	}
+	return ix
+}
+
+func ids(hits []Hit) []uint {
+	ids := make([]uint, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []uint
+	}{
+		// Stems: "runs" and "running" are both "run". Documents 2 and 3
+		// score the same and go by ID.
+		{"stemmed word", "runs ", []uint{1, 2, 3}},
+		{"every word must match", "running road ", []uint{1, 2}},
+		{"no match", "umbrella ", nil},
+		{"case and punctuation", "WOOL-socks!", []uint{4}},
+
+		// The last word is also a prefix unless the query ends in a space.
+		// "Shoelaces" is the rarer word in the heavier name, so it wins.
+		{"prefix", "shoe", []uint{5, 1}},
+		{"prefix of another word", "sho", []uint{5, 1}},
+		{"exact word without prefixes", "shoe ", []uint{1, 5}},
+		{"no prefix after a space", "sho ", nil},
+		{"only the last word is a prefix", "sho running", nil},
+
+		// A word without exact or prefix matches is retried with typos.
+		{"one substitution", "jacket", []uint{3}},
+		{"typo", "jackat ", []uint{3}},
+		{"transposition", "jakcet ", []uint{3}},
+		{"two typos in a long word", "sneekres ", []uint{2}},
+		{"too many typos", "jcakat ", nil},
+		{"no typos in short words", "caf ", nil},
+	}
+	ix := catalog()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids(ix.Search(tt.query, 10)); !slices.Equal(got, tt.want) {
+				t.Errorf("Search(%q) = %v; want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	ix := NewIndex()
+	ix.Put(1, Field{Text: "lamp", Weight: 1}, Field{Text: "a desk lamp with a long arm and a heavy base", Weight: 1})
+	ix.Put(2, Field{Text: "desk", Weight: 1}, Field{Text: "a desk", Weight: 1})
+	ix.Put(3, Field{Text: "lamp", Weight: 3}, Field{Text: "a desk lamp", Weight: 1})
+	ix.Put(4, Field{Text: "chair", Weight: 1})
+	ix.Put(5, Field{Text: "chair", Weight: 1})
+
+	tests := []struct {
+		name  string
+		query string
+		want  []uint
+	}{
+		// Document 3 has "lamp" in its heavier name; document 1 has it as
+		// often but in a longer document.
+		{"weight and length", "lamp ", []uint{3, 1}},
+		// "desk" is in more documents than "lamp", so it counts for less
+		// and the shorter document 2 comes first.
+		{"term frequency", "desk ", []uint{2, 3, 1}},
+		// Equal scores go to the lower ID.
+		{"ties", "chair ", []uint{4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits := ix.Search(tt.query, 10)
+			if got := ids(hits); !slices.Equal(got, tt.want) {
+				t.Errorf("Search(%q) = %v; want %v", tt.query, hits, tt.want)
+			}
+		})
+	}
+
+	// A rarer word outweighs a common one.
+	lamp, desk := ix.Search("lamp ", 1)[0], ix.Search("desk ", 3)
+	if lamp.ID != 3 || desk[1].ID != 3 || lamp.Score <= desk[1].Score {
+		t.Errorf("lamp hit %v, desk hits %v; want lamp to score higher for document 3", lamp, desk)
+	}
+	// Exact stems outrank prefix matches, which outrank typos.
+	exact, prefix, typo := ix.Search("chair ", 1)[0], ix.Search("chai", 1)[0], ix.Search("chiar ", 1)[0]
+	if !(exact.Score > prefix.Score && prefix.Score > typo.Score) {
+		t.Errorf("exact %v, prefix %v, typo %v; want decreasing scores", exact.Score, prefix.Score, typo.Score)
+	}
+}
+
+func TestSearchLimit(t *testing.T) {
+	ix := catalog()
+	if got := ids(ix.Search("shoes ", 1)); !slices.Equal(got, []uint{1}) {
+		t.Errorf("limit 1 = %v; want [1]", got)
+	}
+	if got := ix.Search("shoes ", 0); got != nil {
+		t.Errorf("limit 0 = %v; want none", got)
+	}
+	if got := ix.Search("  ", 10); got != nil {
+		t.Errorf("blank query = %v; want none", got)
+	}
+}
+
+func TestPutAndDelete(t *testing.T) {
+	ix := catalog()
+	ix.Put(6, Field{Text: "Trail shoes", Weight: 3})
+	if got := ids(ix.Search("car", 10)); len(got) != 0 {
+		t.Errorf("replaced document still found by its old words: %v", got)
+	}
+	if got := ids(ix.Search("trail ", 10)); !slices.Equal(got, []uint{6, 2}) {
+		t.Errorf("trail = %v; want [6 2]", got)
+	}
+
+	ix.Delete(2)
+	ix.Delete(99)
+	if got := ids(ix.Search("trail ", 10)); !slices.Equal(got, []uint{6}) {
+		t.Errorf("trail after delete = %v; want [6]", got)
+	}
+	// "grippy" was only in the deleted document, so it is gone as a prefix
+	// and as a typo candidate too.
+	if got := ix.Search("grip", 10); len(got) != 0 {
+		t.Errorf("grip = %v; want none", got)
+	}
+	if got := ix.Search("grippi ", 10); len(got) != 0 {
+		t.Errorf("grippi = %v; want none", got)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		from, to string
+		limit    int
+		want     int
+	}{
+		{"jacket", "jacket", 1, 0},
+		{"jacket", "jackat", 1, 1},  // substitution
+		{"jacket", "jackets", 1, 1}, // insertion
+		{"jacket", "jackt", 1, 1},   // deletion
+		{"jacket", "jakcet", 1, 1},  // transposition
+		{"sneakers", "sneekres", 2, 2},
+		{"jacket", "jcakat", 1, 2}, // over the limit
+		{"jacket", "coat", 5, 4},
+		{"jacket", "jack", 1, 2}, // lengths too far apart
+		{"café", "cafe", 1, 1},   // runes, not bytes
+		{"", "abc", 3, 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.from, tt.to, tt.limit); got != tt.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d; want %d", tt.from, tt.to, tt.limit, got, tt.want)
+		}
+	}
+}
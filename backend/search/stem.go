@@ -0,0 +1,203 @@
+package search
+
+// Stem reduces an English word to its stem with the Porter algorithm, so
+// that "running", "runs" and "run" all become "run". The word must be in
+// lower case; words with characters outside a-z are returned unchanged.
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+	w := []byte(word)
+	w = step1a(w)
+	w = step1b(w)
+	w = step1c(w)
+	w = replaceLongest(w, step2Rules, 0)
+	w = replaceLongest(w, step3Rules, 0)
+	w = step4(w)
+	w = step5(w)
+	return string(w)
+}
+
+// isCons reports whether w[i] is a consonant. Y is a consonant unless it
+// follows one.
+func isCons(w []byte, i int) bool {
+	switch w[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !isCons(w, i-1)
+	}
+	return true
+}
+
+// measure counts the vowel-consonant sequences in w.
+func measure(w []byte) int {
+	n, i := 0, 0
+	for i < len(w) && isCons(w, i) {
+		i++
+	}
+	for i < len(w) {
+		for i < len(w) && !isCons(w, i) {
+			i++
+		}
+		if i == len(w) {
+			break
+		}
+		for i < len(w) && isCons(w, i) {
+			i++
+		}
+		n++
+	}
+	return n
+}
+
+func hasVowel(w []byte) bool {
+	for i := range w {
+		if !isCons(w, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// endsDouble reports whether w ends in a double consonant.
+func endsDouble(w []byte) bool {
+	n := len(w)
+	return n >= 2 && w[n-1] == w[n-2] && isCons(w, n-1)
+}
+
+// endsCVC reports whether w ends consonant-vowel-consonant where the last
+// consonant is not w, x or y, as in "hop" but not "snow".
+func endsCVC(w []byte) bool {
+	n := len(w)
+	if n < 3 || !isCons(w, n-3) || isCons(w, n-2) || !isCons(w, n-1) {
+		return false
+	}
+	c := w[n-1]
+	return c != 'w' && c != 'x' && c != 'y'
+}
+
+func hasSuffix(w []byte, suffix string) bool {
+	return len(w) >= len(suffix) && string(w[len(w)-len(suffix):]) == suffix
+}
+
+type rule struct{ suffix, replacement string }
+
+// replaceLongest applies the rule with the longest matching suffix if the
+// rest of the word has a measure above minMeasure. Rules must be listed
+// longest suffix first.
+func replaceLongest(w []byte, rules []rule, minMeasure int) []byte {
+	for _, r := range rules {
+		if !hasSuffix(w, r.suffix) {
+			continue
+		}
+		stem := w[:len(w)-len(r.suffix)]
+		if measure(stem) > minMeasure {
+			return append(stem, r.replacement...)
+		}
+		return w
+	}
+	return w
+}
+
+func step1a(w []byte) []byte {
+	switch {
+	case hasSuffix(w, "sses"), hasSuffix(w, "ies"):
+		return w[:len(w)-2]
+	case hasSuffix(w, "ss"):
+		return w
+	case hasSuffix(w, "s"):
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+func step1b(w []byte) []byte {
+	if hasSuffix(w, "eed") {
+		if measure(w[:len(w)-3]) > 0 {
+			return w[:len(w)-1]
+		}
+		return w
+	}
+	var stem []byte
+	switch {
+	case hasSuffix(w, "ed") && hasVowel(w[:len(w)-2]):
+		stem = w[:len(w)-2]
+	case hasSuffix(w, "ing") && hasVowel(w[:len(w)-3]):
+		stem = w[:len(w)-3]
+	default:
+		return w
+	}
+	switch {
+	case hasSuffix(stem, "at"), hasSuffix(stem, "bl"), hasSuffix(stem, "iz"):
+		return append(stem, 'e')
+	case endsDouble(stem):
+		if c := stem[len(stem)-1]; c != 'l' && c != 's' && c != 'z' {
+			return stem[:len(stem)-1]
+		}
+	case measure(stem) == 1 && endsCVC(stem):
+		return append(stem, 'e')
+	}
+	return stem
+}
+
+func step1c(w []byte) []byte {
+	if hasSuffix(w, "y") && hasVowel(w[:len(w)-1]) {
+		w[len(w)-1] = 'i'
+	}
+	return w
+}
+
+var step2Rules = []rule{
+	{"ational", "ate"}, {"iveness", "ive"}, {"fulness", "ful"}, {"ousness", "ous"},
+	{"ization", "ize"}, {"tional", "tion"}, {"biliti", "ble"}, {"entli", "ent"},
+	{"ousli", "ous"}, {"ation", "ate"}, {"alism", "al"}, {"aliti", "al"},
+	{"iviti", "ive"}, {"enci", "ence"}, {"anci", "ance"}, {"izer", "ize"},
+	{"abli", "able"}, {"alli", "al"}, {"ator", "ate"}, {"logi", "log"},
+	{"eli", "e"},
+}
+
+var step3Rules = []rule{
+	{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+	{"ical", "ic"}, {"ness", ""}, {"ful", ""},
+}
+
+var step4Suffixes = []string{
+	"ement", "ance", "ence", "able", "ible", "ment", "ant", "ent", "ion",
+	"ism", "ate", "iti", "ous", "ive", "ize", "al", "er", "ic", "ou",
+}
+
+func step4(w []byte) []byte {
+	for _, suffix := range step4Suffixes {
+		if !hasSuffix(w, suffix) {
+			continue
+		}
+		stem := w[:len(w)-len(suffix)]
+		if measure(stem) <= 1 {
+			return w
+		}
+		if suffix == "ion" && !hasSuffix(stem, "s") && !hasSuffix(stem, "t") {
+			return w
+		}
+		return stem
+	}
+	return w
+}
+
+func step5(w []byte) []byte {
+	if hasSuffix(w, "e") {
+		stem := w[:len(w)-1]
+		if m := measure(stem); m > 1 || (m == 1 && !endsCVC(stem)) {
+			w = stem
+		}
+	}
+	if measure(w) > 1 && endsDouble(w) && hasSuffix(w, "l") {
+		w = w[:len(w)-1]
+	}
+	return w
+}
@@ -0,0 +1,40 @@
+package search
+
+import "testing"
+
+func TestStem(t *testing.T) {
+	// Examples from Porter's paper, run through the whole algorithm.
+	tests := map[string]string{
+		// Step 1a: plurals.
+		"caresses": "caress", "ponies": "poni", "ties": "ti", "caress": "caress", "cats": "cat",
+		// Step 1b: -ed and -ing, restoring an e or undoubling after them.
+		"feed": "feed", "agreed": "agre", "plastered": "plaster", "bled": "bled",
+		"motoring": "motor", "sing": "sing", "conflated": "conflat", "troubled": "troubl",
+		"sized": "size", "hopping": "hop", "tanned": "tan", "falling": "fall",
+		"hissing": "hiss", "fizzed": "fizz", "failing": "fail", "filing": "file",
+		// Step 1c: y after a vowel.
+		"happy": "happi", "sky": "sky",
+		// Steps 2 and 3: double and single suffixes.
+		"relational": "relat", "conditional": "condit", "rational": "ration",
+		"digitizer": "digit", "operator": "oper", "triplicate": "triplic",
+		"formative": "form", "formalize": "formal", "electrical": "electr",
+		"hopeful": "hope", "goodness": "good",
+		// Step 4: suffixes after a measure above one.
+		"revival": "reviv", "allowance": "allow", "inference": "infer",
+		"airliner": "airlin", "adjustable": "adjust", "defensible": "defens",
+		"irritant": "irrit", "replacement": "replac", "adjustment": "adjust",
+		"dependent": "depend", "adoption": "adopt", "communism": "commun",
+		"activate": "activ", "effective": "effect", "bowdlerize": "bowdler",
+		// Step 5: a final e and ll.
+		"probate": "probat", "rate": "rate", "cease": "ceas", "controlling": "control", "roll": "roll",
+		// Everyday catalog words and several steps at once.
+		"running": "run", "runs": "run", "shoes": "shoe", "generalizations": "gener",
+		// Too short, or not plain lower-case letters: unchanged.
+		"go": "go", "a1b": "a1b", "Caps": "Caps", "café": "café",
+	}
+	for word, want := range tests {
+		if got := Stem(word); got != want {
+			t.Errorf("Stem(%q) = %q; want %q", word, got, want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthMiddleware checks for a valid access token in the Authorization
+// header. Only the signature and expiry are checked, never the store, so it
+// works on stateless deployments. Expired tokens are rejected with code
+// "token_expired" so clients know to refresh; anything else that fails is
+// "invalid_token".
+func AuthMiddleware(tokens *AccessTokens) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader("Authorization")
+		if strings.HasPrefix(token, "Bearer ") {
+			token = strings.TrimPrefix(token, "Bearer ")
+		}
+		if token == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid token", "code": "missing_token"})
+			c.Abort()
+			return
+		}
+
+		claims, err := tokens.Verify(token)
+		if errors.Is(err, ErrTokenExpired) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired", "code": "token_expired"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "code": "invalid_token"})
+			c.Abort()
+			return
+		}
+
+		// Attach user info to context for downstream handlers. Only the
+		// fields carried by the token are set; load the full record from the
+		// store when more is needed.
+		c.Set("user", &User{ID: claims.UserID(), Username: claims.Username, Roles: claims.Roles})
+		c.Set("claims", claims)
+		c.Next()
+	}
+}
+
+// RequireRole allows the request through only if the user holds at least one
+// of roles, and responds 403 otherwise. It must run after AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(*User)
+		if !user.Roles.Has(roles...) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden", "code": "forbidden"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,363 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"fullstack-shopping-cart/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CartLineResponse is one cart line together with the product, and the
+// variant of it, it refers to. ImageURL is the small thumbnail of the
+// product's primary image, if it has one.
+type CartLineResponse struct {
+	ID        uint           `json:"id"`
+	ItemID    uint           `json:"itemId"`
+	VariantID uint           `json:"variantId,omitempty"`
+	Name      string         `json:"name"`
+	SKU       string         `json:"sku,omitempty"`
+	Options   VariantOptions `json:"options,omitempty"`
+	ImageURL  string         `json:"imageUrl,omitempty"`
+	UnitPrice money.Money    `json:"unitPrice"`
+	Quantity  int            `json:"quantity"`
+	LineTotal money.Money    `json:"lineTotal"`
+}
+
+// CartResponse is a cart with everything a client needs to render it.
+type CartResponse struct {
+	CartID    uint               `json:"cartId"`
+	Items     []CartLineResponse `json:"items"`
+	ItemCount int                `json:"itemCount"`
+	Subtotal  money.Money        `json:"subtotal"`
+	Currency  string             `json:"currency"`
+}
+
+// newCartResponse prices the cart's lines at the current catalog prices in
+// p's currency. cart.CartItems must have Item and Variant populated. It
+// returns an error if a line's price is stored in a currency other than the
+// shop's, which it cannot price.
+func (h *handler) newCartResponse(ctx context.Context, cart *Cart, p *pricer) (CartResponse, error) {
+	resp := CartResponse{
+		CartID:   cart.ID,
+		Items:    make([]CartLineResponse, 0, len(cart.CartItems)),
+		Subtotal: money.New(0, p.currency),
+		Currency: p.currency,
+	}
+	ids := make([]uint, len(cart.CartItems))
+	for i, ci := range cart.CartItems {
+		ids[i] = ci.ItemID
+	}
+	if err := p.load(ctx, h.store, ids); err != nil {
+		return CartResponse{}, err
+	}
+	for _, ci := range cart.CartItems {
+		price := p.variantPrice(&ci.Item, ci.Variant)
+		lineTotal, err := price.Mul(int64(ci.Quantity))
+		if err != nil {
+			return CartResponse{}, fmt.Errorf("cart %d, item %d: %w", cart.ID, ci.ItemID, err)
+		}
+		line := CartLineResponse{
+			ID:        ci.ID,
+			ItemID:    ci.ItemID,
+			VariantID: ci.VariantID,
+			Name:      ci.Item.Name,
+			UnitPrice: price,
+			Quantity:  ci.Quantity,
+			LineTotal: lineTotal,
+		}
+		if ci.Variant != nil {
+			line.SKU = ci.Variant.SKU
+			line.Options = ci.Variant.Options
+		}
+		for _, img := range ci.Item.Images {
+			if img.Primary {
+				h.setImageURL(&img)
+				line.ImageURL = img.Thumbnails["small"]
+			}
+		}
+		resp.Items = append(resp.Items, line)
+		resp.ItemCount += ci.Quantity
+		subtotal, err := money.Sum(resp.Subtotal, line.LineTotal)
+		if err != nil {
+			return CartResponse{}, fmt.Errorf("cart %d, item %d: %w", cart.ID, ci.ItemID, err)
+		}
+		resp.Subtotal = subtotal
+	}
+	return resp, nil
+}
+
+// AddItemToCartRequest adds Quantity units of an item, 1 if omitted. Items
+// with variants need VariantID to say which one.
+type AddItemToCartRequest struct {
+	ItemID    uint `json:"itemId" binding:"required"`
+	VariantID uint `json:"variantId"`
+	Quantity  int  `json:"quantity" binding:"omitempty,min=1,max=999"`
+}
+
+type UpdateCartItemRequest struct {
+	Quantity int `json:"quantity" binding:"required,min=1,max=999"`
+}
+
+func (h *handler) addItemToCart(c *gin.Context) {
+	userObj, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	user := userObj.(*User)
+
+	var req AddItemToCartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if !h.checkPurchasable(c, req.ItemID, req.VariantID) {
+		return
+	}
+
+	// Find or create cart for user
+	ctx := c.Request.Context()
+	cart, err := h.store.Carts().GetByUser(ctx, user.ID)
+	if errors.Is(err, ErrNotFound) {
+		cart, err = h.store.Carts().GetOrCreateForUser(ctx, user.ID)
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	// Add item to cart, merging with an existing line for the same item
+	// and variant
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+	cartItem := &CartItem{
+		CartID:        cart.ID,
+		ItemID:        req.ItemID,
+		VariantID:     req.VariantID,
+		Quantity:      req.Quantity,
+		ReservedUntil: h.reservationExpiry(),
+	}
+	if !h.saveCartLine(c, h.store.Carts().AddItem(ctx, cartItem)) {
+		return
+	}
+
+	c.JSON(http.StatusOK, cartLineSummary(cartItem))
+}
+
+// updateCartItem sets the quantity of one item, or of the variant of it
+// named by the variantId query parameter, in the user's cart, adding the
+// line if the cart does not have it yet.
+func (h *handler) updateCartItem(c *gin.Context) {
+	user := c.MustGet("user").(*User)
+	itemID, ok := itemIDParam(c)
+	if !ok {
+		return
+	}
+	variantID, ok := variantIDQuery(c)
+	if !ok {
+		return
+	}
+	var req UpdateCartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if !h.checkPurchasable(c, itemID, variantID) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	cart, err := h.store.Carts().GetOrCreateForUser(ctx, user.ID)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	line, err := h.store.Carts().SetItemQuantity(ctx, cart.ID, itemID, variantID, req.Quantity, h.reservationExpiry())
+	if !h.saveCartLine(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, cartLineSummary(line))
+}
+
+// cartLineSummary is the response to changing a cart line.
+func cartLineSummary(line *CartItem) gin.H {
+	summary := gin.H{"cartId": line.CartID, "itemId": line.ItemID, "quantity": line.Quantity}
+	if line.VariantID != 0 {
+		summary["variantId"] = line.VariantID
+	}
+	return summary
+}
+
+// removeCartItem deletes the line of one item, or of the variant of it named
+// by the variantId query parameter, from the user's cart.
+func (h *handler) removeCartItem(c *gin.Context) {
+	user := c.MustGet("user").(*User)
+	itemID, ok := itemIDParam(c)
+	if !ok {
+		return
+	}
+	variantID, ok := variantIDQuery(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	cart, err := h.store.Carts().GetByUser(ctx, user.ID)
+	if err == nil {
+		err = h.store.Carts().RemoveItem(ctx, cart.ID, itemID, variantID)
+	}
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not in cart"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// clearCart deletes every line from the user's cart.
+func (h *handler) clearCart(c *gin.Context) {
+	user := c.MustGet("user").(*User)
+
+	ctx := c.Request.Context()
+	cart, err := h.store.Carts().GetByUser(ctx, user.ID)
+	if err == nil {
+		err = h.store.Carts().Clear(ctx, cart.ID)
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		internalError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// checkPurchasable responds and returns false unless the item can be put in
+// a cart as the given variant, zero meaning the item itself: the item must
+// exist and not be archived, the variant must be one of its, and an item
+// with variants can only be bought as one of them.
+func (h *handler) checkPurchasable(c *gin.Context, itemID, variantID uint) bool {
+	item, err := h.store.Items().Get(c.Request.Context(), itemID)
+	if errors.Is(err, ErrNotFound) || (err == nil && item.ArchivedAt != nil) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return false
+	}
+	if err != nil {
+		internalError(c, err)
+		return false
+	}
+	if variantID == 0 && len(item.Variants) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    item.Name + " comes in several variants; choose one by sending its variantId",
+			"options":  item.Options,
+			"variants": item.Variants,
+		})
+		return false
+	}
+	if variantID != 0 && !slices.ContainsFunc(item.Variants, func(v Variant) bool { return v.ID == variantID }) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return false
+	}
+	return true
+}
+
+// reservationExpiry returns when the reservation of a cart line changed now
+// should expire, or nil if reservations are off.
+func (h *handler) reservationExpiry() *time.Time {
+	if h.reservationTTL <= 0 {
+		return nil
+	}
+	until := time.Now().Add(h.reservationTTL)
+	return &until
+}
+
+// saveCartLine responds to the error of adding or changing a cart line,
+// with 409 and the shortage if stock cannot cover the line or 400 if the
+// line would hold too many units, and returns whether there was none.
+func (h *handler) saveCartLine(c *gin.Context, err error) bool {
+	var stockErr *InsufficientStockError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &stockErr):
+		c.JSON(http.StatusConflict, gin.H{"error": "Not enough stock", "lines": stockErr.Shortages})
+	case errors.Is(err, ErrQuantityTooLarge):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "A cart holds at most " + strconv.Itoa(MaxCartQuantity) + " units of an item",
+		})
+	default:
+		internalError(c, err)
+	}
+	return false
+}
+
+// itemIDParam parses the :itemId path parameter, responding 400 if it is
+// not a valid ID.
+func itemIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("itemId"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// variantIDQuery parses the optional variantId query parameter, responding
+// 400 if it is not a valid ID. It returns zero if the parameter is absent.
+func variantIDQuery(c *gin.Context) (uint, bool) {
+	s := c.Query("variantId")
+	if s == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// fetchCartItems returns the user's cart priced in the currency the request
+// asks for.
+func (h *handler) fetchCartItems(c *gin.Context) {
+	userObj, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	user := userObj.(*User)
+	p, ok := h.pricerFor(c)
+	if !ok {
+		return
+	}
+
+	// Find cart for user; a user without one sees an empty cart
+	cart, err := h.store.Carts().GetByUser(c.Request.Context(), user.ID)
+	if errors.Is(err, ErrNotFound) {
+		cart = &Cart{}
+	} else if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	resp, err := h.newCartResponse(c.Request.Context(), cart, p)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
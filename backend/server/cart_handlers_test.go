@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"fullstack-shopping-cart/money"
+)
+
+func TestCartInForeignStoredCurrency(t *testing.T) {
+	s := newTestServer(t, Config{Currency: "EUR"})
+	s.createUser("alice")
+	token, _ := s.login("alice")
+	// A price left in another currency, e.g. by a change of CURRENCY.
+	item := &Item{Name: "Lamp", Price: money.New(1000, "USD"), StockQuantity: 5}
+	if err := s.store.Items().Create(context.Background(), item); err != nil {
+		t.Fatal(err)
+	}
+	var line struct {
+		CartID uint `json:"cartId"`
+	}
+	s.decode(s.do(http.MethodPost, "/carts", token, map[string]any{"itemId": item.ID}), http.StatusOK, &line)
+
+	var resp struct {
+		Error string `json:"error"`
+	}
+	s.decode(s.do(http.MethodGet, "/carts", token, nil), http.StatusInternalServerError, &resp)
+	if resp.Error == "" {
+		t.Errorf("cart: want an error response")
+	}
+	resp.Error = ""
+	s.decode(s.do(http.MethodPost, "/orders", token, map[string]any{"cartId": line.CartID}), http.StatusInternalServerError, &resp)
+	if resp.Error == "" {
+		t.Errorf("checkout: want an error response")
+	}
+}
+
+func TestAddItemToCartVariants(t *testing.T) {
+	s := newTestServer(t, Config{})
+	s.createUser("alice")
+	token, _ := s.login("alice")
+	ctx := context.Background()
+	shirt := &Item{
+		Name:    "Shirt",
+		Price:   money.New(2000, DefaultCurrency),
+		Options: ItemOptions{{Name: "size", Values: []string{"S", "M"}}},
+	}
+	mug := &Item{Name: "Mug", Price: money.New(800, DefaultCurrency), StockQuantity: 5}
+	for _, item := range []*Item{shirt, mug} {
+		if err := s.store.Items().Create(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var variants []*Variant
+	for _, size := range []string{"S", "M"} {
+		v := &Variant{ItemID: shirt.ID, SKU: "SHIRT-" + size, Options: VariantOptions{"size": size}, StockQuantity: 5}
+		if err := s.store.Variants().Create(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+		variants = append(variants, v)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   map[string]any
+		want   int
+	}{
+		{"without a variant", http.MethodPost, "/carts", map[string]any{"itemId": shirt.ID}, http.StatusBadRequest},
+		{"quantity without a variant", http.MethodPut, fmt.Sprintf("/carts/items/%d", shirt.ID), map[string]any{"quantity": 2}, http.StatusBadRequest},
+		{"unknown variant", http.MethodPost, "/carts", map[string]any{"itemId": shirt.ID, "variantId": 999}, http.StatusNotFound},
+		{"variant of an item without variants", http.MethodPost, "/carts", map[string]any{"itemId": mug.ID, "variantId": variants[0].ID}, http.StatusNotFound},
+		{"with a variant", http.MethodPost, "/carts", map[string]any{"itemId": shirt.ID, "variantId": variants[1].ID}, http.StatusOK},
+		{"item without variants", http.MethodPost, "/carts", map[string]any{"itemId": mug.ID}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp struct {
+				Error     string    `json:"error"`
+				VariantID uint      `json:"variantId"`
+				Variants  []Variant `json:"variants"`
+			}
+			s.decode(s.do(tt.method, tt.target, token, tt.body), tt.want, &resp)
+			switch tt.want {
+			case http.StatusBadRequest:
+				// The response lists the variants to choose from.
+				if resp.Error == "" || len(resp.Variants) != len(variants) {
+					t.Errorf("response %+v; want an error and %d variants", resp, len(variants))
+				}
+			case http.StatusOK:
+				if want := tt.body["variantId"]; want != nil && resp.VariantID != want.(uint) {
+					t.Errorf("line variant = %d; want %d", resp.VariantID, want)
+				}
+			}
+		})
+	}
+
+	var cart CartResponse
+	s.decode(s.do(http.MethodGet, "/carts", token, nil), http.StatusOK, &cart)
+	if len(cart.Items) != 2 {
+		t.Errorf("cart has %d lines; want the shirt in M and the mug", len(cart.Items))
+	}
+}
+
+func TestAddItemToCartQuantityLimit(t *testing.T) {
+	s := newTestServer(t, Config{})
+	s.createUser("alice")
+	token, _ := s.login("alice")
+	item := &Item{Name: "Screw", Price: money.New(5, DefaultCurrency), StockQuantity: 5000}
+	if err := s.store.Items().Create(context.Background(), item); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		quantity int
+		want     int
+	}{
+		{MaxCartQuantity + 1, http.StatusBadRequest},
+		{MaxCartQuantity - 1, http.StatusOK},
+		{1, http.StatusOK},
+		// The line already holds the most a cart line may.
+		{1, http.StatusBadRequest},
+	}
+	for i, step := range steps {
+		w := s.do(http.MethodPost, "/carts", token, map[string]any{"itemId": item.ID, "quantity": step.quantity})
+		if w.Code != step.want {
+			t.Fatalf("step %d: adding %d = %d; want %d; body %s", i+1, step.quantity, w.Code, step.want, w.Body)
+		}
+	}
+	var cart CartResponse
+	s.decode(s.do(http.MethodGet, "/carts", token, nil), http.StatusOK, &cart)
+	if len(cart.Items) != 1 || cart.Items[0].Quantity != MaxCartQuantity {
+		t.Errorf("cart = %+v; want one line of %d units", cart.Items, MaxCartQuantity)
+	}
+}
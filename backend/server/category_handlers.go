@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CategoryRequest creates or replaces a category. Slug defaults to one made
+// from Name; a nil ParentID makes the category top-level.
+type CategoryRequest struct {
+	Name      string `json:"name" binding:"required"`
+	Slug      string `json:"slug"`
+	ParentID  *uint  `json:"parentId"`
+	SortOrder int    `json:"sortOrder"`
+}
+
+// CategoryNode is a category with its subcategories.
+type CategoryNode struct {
+	Category
+	Children []CategoryNode `json:"children"`
+}
+
+// slugPattern matches lower-case words of letters and digits joined by
+// hyphens, e.g. "running-shoes".
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// slugify makes a slug out of a category name, or returns "" if the name
+// has no ASCII letters or digits.
+func slugify(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+	})
+	return strings.Join(words, "-")
+}
+
+// categoryTree arranges categories, in the order CategoryRepository.List
+// returns them, into trees under their parents.
+func categoryTree(categories []Category) []CategoryNode {
+	// Top-level categories are listed under parent 0, which no category
+	// has as its ID.
+	children := make(map[uint][]Category)
+	for _, c := range categories {
+		var parent uint
+		if c.ParentID != nil {
+			parent = *c.ParentID
+		}
+		children[parent] = append(children[parent], c)
+	}
+	var build func(parent uint) []CategoryNode
+	build = func(parent uint) []CategoryNode {
+		nodes := make([]CategoryNode, 0, len(children[parent]))
+		for _, c := range children[parent] {
+			nodes = append(nodes, CategoryNode{Category: c, Children: build(c.ID)})
+		}
+		return nodes
+	}
+	return build(0)
+}
+
+// categorySubtree returns the IDs of the category with the given slug and
+// of every category below it. It returns ErrNotFound if there is no such
+// category.
+func (h *handler) categorySubtree(ctx context.Context, slug string) ([]uint, error) {
+	root, err := h.store.Categories().GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	all, err := h.store.Categories().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := []uint{root.ID}
+	for i := 0; i < len(ids); i++ {
+		for _, c := range all {
+			if c.ParentID != nil && *c.ParentID == ids[i] {
+				ids = append(ids, c.ID)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// listCategories returns the whole taxonomy as a list of trees.
+func (h *handler) listCategories(c *gin.Context) {
+	categories, err := h.store.Categories().List(c.Request.Context())
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, categoryTree(categories))
+}
+
+// listCategoryItems returns one page of the items in the category named by
+// :slug or any category below it. It takes the same query parameters as
+// GET /items.
+func (h *handler) listCategoryItems(c *gin.Context) {
+	ids, err := h.categorySubtree(c.Request.Context(), c.Param("slug"))
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	p, ok := h.pricerFor(c)
+	if !ok {
+		return
+	}
+	opts, ok := h.itemListOptions(c, p)
+	if !ok {
+		return
+	}
+	opts.CategoryIDs = ids
+	h.respondItemPage(c, p, opts)
+}
+
+func (h *handler) createCategory(c *gin.Context) {
+	category := &Category{}
+	if !bindCategory(c, category) {
+		return
+	}
+	err := h.store.Categories().Create(c.Request.Context(), category)
+	if !h.checkCategorySaved(c, err) {
+		return
+	}
+	c.JSON(http.StatusCreated, category)
+}
+
+// replaceCategory sets every field of a category, which moves it when the
+// parent changes.
+func (h *handler) replaceCategory(c *gin.Context) {
+	category, ok := h.loadCategory(c)
+	if !ok || !bindCategory(c, category) {
+		return
+	}
+	err := h.store.Categories().Update(c.Request.Context(), category)
+	if !h.checkCategorySaved(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, category)
+}
+
+// deleteCategory removes a category that has no subcategories. Its items
+// stay in the catalog.
+func (h *handler) deleteCategory(c *gin.Context) {
+	category, ok := h.loadCategory(c)
+	if !ok {
+		return
+	}
+	err := h.store.Categories().Delete(c.Request.Context(), category.ID)
+	if errors.Is(err, ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Category has subcategories; move or delete them first"})
+		return
+	}
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// bindCategory reads a CategoryRequest into category, responding 400 and
+// returning false if it is invalid.
+func bindCategory(c *gin.Context, category *Category) bool {
+	var req CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return false
+	}
+	if req.Slug == "" {
+		req.Slug = slugify(req.Name)
+	}
+	if !slugPattern.MatchString(req.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "slug must be lower-case letters and digits separated by hyphens"})
+		return false
+	}
+	category.Name = req.Name
+	category.Slug = req.Slug
+	category.ParentID = req.ParentID
+	category.SortOrder = req.SortOrder
+	return true
+}
+
+// checkCategorySaved responds to the error of creating or updating a
+// category and returns whether there was none.
+func (h *handler) checkCategorySaved(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrCategoryCycle):
+		c.JSON(http.StatusConflict, gin.H{"error": "A category cannot be moved under itself or one of its subcategories"})
+	case errors.Is(err, ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "Slug is already taken"})
+	case errors.Is(err, ErrNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parent category not found"})
+	default:
+		internalError(c, err)
+	}
+	return false
+}
+
+// loadCategory fetches the category named by the :id parameter.
+func (h *handler) loadCategory(c *gin.Context) (*Category, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category id"})
+		return nil, false
+	}
+	category, err := h.store.Categories().Get(c.Request.Context(), uint(id))
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return nil, false
+	}
+	if err != nil {
+		internalError(c, err)
+		return nil, false
+	}
+	return category, true
+}
+
+// loadCategories fetches the categories with the given IDs for assigning
+// items to, responding 400 and returning false if any does not exist.
+func (h *handler) loadCategories(c *gin.Context, ids []uint) ([]Category, bool) {
+	categories := []Category{}
+	for _, id := range ids {
+		if slices.ContainsFunc(categories, func(c Category) bool { return c.ID == id }) {
+			continue
+		}
+		category, err := h.store.Categories().Get(c.Request.Context(), id)
+		if errors.Is(err, ErrNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown category id " + strconv.FormatUint(uint64(id), 10)})
+			return nil, false
+		}
+		if err != nil {
+			internalError(c, err)
+			return nil, false
+		}
+		categories = append(categories, *category)
+	}
+	return categories, true
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"fullstack-shopping-cart/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CurrencyHeader selects the currency prices are shown and charged in when
+// the request has no currency query parameter.
+const CurrencyHeader = "X-Currency"
+
+// currencyCode upper-cases s and reports whether it looks like an ISO 4217
+// code.
+func currencyCode(s string) (string, bool) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if len(s) != 3 {
+		return "", false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return "", false
+		}
+	}
+	return s, true
+}
+
+// pricer prices items in the currency a request asked for. Items are priced
+// at their own price in that currency if they have one and at their price in
+// the shop's currency converted at the current exchange rate otherwise.
+type pricer struct {
+	base     string
+	currency string
+	rate     *big.Rat
+	// rateText is rate as recorded on orders.
+	rateText string
+	// prices are the loaded items' own prices in currency.
+	prices map[uint]money.Money
+}
+
+// pricerFor returns a pricer for the currency named by the currency query
+// parameter or CurrencyHeader, or for the shop's currency if neither is set.
+// It responds 400 and returns false if the currency is malformed or has no
+// exchange rate in effect.
+func (h *handler) pricerFor(c *gin.Context) (*pricer, bool) {
+	p := &pricer{base: h.currency, currency: h.currency, rate: big.NewRat(1, 1), rateText: "1"}
+	requested := c.Query("currency")
+	if requested == "" {
+		requested = c.GetHeader(CurrencyHeader)
+	}
+	if requested == "" {
+		return p, true
+	}
+	code, ok := currencyCode(requested)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid currency"})
+		return nil, false
+	}
+	if code == h.currency {
+		return p, true
+	}
+
+	rate, err := h.store.ExchangeRates().Current(c.Request.Context(), code, time.Now())
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Prices are not available in " + code})
+		return nil, false
+	}
+	if err != nil {
+		internalError(c, err)
+		return nil, false
+	}
+	r, err := money.ParseRate(rate.Rate)
+	if err != nil {
+		internalError(c, err)
+		return nil, false
+	}
+	p.currency, p.rate, p.rateText = code, r, rate.Rate
+	return p, true
+}
+
+// load fetches the own prices in p's currency of the items with the given
+// IDs, which price then uses instead of converting.
+func (p *pricer) load(ctx context.Context, store Store, ids []uint) error {
+	if p.currency == p.base {
+		return nil
+	}
+	prices, err := store.Items().PricesIn(ctx, p.currency, ids)
+	if err != nil {
+		return err
+	}
+	p.prices = prices
+	return nil
+}
+
+// price returns the item's price in p's currency. Call load for the item
+// first.
+func (p *pricer) price(item *Item) money.Money {
+	if own, ok := p.prices[item.ID]; ok {
+		return own
+	}
+	return p.convert(item.Price)
+}
+
+// variantPrice returns the price in p's currency of the item's variant v,
+// or of the item itself if v is nil. A variant without its own price costs
+// what the item does; its own price is converted at the exchange rate.
+func (p *pricer) variantPrice(item *Item, v *Variant) money.Money {
+	if v != nil && v.Price != nil {
+		return p.convert(*v.Price)
+	}
+	return p.price(item)
+}
+
+// convert returns an amount in the shop's currency in p's currency. An
+// amount stored in some other currency is returned as it is, for totals to
+// reject rather than to be converted at the wrong rate.
+func (p *pricer) convert(m money.Money) money.Money {
+	if p.currency == p.base || m.Currency != p.base {
+		return m
+	}
+	return m.Convert(p.currency, p.rate)
+}
+
+// pricing returns rules with its amounts converted into p's currency.
+func (p *pricer) pricing(rules Pricing) Pricing {
+	rules.ShippingFee = p.convert(rules.ShippingFee)
+	rules.FreeShippingOver = p.convert(rules.FreeShippingOver)
+	return rules
+}
+
+// localize replaces the price of each item, and each own price of its
+// variants, with the price in p's currency, and fills in the URLs of its
+// images. It responds 500 and returns false if the prices cannot be
+// loaded.
+func (h *handler) localize(c *gin.Context, p *pricer, items []Item) bool {
+	ids := make([]uint, len(items))
+	for i := range items {
+		ids[i] = items[i].ID
+	}
+	if err := p.load(c.Request.Context(), h.store, ids); err != nil {
+		internalError(c, err)
+		return false
+	}
+	h.setItemImageURLs(items)
+	for i := range items {
+		items[i].Price = p.price(&items[i])
+		for j := range items[i].Variants {
+			if v := &items[i].Variants[j]; v.Price != nil {
+				price := p.convert(*v.Price)
+				v.Price = &price
+			}
+		}
+	}
+	return true
+}
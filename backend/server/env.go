@@ -0,0 +1,152 @@
+package server
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"time"
+
+	"fullstack-shopping-cart/media"
+	"fullstack-shopping-cart/money"
+)
+
+// ConfigFromEnv reads the settings that every deployment takes from its
+// environment, so that the standalone binary and the Vercel function cannot
+// drift apart:
+//
+//	CORS_ALLOW_ORIGIN        Access-Control-Allow-Origin (default *)
+//	PASSWORD_HASH            argon2id (the default) or bcrypt
+//	SESSION_TTL              how long a refresh token stays valid
+//	JWT_SIGNING_KEYS         access-token signing keys; see ParseSigningKeys
+//	ACCESS_TOKEN_TTL         how long an access token stays valid
+//	IDEMPOTENCY_TTL          how long responses are kept for replay
+//	CART_RESERVATION_TTL     how long cart lines hold stock (unset: not at all)
+//	SEARCH_REFRESH_INTERVAL  how often the search index is rebuilt (unset: never)
+//	CURRENCY                 the shop's currency; see CurrencyFromEnv
+//	TAX_RATE                 e.g. 0.08 for 8%
+//	SHIPPING_FEE             per order, in CURRENCY
+//	FREE_SHIPPING_OVER       subtotal at which shipping is free
+//	MAX_IMAGE_BYTES          largest image upload
+//
+// Unset durations and sizes are left zero for NewRouter to default. The
+// store, media storage, Prefix and RequestLogging are up to the caller. It
+// returns an error naming the first variable that is invalid.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{AllowOrigin: os.Getenv("CORS_ALLOW_ORIGIN")}
+	if cfg.AllowOrigin == "" {
+		cfg.AllowOrigin = "*"
+	}
+	var err error
+	if cfg.PasswordHasher, err = NewPasswordHasher(os.Getenv("PASSWORD_HASH")); err != nil {
+		return Config{}, fmt.Errorf("PASSWORD_HASH: %w", err)
+	}
+	if cfg.SigningKeys, err = ParseSigningKeys(os.Getenv("JWT_SIGNING_KEYS")); err != nil {
+		return Config{}, fmt.Errorf("JWT_SIGNING_KEYS: %w", err)
+	}
+	for _, d := range []struct {
+		key string
+		dst *time.Duration
+	}{
+		{"SESSION_TTL", &cfg.SessionTTL},
+		{"ACCESS_TOKEN_TTL", &cfg.AccessTokenTTL},
+		{"IDEMPOTENCY_TTL", &cfg.IdempotencyTTL},
+		{"CART_RESERVATION_TTL", &cfg.CartReservationTTL},
+		{"SEARCH_REFRESH_INTERVAL", &cfg.SearchRefreshInterval},
+	} {
+		if *d.dst, err = EnvDuration(d.key); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if cfg.Currency, err = CurrencyFromEnv(); err != nil {
+		return Config{}, err
+	}
+	if cfg.Pricing.TaxRate, err = envRate("TAX_RATE"); err != nil {
+		return Config{}, err
+	}
+	if cfg.Pricing.ShippingFee, err = envMoney("SHIPPING_FEE", cfg.Currency); err != nil {
+		return Config{}, err
+	}
+	if cfg.Pricing.FreeShippingOver, err = envMoney("FREE_SHIPPING_OVER", cfg.Currency); err != nil {
+		return Config{}, err
+	}
+
+	if v := os.Getenv("MAX_IMAGE_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return Config{}, fmt.Errorf("MAX_IMAGE_BYTES: want a positive whole number, got %q", v)
+		}
+		cfg.MaxImageBytes = n
+	}
+	return cfg, nil
+}
+
+// CurrencyFromEnv returns CURRENCY upper-cased, or DefaultCurrency if it is
+// unset. Migrations need it before the rest of the configuration.
+func CurrencyFromEnv() (string, error) {
+	v := os.Getenv("CURRENCY")
+	if v == "" {
+		return DefaultCurrency, nil
+	}
+	code, ok := currencyCode(v)
+	if !ok {
+		return "", fmt.Errorf("CURRENCY: want an ISO 4217 code such as EUR, got %q", v)
+	}
+	return code, nil
+}
+
+// S3ConfigFromEnv reads the bucket image uploads go to from the S3_*
+// variables.
+func S3ConfigFromEnv() media.S3Config {
+	return media.S3Config{
+		Endpoint:        os.Getenv("S3_ENDPOINT"),
+		Region:          os.Getenv("S3_REGION"),
+		Bucket:          os.Getenv("S3_BUCKET"),
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		PublicURL:       os.Getenv("S3_PUBLIC_URL"),
+	}
+}
+
+// EnvDuration parses a positive duration such as 30m or 12h. Unset means
+// zero.
+func EnvDuration(key string) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s: want a positive duration like 30m or 12h, got %q", key, v)
+	}
+	return d, nil
+}
+
+// envRate parses a non-negative decimal rate such as 0.08 exactly. Unset
+// means nil, i.e. zero.
+func envRate(key string) (*big.Rat, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil, nil
+	}
+	r, err := money.ParseRate(v)
+	if err != nil || r.Sign() < 0 {
+		return nil, fmt.Errorf("%s: want a non-negative number, got %q", key, v)
+	}
+	return r, nil
+}
+
+// envMoney parses a non-negative amount of currency such as 4.99. Unset
+// means zero.
+func envMoney(key, currency string) (money.Money, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return money.New(0, currency), nil
+	}
+	m, err := money.Parse(v, currency)
+	if err != nil || m.IsNegative() {
+		return money.Money{}, fmt.Errorf("%s: want a non-negative amount, got %q", key, v)
+	}
+	return m, nil
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"fullstack-shopping-cart/money"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	for key, value := range map[string]string{
+		"CORS_ALLOW_ORIGIN":       "https://shop.example.com",
+		"PASSWORD_HASH":           "bcrypt",
+		"SESSION_TTL":             "48h",
+		"ACCESS_TOKEN_TTL":        "5m",
+		"IDEMPOTENCY_TTL":         "1h",
+		"CART_RESERVATION_TTL":    "15m",
+		"SEARCH_REFRESH_INTERVAL": "30s",
+		"CURRENCY":                "eur",
+		"TAX_RATE":                "0.2",
+		"SHIPPING_FEE":            "4.99",
+		"FREE_SHIPPING_OVER":      "50",
+		"MAX_IMAGE_BYTES":         "1000",
+	} {
+		t.Setenv(key, value)
+	}
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.PasswordHasher.(BcryptHasher); !ok {
+		t.Errorf("PasswordHasher = %T; want BcryptHasher", cfg.PasswordHasher)
+	}
+	if cfg.AllowOrigin != "https://shop.example.com" || cfg.Currency != "EUR" || cfg.MaxImageBytes != 1000 {
+		t.Errorf("AllowOrigin, Currency, MaxImageBytes = %q, %q, %d", cfg.AllowOrigin, cfg.Currency, cfg.MaxImageBytes)
+	}
+	if cfg.SessionTTL != 48*time.Hour || cfg.AccessTokenTTL != 5*time.Minute ||
+		cfg.IdempotencyTTL != time.Hour || cfg.CartReservationTTL != 15*time.Minute ||
+		cfg.SearchRefreshInterval != 30*time.Second {
+		t.Errorf("durations = %v, %v, %v, %v, %v", cfg.SessionTTL, cfg.AccessTokenTTL, cfg.IdempotencyTTL,
+			cfg.CartReservationTTL, cfg.SearchRefreshInterval)
+	}
+	if cfg.Pricing.TaxRate.RatString() != "1/5" || cfg.Pricing.ShippingFee != money.New(499, "EUR") ||
+		cfg.Pricing.FreeShippingOver != money.New(5000, "EUR") {
+		t.Errorf("Pricing = %v, %v, %v", cfg.Pricing.TaxRate, cfg.Pricing.ShippingFee, cfg.Pricing.FreeShippingOver)
+	}
+}
+
+func TestConfigFromEnvDefaults(t *testing.T) {
+	for _, key := range []string{"CORS_ALLOW_ORIGIN", "PASSWORD_HASH", "JWT_SIGNING_KEYS", "SESSION_TTL", "CURRENCY", "SHIPPING_FEE", "MAX_IMAGE_BYTES"} {
+		t.Setenv(key, "")
+	}
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AllowOrigin != "*" || cfg.Currency != DefaultCurrency || cfg.SessionTTL != 0 || cfg.MaxImageBytes != 0 ||
+		len(cfg.SigningKeys) != 0 || cfg.Pricing.ShippingFee != money.New(0, DefaultCurrency) {
+		t.Errorf("defaults = %+v", cfg)
+	}
+	if _, ok := cfg.PasswordHasher.(Argon2idHasher); !ok {
+		t.Errorf("PasswordHasher = %T; want Argon2idHasher", cfg.PasswordHasher)
+	}
+}
+
+func TestConfigFromEnvRejectsInvalid(t *testing.T) {
+	tests := []struct{ key, value string }{
+		{"PASSWORD_HASH", "md5"},
+		{"JWT_SIGNING_KEYS", "nokind"},
+		{"SESSION_TTL", "forever"},
+		{"ACCESS_TOKEN_TTL", "-5m"},
+		{"IDEMPOTENCY_TTL", "0s"},
+		{"CART_RESERVATION_TTL", "15"},
+		{"CURRENCY", "euro"},
+		{"TAX_RATE", "-0.1"},
+		{"SHIPPING_FEE", "free"},
+		{"FREE_SHIPPING_OVER", "1/2"},
+		{"MAX_IMAGE_BYTES", "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			if _, err := ConfigFromEnv(); err == nil || !strings.Contains(err.Error(), tt.key) {
+				t.Errorf("ConfigFromEnv with %s=%q = %v; want an error naming it", tt.key, tt.value, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fullstack-shopping-cart/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateExchangeRateRequest adds a rate for Currency. Rate is how many units
+// of Currency one unit of the shop's currency buys. EffectiveFrom defaults to
+// now; a later time schedules the rate.
+type CreateExchangeRateRequest struct {
+	Currency      string        `json:"currency" binding:"required"`
+	Rate          money.Decimal `json:"rate" binding:"required"`
+	EffectiveFrom *time.Time    `json:"effectiveFrom"`
+}
+
+// listExchangeRates returns every rate, past, current and scheduled,
+// optionally only those of the currency query parameter.
+func (h *handler) listExchangeRates(c *gin.Context) {
+	currency := c.Query("currency")
+	if currency != "" {
+		var ok bool
+		if currency, ok = currencyCode(currency); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid currency"})
+			return
+		}
+	}
+	rates, err := h.store.ExchangeRates().List(c.Request.Context(), currency)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rates)
+}
+
+// createExchangeRate adds a rate. Rates are never edited: a new rate
+// replaces the current one from its EffectiveFrom on, and a mistaken one is
+// deleted.
+func (h *handler) createExchangeRate(c *gin.Context) {
+	var req CreateExchangeRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	currency, ok := currencyCode(req.Currency)
+	if !ok || currency == h.currency {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currency must be an ISO 4217 code other than " + h.currency})
+		return
+	}
+	r, err := money.ParseRate(string(req.Rate))
+	if err != nil || r.Sign() <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rate must be a positive decimal"})
+		return
+	}
+
+	rate := &ExchangeRate{Currency: currency, Rate: string(req.Rate), EffectiveFrom: time.Now()}
+	if req.EffectiveFrom != nil {
+		rate.EffectiveFrom = *req.EffectiveFrom
+	}
+	err = h.store.ExchangeRates().Create(c.Request.Context(), rate)
+	if errors.Is(err, ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": currency + " already has a rate taking effect then"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, rate)
+}
+
+// deleteExchangeRate removes a rate. Orders keep the rate they were placed
+// at.
+func (h *handler) deleteExchangeRate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exchange rate id"})
+		return
+	}
+	err = h.store.ExchangeRates().Delete(c.Request.Context(), uint(id))
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exchange rate not found"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
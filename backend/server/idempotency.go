@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultIdempotencyTTL is how long a response is kept for replay when
+// Config.IdempotencyTTL is zero.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header.
+const maxIdempotencyKeyLength = 255
+
+// maxIdempotentBodyBytes bounds the body of a request with an
+// Idempotency-Key, which is read into memory to be hashed. The cart and
+// order requests it guards are far smaller.
+const maxIdempotentBodyBytes = 1 << 20
+
+// idempotent makes a handler safe to retry. When a request carries an
+// Idempotency-Key header, the first response for that user and key is stored
+// for ttl and replayed for later requests with the same method, path, query,
+// CurrencyHeader and body. Reusing a key with a different request is rejected
+// with 422, and a retry that arrives while the first request is still running
+// gets 409.
+// Server errors and panics are not stored so the request can be retried. It
+// must run after AuthMiddleware.
+func idempotent(store Store, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+		user := c.MustGet("user").(*User)
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodyBytes))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body is too large"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		// The currency header changes what an order costs as much as the
+		// query parameter does.
+		currency := strings.ToUpper(strings.TrimSpace(c.GetHeader(CurrencyHeader)))
+		h := sha256.New()
+		io.WriteString(h, c.Request.Method+" "+c.Request.URL.RequestURI()+"\n"+currency+"\n")
+		h.Write(body)
+		requestHash := hex.EncodeToString(h.Sum(nil))
+
+		ctx := c.Request.Context()
+		now := time.Now()
+		record := &IdempotencyRecord{
+			UserID:      user.ID,
+			Key:         key,
+			RequestHash: requestHash,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(ttl),
+		}
+		err = store.Idempotency().Reserve(ctx, record)
+		if errors.Is(err, ErrConflict) {
+			existing, getErr := store.Idempotency().Get(ctx, user.ID, key)
+			switch {
+			case getErr != nil:
+				err = getErr
+			case existing.ExpiresAt.Before(now):
+				// Expired but not swept yet: start over with a fresh record.
+				err = store.Idempotency().Delete(ctx, existing.ID)
+				if err == nil || errors.Is(err, ErrNotFound) {
+					err = store.Idempotency().Reserve(ctx, record)
+				}
+			default:
+				replayIdempotent(c, existing, requestHash)
+				return
+			}
+		}
+		if errors.Is(err, ErrConflict) {
+			// Lost a race with a concurrent request using the same key.
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is in progress"})
+			return
+		}
+		if err != nil {
+			internalError(c, err)
+			c.Abort()
+			return
+		}
+
+		// Store the outcome even if the client has gone away.
+		ctx = context.WithoutCancel(ctx)
+		// Until the response is stored the record only marks the key as in
+		// progress. Remove it if the handler fails, panics or its response
+		// cannot be stored, so that the request can be retried.
+		stored := false
+		defer func() {
+			if stored {
+				return
+			}
+			if err := store.Idempotency().Delete(ctx, record.ID); err != nil {
+				log.Printf("idempotency key %q for user %d: %v", key, user.ID, err)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if recorder.Status() < http.StatusInternalServerError {
+			err = store.Idempotency().Complete(ctx, record.ID, recorder.Status(), recorder.body.String())
+			if err != nil {
+				log.Printf("idempotency key %q for user %d: %v", key, user.ID, err)
+			}
+			stored = err == nil
+		}
+	}
+}
+
+// replayIdempotent answers a repeated request from its stored record.
+func replayIdempotent(c *gin.Context, record *IdempotencyRecord, requestHash string) {
+	switch {
+	case record.RequestHash != requestHash:
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+	case record.StatusCode == 0:
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is in progress"})
+	default:
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(record.StatusCode, "application/json; charset=utf-8", []byte(record.ResponseBody))
+		c.Abort()
+	}
+}
+
+// responseRecorder keeps a copy of everything written to the response.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
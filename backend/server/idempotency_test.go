@@ -0,0 +1,123 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newIdempotentRouter serves POST /orders through idempotent for a fixed
+// user, answering with handle.
+func newIdempotentRouter(store Store, handle gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(gin.RecoveryWithWriter(io.Discard))
+	r.POST("/orders", func(c *gin.Context) {
+		c.Set("user", &User{ID: 1})
+	}, idempotent(store, DefaultIdempotencyTTL), handle)
+	return r
+}
+
+// postIdempotent posts body to target with an Idempotency-Key, and with a
+// CurrencyHeader unless currency is empty.
+func postIdempotent(r http.Handler, target, key, body, currency string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", key)
+	if currency != "" {
+		req.Header.Set(CurrencyHeader, currency)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotentReplaysSameRequest(t *testing.T) {
+	calls := 0
+	r := newIdempotentRouter(NewMemoryStore(), func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusCreated, gin.H{"call": calls})
+	})
+
+	first := postIdempotent(r, "/orders", "k1", `{"a":1}`, "EUR")
+	second := postIdempotent(r, "/orders", "k1", `{"a":1}`, "eur")
+	if first.Code != http.StatusCreated || second.Code != http.StatusCreated {
+		t.Fatalf("status = %d, %d; want 201, 201", first.Code, second.Code)
+	}
+	if second.Body.String() != first.Body.String() || second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("second response = %q (replayed %q); want replay of %q",
+			second.Body, second.Header().Get("Idempotent-Replayed"), first.Body)
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times; want 1", calls)
+	}
+}
+
+func TestIdempotentRejectsDifferentRequest(t *testing.T) {
+	tests := []struct {
+		name                   string
+		target, body, currency string
+	}{
+		{"body", "/orders?currency=EUR", `{"a":2}`, ""},
+		{"query", "/orders?currency=USD", `{"a":1}`, ""},
+		{"no query", "/orders", `{"a":1}`, ""},
+		{"currency header", "/orders?currency=EUR", `{"a":1}`, "GBP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newIdempotentRouter(NewMemoryStore(), func(c *gin.Context) {
+				c.JSON(http.StatusCreated, gin.H{})
+			})
+			if w := postIdempotent(r, "/orders?currency=EUR", "k1", `{"a":1}`, ""); w.Code != http.StatusCreated {
+				t.Fatalf("first status = %d; want 201", w.Code)
+			}
+			if w := postIdempotent(r, tt.target, "k1", tt.body, tt.currency); w.Code != http.StatusUnprocessableEntity {
+				t.Errorf("status = %d; want 422", w.Code)
+			}
+		})
+	}
+}
+
+func TestIdempotentRejectsLargeBody(t *testing.T) {
+	r := newIdempotentRouter(NewMemoryStore(), func(c *gin.Context) {
+		t.Error("handler ran for an oversized body")
+	})
+	body := `{"a":"` + strings.Repeat("x", maxIdempotentBodyBytes) + `"}`
+	if w := postIdempotent(r, "/orders", "k1", body, ""); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d; want 413", w.Code)
+	}
+}
+
+func TestIdempotentForgetsFailedRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		fail gin.HandlerFunc
+	}{
+		{"server error", func(c *gin.Context) { c.JSON(http.StatusInternalServerError, gin.H{}) }},
+		{"panic", func(c *gin.Context) { panic("boom") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failing := true
+			r := newIdempotentRouter(NewMemoryStore(), func(c *gin.Context) {
+				if failing {
+					tt.fail(c)
+					return
+				}
+				c.JSON(http.StatusCreated, gin.H{})
+			})
+			if w := postIdempotent(r, "/orders", "k1", `{}`, ""); w.Code != http.StatusInternalServerError {
+				t.Fatalf("first status = %d; want 500", w.Code)
+			}
+			failing = false
+			w := postIdempotent(r, "/orders", "k1", `{}`, "")
+			if w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" {
+				t.Errorf("retry status = %d (replayed %q); want a fresh 201", w.Code, w.Header().Get("Idempotent-Replayed"))
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"fullstack-shopping-cart/media"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultMaxImageBytes is used when Config.MaxImageBytes is zero.
+const DefaultMaxImageBytes = 10 << 20
+
+// maxImagePixels caps the width times height of an uploaded image, which
+// decoding needs four bytes of memory for each of.
+const maxImagePixels = 50_000_000
+
+// thumbnailSizes are the thumbnails made of every item image, by name, as
+// the length in pixels of their longer side. Images smaller than that are
+// not scaled up.
+var thumbnailSizes = []struct {
+	name string
+	side int
+}{
+	{"small", 160},
+	{"medium", 480},
+	{"large", 1024},
+}
+
+// thumbnailKey returns the storage key of the thumbnail called name of the
+// image of contentType stored under key, such as items/3/ab12-small.png for
+// the WebP image items/3/ab12.webp.
+func thumbnailKey(key, contentType, name string) string {
+	base := strings.TrimSuffix(key, media.Extension(contentType))
+	return base + "-" + name + media.Extension(media.ThumbnailType(contentType))
+}
+
+// uploadItemImage stores the image sent as the "image" field of a
+// multipart form and adds it to the images of the item named by :id, last.
+// It becomes the item's primary image if the form has primary=true or the
+// item has no other images. The file's type is worked out from its
+// contents; JPEG, PNG, GIF and WebP images are accepted.
+func (h *handler) uploadItemImage(c *gin.Context) {
+	if h.media == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Image uploads are not configured"})
+		return
+	}
+	item, ok := h.loadItem(c)
+	if !ok {
+		return
+	}
+	if item.ArchivedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Item is archived"})
+		return
+	}
+
+	tooLarge := fmt.Sprintf("Images can be at most %d bytes", h.maxImageBytes)
+	// Leave room for the multipart headers around the file.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxImageBytes+64<<10)
+	header, err := c.FormFile("image")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": tooLarge})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": `Send the image as the "image" field of a multipart/form-data body`})
+		return
+	}
+	if header.Size > h.maxImageBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": tooLarge})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	img, contentType, err := media.DecodeImage(data, maxImagePixels)
+	if errors.Is(err, media.ErrImageTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Images can have at most %d pixels", maxImagePixels)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Upload a JPEG, PNG, GIF or WebP image"})
+		return
+	}
+	key, err := newImageKey(item.ID, contentType)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	b := img.Bounds()
+	record := &ItemImage{
+		ItemID:      item.ID,
+		Primary:     c.PostForm("primary") == "true",
+		Key:         key,
+		ContentType: contentType,
+		Width:       b.Dx(),
+		Height:      b.Dy(),
+		Size:        int64(len(data)),
+	}
+
+	ctx := c.Request.Context()
+	if err := h.putImageFiles(ctx, record, img, data); err != nil {
+		internalError(c, err)
+		return
+	}
+	err = h.store.ItemImages().Create(ctx, record)
+	if err != nil {
+		h.deleteImageFiles(ctx, record)
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	case errors.Is(err, ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "Images of the item were changed at the same time; try again"})
+		return
+	default:
+		internalError(c, err)
+		return
+	}
+	h.setImageURL(record)
+	c.JSON(http.StatusCreated, record)
+}
+
+// ArrangeImagesRequest puts an item's images in order and picks its
+// primary one. ImageIDs must list each of the item's images once.
+// PrimaryID keeps the current primary image if it is zero.
+type ArrangeImagesRequest struct {
+	ImageIDs  []uint `json:"imageIds" binding:"required"`
+	PrimaryID uint   `json:"primaryId"`
+}
+
+// arrangeItemImages orders the images of the item named by :id and sets
+// its primary image, and responds with the images.
+func (h *handler) arrangeItemImages(c *gin.Context) {
+	var req ArrangeImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	item, ok := h.loadItem(c)
+	if !ok {
+		return
+	}
+	if item.ArchivedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Item is archived"})
+		return
+	}
+	listed := len(req.ImageIDs) == len(item.Images)
+	for _, img := range item.Images {
+		listed = listed && slices.Contains(req.ImageIDs, img.ID)
+		if req.PrimaryID == 0 && img.Primary {
+			req.PrimaryID = img.ID
+		}
+	}
+	if !listed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "imageIds must list each of the item's images once"})
+		return
+	}
+	if !slices.Contains(req.ImageIDs, req.PrimaryID) && len(req.ImageIDs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "primaryId must be one of the item's images"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	err := h.store.ItemImages().Arrange(ctx, item.ID, req.ImageIDs, req.PrimaryID)
+	if errors.Is(err, ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Images of the item were changed by someone else; fetch it and try again"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	item, err = h.store.Items().Get(ctx, item.ID)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	h.setImageURLs(item.Images)
+	c.JSON(http.StatusOK, item.Images)
+}
+
+// deleteItemImage removes one of an item's images and its files. If it
+// was the primary image, the next one becomes primary.
+func (h *handler) deleteItemImage(c *gin.Context) {
+	item, ok := h.loadItem(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("imageId"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image id"})
+		return
+	}
+	i := slices.IndexFunc(item.Images, func(img ItemImage) bool { return img.ID == uint(id) })
+	if i < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+	record := &item.Images[i]
+	err = h.store.ItemImages().Delete(c.Request.Context(), record.ID)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if h.media != nil {
+		h.deleteImageFiles(c.Request.Context(), record)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// newImageKey returns a fresh storage key for an image of the item. Keys
+// are random so that a new image never reuses the URL of an old one that
+// browsers and CDNs may have cached.
+func newImageKey(itemID uint, contentType string) (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("items/%d/%s%s", itemID, hex.EncodeToString(b), media.Extension(contentType)), nil
+}
+
+// putImageFiles stores the uploaded file of record, whose contents are
+// data and decode to img, and its thumbnails. If any of them cannot be
+// stored, those already stored are deleted again.
+func (h *handler) putImageFiles(ctx context.Context, record *ItemImage, img image.Image, data []byte) error {
+	if err := h.media.Put(ctx, record.Key, record.ContentType, data); err != nil {
+		return err
+	}
+	thumbType := media.ThumbnailType(record.ContentType)
+	for _, size := range thumbnailSizes {
+		thumb, err := media.Encode(media.Fit(img, size.side), thumbType)
+		if err == nil {
+			err = h.media.Put(ctx, thumbnailKey(record.Key, record.ContentType, size.name), thumbType, thumb)
+		}
+		if err != nil {
+			h.deleteImageFiles(ctx, record)
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteImageFiles removes the files of record from media storage. Files
+// that cannot be removed are only logged: they are unreferenced and do no
+// harm beyond the space they take.
+func (h *handler) deleteImageFiles(ctx context.Context, record *ItemImage) {
+	keys := []string{record.Key}
+	for _, size := range thumbnailSizes {
+		keys = append(keys, thumbnailKey(record.Key, record.ContentType, size.name))
+	}
+	for _, key := range keys {
+		if err := h.media.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete image file %s: %v", key, err)
+		}
+	}
+}
+
+// setImageURL fills in where clients fetch img and its thumbnails from.
+// They stay empty when no media storage is configured.
+func (h *handler) setImageURL(img *ItemImage) {
+	if h.media == nil {
+		return
+	}
+	img.URL = h.media.URL(img.Key)
+	img.Thumbnails = make(map[string]string, len(thumbnailSizes))
+	for _, size := range thumbnailSizes {
+		img.Thumbnails[size.name] = h.media.URL(thumbnailKey(img.Key, img.ContentType, size.name))
+	}
+}
+
+// setImageURLs calls setImageURL for each of images.
+func (h *handler) setImageURLs(images []ItemImage) {
+	for i := range images {
+		h.setImageURL(&images[i])
+	}
+}
+
+// setItemImageURLs calls setImageURL for the images of each of items.
+func (h *handler) setItemImageURLs(items []Item) {
+	for i := range items {
+		h.setImageURLs(items[i].Images)
+	}
+}
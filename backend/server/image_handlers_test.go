@@ -0,0 +1,203 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"fullstack-shopping-cart/media"
+	"fullstack-shopping-cart/money"
+)
+
+// imageTestServer serves uploads into a local media directory as a staff
+// user, whose access token it returns, for an item it creates.
+func imageTestServer(t *testing.T, maxImageBytes int64) (s *testServer, dir, token string, item *Item) {
+	t.Helper()
+	dir = t.TempDir()
+	storage, err := media.NewLocal(dir, "/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = newTestServer(t, Config{Media: storage, MaxImageBytes: maxImageBytes})
+	s.createUser("staff", RoleStaff)
+	token, _ = s.login("staff")
+	item = &Item{Name: "Lamp", Price: money.New(1000, DefaultCurrency)}
+	if err := s.store.Items().Create(context.Background(), item); err != nil {
+		t.Fatal(err)
+	}
+	return s, dir, token, item
+}
+
+// pngImage encodes a w by h PNG.
+func pngImage(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// upload posts data as the "image" field of a multipart form, claiming the
+// given content type, with the other form fields.
+func (s *testServer) upload(token string, itemID uint, contentType string, data []byte, fields ...string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for i := 0; i+1 < len(fields); i += 2 {
+		form.WriteField(fields[i], fields[i+1])
+	}
+	header := make(map[string][]string)
+	header["Content-Disposition"] = []string{`form-data; name="image"; filename="upload"`}
+	header["Content-Type"] = []string{contentType}
+	part, err := form.CreatePart(header)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/items/%d/images", itemID), &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return s.send(req, token)
+}
+
+// mediaFile returns the path in dir of the file served at url.
+func mediaFile(dir, url string) string {
+	return filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(url, "/media/")))
+}
+
+func TestUploadItemImageRejectsContent(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		data        []byte
+		maxBytes    int64
+		want        int
+	}{
+		{"text claiming to be PNG", "image/png", []byte("just some text, honest"), 0, http.StatusUnsupportedMediaType},
+		{"HTML claiming to be JPEG", "image/jpeg", []byte("<html><script>alert(1)</script></html>"), 0, http.StatusUnsupportedMediaType},
+		{"truncated PNG", "image/png", pngImage(t, 20, 20)[:40], 0, http.StatusUnsupportedMediaType},
+		{"file over the limit", "image/png", append(pngImage(t, 20, 20), make([]byte, 2000)...), 1000, http.StatusRequestEntityTooLarge},
+		{"body over the limit", "image/png", make([]byte, 100<<10), 1000, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, dir, token, item := imageTestServer(t, tt.maxBytes)
+			if w := s.upload(token, item.ID, tt.contentType, tt.data); w.Code != tt.want {
+				t.Errorf("status = %d; want %d; body %s", w.Code, tt.want, w.Body)
+			}
+			if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) > 0 {
+				t.Errorf("rejected upload left files %v", files)
+			}
+		})
+	}
+}
+
+func TestUploadItemImageThumbnails(t *testing.T) {
+	tests := []struct {
+		name   string
+		w, h   int
+		thumbs map[string]image.Point
+	}{
+		{"landscape", 1200, 800, map[string]image.Point{
+			"small": {160, 106}, "medium": {480, 320}, "large": {1024, 682},
+		}},
+		{"portrait", 300, 600, map[string]image.Point{
+			"small": {80, 160}, "medium": {240, 480}, "large": {300, 600},
+		}},
+		{"small", 100, 50, map[string]image.Point{
+			"small": {100, 50}, "medium": {100, 50}, "large": {100, 50},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, dir, token, item := imageTestServer(t, 0)
+			data := pngImage(t, tt.w, tt.h)
+			var img ItemImage
+			// The claimed type is ignored in favour of the contents.
+			s.decode(s.upload(token, item.ID, "application/octet-stream", data), http.StatusCreated, &img)
+			if img.ContentType != "image/png" || img.Width != tt.w || img.Height != tt.h || img.Size != int64(len(data)) {
+				t.Errorf("image = %s %dx%d, %d bytes; want image/png %dx%d, %d bytes",
+					img.ContentType, img.Width, img.Height, img.Size, tt.w, tt.h, len(data))
+			}
+			if _, err := os.Stat(mediaFile(dir, img.URL)); err != nil {
+				t.Errorf("original not stored: %v", err)
+			}
+			if len(img.Thumbnails) != len(tt.thumbs) {
+				t.Errorf("thumbnails = %v; want %d", img.Thumbnails, len(tt.thumbs))
+			}
+			for name, want := range tt.thumbs {
+				f, err := os.Open(mediaFile(dir, img.Thumbnails[name]))
+				if err != nil {
+					t.Errorf("%s thumbnail: %v", name, err)
+					continue
+				}
+				cfg, format, err := image.DecodeConfig(f)
+				f.Close()
+				if err != nil || format != "png" || cfg.Width != want.X || cfg.Height != want.Y {
+					t.Errorf("%s thumbnail = %s %dx%d, %v; want png %dx%d", name, format, cfg.Width, cfg.Height, err, want.X, want.Y)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteItemImageKeepsOnePrimary(t *testing.T) {
+	tests := []struct {
+		name        string
+		delete      int
+		wantPrimary int
+	}{
+		{"primary", 1, 0},
+		{"first", 0, 1},
+		{"last", 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, dir, token, item := imageTestServer(t, 0)
+			uploaded := make([]ItemImage, 3)
+			for i := range uploaded {
+				primary := fmt.Sprint(i == 1)
+				s.decode(s.upload(token, item.ID, "image/png", pngImage(t, 10+i, 10), "primary", primary), http.StatusCreated, &uploaded[i])
+			}
+			deleted := uploaded[tt.delete]
+			w := s.do(http.MethodDelete, fmt.Sprintf("/items/%d/images/%d", item.ID, deleted.ID), token, nil)
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("delete status = %d; want 204; body %s", w.Code, w.Body)
+			}
+
+			var got Item
+			s.decode(s.do(http.MethodGet, fmt.Sprintf("/items/%d", item.ID), "", nil), http.StatusOK, &got)
+			if len(got.Images) != 2 {
+				t.Fatalf("item has %d images; want 2", len(got.Images))
+			}
+			var primaries []uint
+			for i, img := range got.Images {
+				if img.Position != i {
+					t.Errorf("image %d at position %d; want %d", img.ID, img.Position, i)
+				}
+				if img.Primary {
+					primaries = append(primaries, img.ID)
+				}
+			}
+			want := uploaded[tt.wantPrimary].ID
+			if len(primaries) != 1 || primaries[0] != want {
+				t.Errorf("primary images = %v; want only %d", primaries, want)
+			}
+			for _, url := range append([]string{deleted.URL}, deleted.Thumbnails["small"], deleted.Thumbnails["large"]) {
+				if _, err := os.Stat(mediaFile(dir, url)); !os.IsNotExist(err) {
+					t.Errorf("file %s of the deleted image still there: %v", url, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,448 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"fullstack-shopping-cart/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ItemRequest struct {
+	Name        string        `json:"name" binding:"required"`
+	Description string        `json:"description"`
+	Price       money.Decimal `json:"price" binding:"required"`
+	CategoryIDs []uint        `json:"categoryIds"`
+	Options     ItemOptions   `json:"options"`
+
+	// StockQuantity is how many units are on hand, 0 if omitted.
+	StockQuantity int `json:"stockQuantity" binding:"min=0"`
+}
+
+// UpdateItemRequest replaces an item's details. Stock is changed with
+// SetStockRequest instead.
+type UpdateItemRequest struct {
+	Name        string        `json:"name" binding:"required"`
+	Description string        `json:"description"`
+	Price       money.Decimal `json:"price" binding:"required"`
+	CategoryIDs []uint        `json:"categoryIds"`
+	Options     ItemOptions   `json:"options"`
+}
+
+// PatchItemRequest changes the details that are present.
+type PatchItemRequest struct {
+	Name        *string        `json:"name" binding:"omitempty,min=1"`
+	Description *string        `json:"description"`
+	Price       *money.Decimal `json:"price"`
+	CategoryIDs *[]uint        `json:"categoryIds"`
+	Options     *ItemOptions   `json:"options"`
+}
+
+func (h *handler) createNewItem(c *gin.Context) {
+	var req ItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	price, ok := h.parsePrice(c, req.Price, h.currency)
+	if !ok {
+		return
+	}
+	categories, ok := h.loadCategories(c, req.CategoryIDs)
+	if !ok || !checkOptions(c, &req.Options) {
+		return
+	}
+
+	item := &Item{
+		Name:          req.Name,
+		Description:   req.Description,
+		Price:         price,
+		Categories:    categories,
+		Options:       req.Options,
+		Variants:      []Variant{},
+		Images:        []ItemImage{},
+		StockQuantity: req.StockQuantity,
+	}
+	if err := h.store.Items().Create(c.Request.Context(), item); err != nil {
+		internalError(c, err)
+		return
+	}
+
+	h.catalog.put(item)
+
+	c.Header("ETag", itemETag(item))
+	c.JSON(http.StatusCreated, item)
+}
+
+// fetchItem returns one item, including archived ones so that past orders
+// can still link to it, priced in the currency the request asks for.
+func (h *handler) fetchItem(c *gin.Context) {
+	p, ok := h.pricerFor(c)
+	if !ok {
+		return
+	}
+	item, ok := h.loadItem(c)
+	if !ok {
+		return
+	}
+	c.Header("ETag", itemETag(item))
+	priced := []Item{*item}
+	if !h.localize(c, p, priced) {
+		return
+	}
+	c.JSON(http.StatusOK, priced[0])
+}
+
+// replaceItem sets every detail of an item.
+func (h *handler) replaceItem(c *gin.Context) {
+	var req UpdateItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	price, ok := h.parsePrice(c, req.Price, h.currency)
+	if !ok {
+		return
+	}
+	categories, ok := h.loadCategories(c, req.CategoryIDs)
+	if !ok || !checkOptions(c, &req.Options) {
+		return
+	}
+	h.updateItem(c, func(item *Item) {
+		item.Name = req.Name
+		item.Description = req.Description
+		item.Price = price
+		item.Categories = categories
+		item.Options = req.Options
+	})
+}
+
+// patchItem sets the details of an item given in the request.
+func (h *handler) patchItem(c *gin.Context) {
+	var req PatchItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	var price money.Money
+	if req.Price != nil {
+		var ok bool
+		if price, ok = h.parsePrice(c, *req.Price, h.currency); !ok {
+			return
+		}
+	}
+	var categories []Category
+	if req.CategoryIDs != nil {
+		var ok bool
+		if categories, ok = h.loadCategories(c, *req.CategoryIDs); !ok {
+			return
+		}
+	}
+	if req.Options != nil && !checkOptions(c, req.Options) {
+		return
+	}
+	h.updateItem(c, func(item *Item) {
+		if req.Name != nil {
+			item.Name = *req.Name
+		}
+		if req.Description != nil {
+			item.Description = *req.Description
+		}
+		if req.Price != nil {
+			item.Price = price
+		}
+		if req.CategoryIDs != nil {
+			item.Categories = categories
+		}
+		if req.Options != nil {
+			item.Options = *req.Options
+		}
+	})
+}
+
+// archiveItem hides an item from the catalog and from new carts. Orders
+// that contain it are unaffected. Archiving an archived item succeeds.
+func (h *handler) archiveItem(c *gin.Context) {
+	item, ok := h.loadItem(c)
+	if !ok || !checkIfMatch(c, item) {
+		return
+	}
+	if item.ArchivedAt == nil {
+		now := time.Now()
+		item.ArchivedAt = &now
+		if !h.saveItem(c, item) {
+			return
+		}
+		h.catalog.put(item)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// updateItem applies change to the item named by :id and responds with the
+// updated item. Archived items cannot be changed, and neither can options
+// that existing variants rely on.
+func (h *handler) updateItem(c *gin.Context, change func(*Item)) {
+	item, ok := h.loadItem(c)
+	if !ok || !checkIfMatch(c, item) {
+		return
+	}
+	if item.ArchivedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Item is archived"})
+		return
+	}
+	change(item)
+	var mismatched []string
+	for _, v := range item.Variants {
+		if item.Options.matches(v.Options) != "" {
+			mismatched = append(mismatched, v.SKU)
+		}
+	}
+	if len(mismatched) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Some variants do not fit the new options; change or delete them first",
+			"skus":  mismatched,
+		})
+		return
+	}
+	if !h.saveItem(c, item) {
+		return
+	}
+	h.catalog.put(item)
+	h.setImageURLs(item.Images)
+	c.Header("ETag", itemETag(item))
+	c.JSON(http.StatusOK, item)
+}
+
+// saveItem stores an item loaded by loadItem. If it was changed by someone
+// else since, it responds 412 when the client sent If-Match and 409
+// otherwise, and returns false.
+func (h *handler) saveItem(c *gin.Context, item *Item) bool {
+	err := h.store.Items().Update(c.Request.Context(), item)
+	if errors.Is(err, ErrConflict) {
+		status := http.StatusConflict
+		if c.GetHeader("If-Match") != "" {
+			status = http.StatusPreconditionFailed
+		}
+		c.JSON(status, gin.H{"error": "Item was changed by someone else; fetch it and try again"})
+		return false
+	}
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return false
+	}
+	if err != nil {
+		internalError(c, err)
+		return false
+	}
+	return true
+}
+
+// checkOptions tidies up options from a request, responding 400 and
+// returning false if they are invalid. Missing options become no options.
+func checkOptions(c *gin.Context, options *ItemOptions) bool {
+	if *options == nil {
+		*options = ItemOptions{}
+	}
+	if problem := options.check(); problem != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": problem})
+		return false
+	}
+	return true
+}
+
+// parsePrice converts a price from a request into currency, responding 400
+// and returning false if it is not a non-negative amount.
+func (h *handler) parsePrice(c *gin.Context, d money.Decimal, currency string) (money.Money, bool) {
+	price, err := money.Parse(string(d), currency)
+	if err != nil || price.IsNegative() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price must be a non-negative amount such as \"12.34\""})
+		return money.Money{}, false
+	}
+	return price, true
+}
+
+// loadItem fetches the item named by the :id parameter.
+func (h *handler) loadItem(c *gin.Context) (*Item, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item id"})
+		return nil, false
+	}
+	item, err := h.store.Items().Get(c.Request.Context(), uint(id))
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return nil, false
+	}
+	if err != nil {
+		internalError(c, err)
+		return nil, false
+	}
+	return item, true
+}
+
+// itemETag is the entity tag of an item's current version. Stock levels
+// change with every order and are not part of it.
+func itemETag(item *Item) string {
+	return `"` + strconv.Itoa(item.Version) + `"`
+}
+
+// checkIfMatch responds 412 and returns false if the request has an
+// If-Match header that does not list the item's current ETag.
+func checkIfMatch(c *gin.Context, item *Item) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return true
+	}
+	etag := itemETag(item)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	c.Header("ETag", etag)
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Item was changed by someone else; fetch it and try again"})
+	return false
+}
+
+// SetStockRequest replaces an item's stock quantity.
+type SetStockRequest struct {
+	StockQuantity *int `json:"stockQuantity" binding:"required,min=0"`
+}
+
+// setItemStock sets how many units of an item are in stock.
+func (h *handler) setItemStock(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item id"})
+		return
+	}
+	var req SetStockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	err = h.store.Items().SetStock(ctx, uint(id), *req.StockQuantity)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	item, err := h.store.Items().Get(ctx, uint(id))
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	h.setImageURLs(item.Images)
+
+	c.JSON(http.StatusOK, item)
+}
+
+// ItemPriceRequest sets an item's price in one currency.
+type ItemPriceRequest struct {
+	Price money.Decimal `json:"price" binding:"required"`
+}
+
+// listItemPrices returns an item's own prices in other currencies, keyed by
+// currency.
+func (h *handler) listItemPrices(c *gin.Context) {
+	item, ok := h.loadItem(c)
+	if !ok {
+		return
+	}
+	h.respondItemPrices(c, item.ID)
+}
+
+// setItemPrice sets an item's price in the :currency parameter, which
+// then takes precedence over converting its price at the exchange rate.
+func (h *handler) setItemPrice(c *gin.Context) {
+	currency, ok := h.priceListCurrency(c)
+	if !ok {
+		return
+	}
+	var req ItemPriceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	price, ok := h.parsePrice(c, req.Price, currency)
+	if !ok {
+		return
+	}
+	item, ok := h.loadItem(c)
+	if !ok {
+		return
+	}
+
+	err := h.store.Items().SetPrice(c.Request.Context(), item.ID, price)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	h.respondItemPrices(c, item.ID)
+}
+
+// deleteItemPrice removes an item's price in the :currency parameter, so
+// that its price is converted at the exchange rate again.
+func (h *handler) deleteItemPrice(c *gin.Context) {
+	currency, ok := h.priceListCurrency(c)
+	if !ok {
+		return
+	}
+	item, ok := h.loadItem(c)
+	if !ok {
+		return
+	}
+	err := h.store.Items().DeletePrice(c.Request.Context(), item.ID, currency)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item has no price in " + currency})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// priceListCurrency parses the :currency parameter, responding 400 if it is
+// invalid or the shop's own currency, which is set on the item itself.
+func (h *handler) priceListCurrency(c *gin.Context) (string, bool) {
+	currency, ok := currencyCode(c.Param("currency"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid currency"})
+		return "", false
+	}
+	if currency == h.currency {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set the price in " + currency + " on the item itself"})
+		return "", false
+	}
+	return currency, true
+}
+
+// respondItemPrices responds with the item's own prices keyed by currency.
+func (h *handler) respondItemPrices(c *gin.Context, itemID uint) {
+	list, err := h.store.Items().Prices(c.Request.Context(), itemID)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	prices := make(map[string]money.Money, len(list))
+	for _, p := range list {
+		prices[p.Price.Currency] = p.Price
+	}
+	c.JSON(http.StatusOK, prices)
+}
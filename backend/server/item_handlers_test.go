@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// withIfMatch sends a JSON request with an If-Match header unless ifMatch
+// is empty.
+func (s *testServer) withIfMatch(method, target, token, ifMatch string, body any) *httptest.ResponseRecorder {
+	s.t.Helper()
+	b, err := json.Marshal(body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, target, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	return s.send(req, token)
+}
+
+func TestItemIfMatch(t *testing.T) {
+	s := newTestServer(t, Config{})
+	s.createUser("staff", RoleStaff)
+	token, _ := s.login("staff")
+	w := s.do(http.MethodPost, "/items", token, map[string]any{"name": "Lamp", "price": "10.00"})
+	var item Item
+	s.decode(w, http.StatusCreated, &item)
+	path := fmt.Sprintf("/items/%d", item.ID)
+	if etag := w.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf("ETag = %s; want \"1\"", etag)
+	}
+
+	replace := map[string]any{"name": "Desk lamp", "price": "12.00"}
+	steps := []struct {
+		name     string
+		method   string
+		ifMatch  string
+		want     int
+		wantETag string
+	}{
+		{"current", http.MethodPatch, `"1"`, http.StatusOK, `"2"`},
+		{"stale", http.MethodPatch, `"1"`, http.StatusPreconditionFailed, `"2"`},
+		{"stale replace", http.MethodPut, `"1"`, http.StatusPreconditionFailed, `"2"`},
+		{"one of several", http.MethodPut, `"1", "2"`, http.StatusOK, `"3"`},
+		{"any version", http.MethodPatch, `*`, http.StatusOK, `"4"`},
+		{"without If-Match", http.MethodPatch, "", http.StatusOK, `"5"`},
+		{"stale archive", http.MethodDelete, `"4"`, http.StatusPreconditionFailed, `"5"`},
+		{"archive", http.MethodDelete, `"5"`, http.StatusNoContent, ""},
+	}
+	for _, step := range steps {
+		w := s.withIfMatch(step.method, path, token, step.ifMatch, replace)
+		if w.Code != step.want {
+			t.Fatalf("%s: status = %d; want %d; body %s", step.name, w.Code, step.want, w.Body)
+		}
+		if etag := w.Header().Get("ETag"); etag != step.wantETag {
+			t.Errorf("%s: ETag = %s; want %s", step.name, etag, step.wantETag)
+		}
+	}
+
+	// Only the requests that passed the check made a new version.
+	w = s.do(http.MethodGet, path, "", nil)
+	var got Item
+	s.decode(w, http.StatusOK, &got)
+	if etag := w.Header().Get("ETag"); etag != `"6"` || got.ArchivedAt == nil {
+		t.Errorf("archived item has ETag %s, archived %v; want \"6\", archived", etag, got.ArchivedAt)
+	}
+}
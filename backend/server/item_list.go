@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"fullstack-shopping-cart/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Page sizes for GET /items.
+const (
+	defaultItemPageSize = 20
+	maxItemPageSize     = 100
+)
+
+// ItemPage is one page of a catalog listing, priced in Currency.
+// NextCursor is empty on the last page.
+type ItemPage struct {
+	Items      []Item `json:"items"`
+	Currency   string `json:"currency"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// itemCursor is the position after the last item of a page. It records the
+// sort it was made for, since it means nothing under a different one.
+type itemCursor struct {
+	SortBy    string    `json:"s"`
+	Desc      bool      `json:"d,omitempty"`
+	ID        uint      `json:"i"`
+	Price     int64     `json:"p,omitempty"`
+	Name      string    `json:"n,omitempty"`
+	CreatedAt time.Time `json:"c,omitzero"`
+}
+
+// encodeItemCursor returns the cursor for the page that follows item in the
+// listing opts describes.
+func encodeItemCursor(opts ItemListOptions, item *Item) string {
+	cur := itemCursor{SortBy: opts.SortBy, Desc: opts.Desc, ID: item.ID}
+	switch opts.SortBy {
+	case ItemSortPrice:
+		cur.Price = item.Price.Amount
+	case ItemSortName:
+		cur.Name = item.Name
+	case ItemSortCreatedAt:
+		cur.CreatedAt = item.CreatedAt
+	}
+	b, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeItemCursor parses a cursor made by encodeItemCursor for the same
+// sort as opts into the item the next page starts after.
+func decodeItemCursor(s string, opts ItemListOptions) (*Item, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, false
+	}
+	var cur itemCursor
+	if err := json.Unmarshal(b, &cur); err != nil || cur.SortBy != opts.SortBy || cur.Desc != opts.Desc || cur.ID == 0 {
+		return nil, false
+	}
+	return &Item{ID: cur.ID, Price: money.New(cur.Price, ""), Name: cur.Name, CreatedAt: cur.CreatedAt}, true
+}
+
+// itemListOptions reads the query of GET /items: limit, cursor, sort (a
+// field optionally prefixed with "-" for descending order), min_price,
+// max_price and category (a slug, which also matches the categories below
+// it). Prices are in p's currency, and the catalog is filtered and sorted by
+// the prices it shows in that currency. It responds 400 and returns false if
+// any of them is invalid.
+func (h *handler) itemListOptions(c *gin.Context, p *pricer) (ItemListOptions, bool) {
+	fail := func(msg string) (ItemListOptions, bool) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return ItemListOptions{}, false
+	}
+
+	opts := ItemListOptions{Limit: defaultItemPageSize}
+	if p.currency != p.base {
+		opts.Currency, opts.Factor = p.currency, money.ConversionFactor(p.base, p.currency, p.rate)
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxItemPageSize {
+			return fail("limit must be between 1 and " + strconv.Itoa(maxItemPageSize))
+		}
+		opts.Limit = n
+	}
+
+	sort := c.DefaultQuery("sort", ItemSortID)
+	opts.SortBy, opts.Desc = strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+	switch opts.SortBy {
+	case ItemSortID, ItemSortPrice, ItemSortName, ItemSortCreatedAt:
+	default:
+		return fail("sort must be one of id, price, name, createdAt, optionally prefixed with -")
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		after, ok := decodeItemCursor(v, opts)
+		if !ok {
+			return fail("Invalid cursor")
+		}
+		opts.After = after
+	}
+
+	for _, f := range []struct {
+		name string
+		dst  **money.Money
+	}{{"min_price", &opts.MinPrice}, {"max_price", &opts.MaxPrice}} {
+		v := c.Query(f.name)
+		if v == "" {
+			continue
+		}
+		m, err := money.Parse(v, p.currency)
+		if err != nil || m.IsNegative() {
+			return fail(f.name + " must be a non-negative amount")
+		}
+		*f.dst = &m
+	}
+	if slug := c.Query("category"); slug != "" {
+		ids, err := h.categorySubtree(c.Request.Context(), slug)
+		if errors.Is(err, ErrNotFound) {
+			return fail("Unknown category")
+		}
+		if err != nil {
+			internalError(c, err)
+			return ItemListOptions{}, false
+		}
+		opts.CategoryIDs = ids
+	}
+
+	return opts, true
+}
+
+// listAllItems returns one page of the catalog.
+func (h *handler) listAllItems(c *gin.Context) {
+	p, ok := h.pricerFor(c)
+	if !ok {
+		return
+	}
+	opts, ok := h.itemListOptions(c, p)
+	if !ok {
+		return
+	}
+	h.respondItemPage(c, p, opts)
+}
+
+// respondItemPage responds with the page of the catalog opts selects,
+// priced by p.
+func (h *handler) respondItemPage(c *gin.Context, p *pricer, opts ItemListOptions) {
+	// Fetch one extra item to learn whether there is a next page.
+	limit := opts.Limit
+	opts.Limit++
+	items, err := h.store.Items().List(c.Request.Context(), opts)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	page := ItemPage{Items: items, Currency: p.currency}
+	if len(items) > limit {
+		page.Items = items[:limit]
+	}
+	if !h.localize(c, p, page.Items) {
+		return
+	}
+	// The cursor holds the price in p's currency, which the listing went
+	// by, so make it after converting.
+	if len(items) > limit {
+		page.NextCursor = encodeItemCursor(opts, &page.Items[limit-1])
+	}
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"fullstack-shopping-cart/money"
+)
+
+// createItems adds items priced in USD by name and returns their IDs.
+func (s *testServer) createItems(prices map[string]int64) map[string]uint {
+	s.t.Helper()
+	ids := map[string]uint{}
+	for name, amount := range prices {
+		item := &Item{Name: name, Price: money.New(amount, "USD")}
+		if err := s.store.Items().Create(context.Background(), item); err != nil {
+			s.t.Fatal(err)
+		}
+		ids[name] = item.ID
+	}
+	return ids
+}
+
+// listNames lists the pages of target from the first, following
+// next_cursor, and returns the names and prices in the order listed.
+func (s *testServer) listNames(target string) (names, prices []string) {
+	s.t.Helper()
+	next := target
+	for range 10 {
+		var page ItemPage
+		s.decode(s.do(http.MethodGet, next, "", nil), http.StatusOK, &page)
+		for _, item := range page.Items {
+			names = append(names, item.Name)
+			prices = append(prices, item.Price.String())
+		}
+		if page.NextCursor == "" {
+			return names, prices
+		}
+		next = target + "&cursor=" + page.NextCursor
+	}
+	s.t.Fatalf("%s: more pages than expected", target)
+	return nil, nil
+}
+
+func TestListItemsInCurrency(t *testing.T) {
+	s := newTestServer(t, Config{Currency: "USD"})
+	ctx := context.Background()
+	rate := &ExchangeRate{Currency: "EUR", Rate: "0.5", EffectiveFrom: time.Now().Add(-time.Hour)}
+	if err := s.store.ExchangeRates().Create(ctx, rate); err != nil {
+		t.Fatal(err)
+	}
+	ids := s.createItems(map[string]int64{"Lamp": 1000, "Desk": 2000, "Pen": 300, "Chair": 200})
+	for name, eur := range map[string]int64{"Desk": 400, "Chair": 900} {
+		if err := s.store.Items().SetPrice(ctx, ids[name], money.New(eur, "EUR")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		target     string
+		wantNames  []string
+		wantPrices []string
+	}{
+		{"/items?currency=EUR&sort=price&limit=1",
+			[]string{"Pen", "Desk", "Lamp", "Chair"}, []string{"1.50", "4.00", "5.00", "9.00"}},
+		{"/items?currency=EUR&sort=-price&limit=3",
+			[]string{"Chair", "Lamp", "Desk", "Pen"}, []string{"9.00", "5.00", "4.00", "1.50"}},
+		// The chair's own price is over the limit, though 2.00 USD
+		// converts to 1.00; the desk's is under it, though 20.00 USD is
+		// not.
+		{"/items?currency=EUR&sort=price&max_price=4.50",
+			[]string{"Pen", "Desk"}, []string{"1.50", "4.00"}},
+		{"/items?currency=EUR&sort=price&min_price=4",
+			[]string{"Desk", "Lamp", "Chair"}, []string{"4.00", "5.00", "9.00"}},
+		{"/items?sort=price&max_price=10",
+			[]string{"Chair", "Pen", "Lamp"}, []string{"2.00", "3.00", "10.00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			names, prices := s.listNames(tt.target)
+			if !slices.Equal(names, tt.wantNames) || !slices.Equal(prices, tt.wantPrices) {
+				t.Errorf("listed %v at %v; want %v at %v", names, prices, tt.wantNames, tt.wantPrices)
+			}
+		})
+	}
+}
+
+func TestListItemsPages(t *testing.T) {
+	s := newTestServer(t, Config{})
+	s.createItems(map[string]int64{"Lamp": 1000, "Desk": 2000, "Chair": 200})
+	pen := s.createItems(map[string]int64{"Pen": 300})["Pen"]
+	clip := s.createItems(map[string]int64{"Clip": 300})["Clip"]
+	if pen > clip {
+		t.Fatalf("pen %d created after clip %d", pen, clip)
+	}
+
+	// Each page ends where the next one starts; the last has no cursor.
+	pages := []struct {
+		names []string
+		more  bool
+	}{
+		{[]string{"Chair", "Clip"}, true},
+		{[]string{"Desk", "Lamp"}, true},
+		{[]string{"Pen"}, false},
+	}
+	target := "/items?sort=name&limit=2"
+	next := target
+	for i, want := range pages {
+		var page ItemPage
+		s.decode(s.do(http.MethodGet, next, "", nil), http.StatusOK, &page)
+		var names []string
+		for _, item := range page.Items {
+			names = append(names, item.Name)
+		}
+		if !slices.Equal(names, want.names) || (page.NextCursor != "") != want.more {
+			t.Fatalf("page %d = %v, next cursor %q; want %v, more %v", i+1, names, page.NextCursor, want.names, want.more)
+		}
+		next = target + "&cursor=" + page.NextCursor
+	}
+
+	// Equal prices go by ID in the same direction, so the pen and the clip
+	// are both listed once even when a page ends between them.
+	names, _ := s.listNames("/items?sort=-price&limit=1")
+	if want := []string{"Desk", "Lamp", "Clip", "Pen", "Chair"}; !slices.Equal(names, want) {
+		t.Errorf("by descending price = %v; want %v", names, want)
+	}
+}
+
+func TestListItemsRejectsBadCursor(t *testing.T) {
+	s := newTestServer(t, Config{})
+	s.createItems(map[string]int64{"Lamp": 1000, "Desk": 2000})
+	var page ItemPage
+	s.decode(s.do(http.MethodGet, "/items?sort=name&limit=1", "", nil), http.StatusOK, &page)
+	if page.NextCursor == "" {
+		t.Fatal("first page has no next cursor")
+	}
+
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{"not base64", "/items?sort=name&cursor=%25%25%25"},
+		{"not JSON", "/items?sort=name&cursor=" + base64.RawURLEncoding.EncodeToString([]byte("lamp"))},
+		{"no item", "/items?sort=name&cursor=" + base64.RawURLEncoding.EncodeToString([]byte(`{"s":"name","n":"Lamp"}`))},
+		{"other sort", "/items?sort=price&cursor=" + page.NextCursor},
+		{"other direction", "/items?sort=-name&cursor=" + page.NextCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp struct {
+				Error string `json:"error"`
+			}
+			s.decode(s.do(http.MethodGet, tt.target, "", nil), http.StatusBadRequest, &resp)
+			if resp.Error != "Invalid cursor" {
+				t.Errorf("error = %q; want Invalid cursor", resp.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fullstack-shopping-cart/search"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Field weights for the catalog search index: a word in an item's name
+// counts three times as much as one in its description.
+const (
+	nameWeight        = 3
+	descriptionWeight = 1
+)
+
+// catalogIndex is the search index of the items that are not archived. The
+// item handlers keep it current with the changes made through this process.
+// Changes made through other processes sharing the store only reach it when
+// it is rebuilt, which happens on the first search once it is older than
+// refresh; a zero refresh never rebuilds it.
+type catalogIndex struct {
+	store   Store
+	refresh time.Duration
+
+	mu      sync.Mutex
+	index   *search.Index
+	builtAt time.Time
+}
+
+// newCatalogIndex indexes every item in the catalog that is not archived.
+func newCatalogIndex(ctx context.Context, store Store, refresh time.Duration) (*catalogIndex, error) {
+	ci := &catalogIndex{store: store, refresh: refresh}
+	if err := ci.rebuild(ctx); err != nil {
+		return nil, err
+	}
+	return ci, nil
+}
+
+// rebuild replaces the index with a new one built from the store. It must
+// be called with ci.mu held, or before ci is shared.
+func (ci *catalogIndex) rebuild(ctx context.Context) error {
+	builtAt := time.Now()
+	items, err := ci.store.Items().List(ctx, ItemListOptions{})
+	if err != nil {
+		return err
+	}
+	index := search.NewIndex()
+	for i := range items {
+		indexItem(index, &items[i])
+	}
+	ci.index, ci.builtAt = index, builtAt
+	return nil
+}
+
+// current returns the index, rebuilding it first if it is due.
+func (ci *catalogIndex) current(ctx context.Context) (*search.Index, error) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	if ci.refresh > 0 && time.Since(ci.builtAt) >= ci.refresh {
+		if err := ci.rebuild(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return ci.index, nil
+}
+
+// put brings an item's entry up to date after it was created, edited or
+// archived.
+func (ci *catalogIndex) put(item *Item) {
+	ci.mu.Lock()
+	index := ci.index
+	ci.mu.Unlock()
+	indexItem(index, item)
+}
+
+// indexItem brings an item's entry in the search index up to date.
+func indexItem(index *search.Index, item *Item) {
+	if item.ArchivedAt != nil {
+		index.Delete(item.ID)
+		return
+	}
+	index.Put(item.ID,
+		search.Field{Text: item.Name, Weight: nameWeight},
+		search.Field{Text: item.Description, Weight: descriptionWeight})
+}
+
+// searchItems returns the items matching the q query parameter, most
+// relevant first. It takes an optional limit like GET /items.
+func (h *handler) searchItems(c *gin.Context) {
+	p, ok := h.pricerFor(c)
+	if !ok {
+		return
+	}
+	q := c.Query("q")
+	if strings.TrimSpace(q) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	limit := defaultItemPageSize
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxItemPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxItemPageSize)})
+			return
+		}
+		limit = n
+	}
+
+	ctx := c.Request.Context()
+	index, err := h.catalog.current(ctx)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	page := ItemPage{Items: []Item{}, Currency: p.currency}
+	for _, hit := range index.Search(q, limit) {
+		item, err := h.store.Items().Get(ctx, hit.ID)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		if item.ArchivedAt == nil {
+			page.Items = append(page.Items, *item)
+		}
+	}
+	if !h.localize(c, p, page.Items) {
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// searchNames returns the names of the items GET /items/search finds for q.
+func (s *testServer) searchNames(q string) []string {
+	s.t.Helper()
+	var page ItemPage
+	s.decode(s.do(http.MethodGet, "/items/search?q="+url.QueryEscape(q), "", nil), http.StatusOK, &page)
+	names := make([]string, len(page.Items))
+	for i, item := range page.Items {
+		names[i] = item.Name
+	}
+	return names
+}
+
+func TestSearchIndexAcrossInstances(t *testing.T) {
+	// Three instances share a store; items are edited through the first.
+	editor := newTestServer(t, Config{})
+	stale := newTestServer(t, Config{Store: editor.store})
+	refreshing := newTestServer(t, Config{Store: editor.store, SearchRefreshInterval: time.Nanosecond})
+	editor.createUser("staff", RoleStaff)
+	token, _ := editor.login("staff")
+
+	var lamp Item
+	editor.decode(editor.do(http.MethodPost, "/items", token, map[string]any{
+		"name": "Desk lamp", "description": "Bright", "price": "10.00", "stockQuantity": 1,
+	}), http.StatusCreated, &lamp)
+
+	tests := []struct {
+		name string
+		s    *testServer
+		want int
+	}{
+		{"instance that made the change", editor, 1},
+		{"instance without refreshes", stale, 0},
+		{"instance with refreshes", refreshing, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.s.searchNames("lamp"); len(got) != tt.want {
+				t.Errorf("search found %v; want %d items", got, tt.want)
+			}
+		})
+	}
+
+	if w := editor.do(http.MethodDelete, fmt.Sprintf("/items/%d", lamp.ID), token, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("archive status = %d; body %s", w.Code, w.Body)
+	}
+	if got := refreshing.searchNames("lamp"); len(got) != 0 {
+		t.Errorf("refreshed search found archived item: %v", got)
+	}
+}
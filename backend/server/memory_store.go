@@ -0,0 +1,1326 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"fullstack-shopping-cart/money"
+)
+
+// memoryStore keeps everything in maps guarded by a single mutex. Values are
+// stored and returned by copy so callers never share memory with the store.
+type memoryStore struct {
+	mu sync.RWMutex
+
+	users      map[uint]User
+	items      map[uint]Item
+	carts      map[uint]Cart
+	cartItems  map[uint]CartItem
+	orders     map[uint]Order
+	orderItems map[uint]OrderItem
+	sessions   map[uint]Session
+	orderLog   map[uint]OrderStatusChange
+	idemp      map[uint]IdempotencyRecord
+	itemPrices map[uint]ItemPrice
+	rates      map[uint]ExchangeRate
+	categories map[uint]Category
+	// itemCategories lists the IDs of each item's categories.
+	itemCategories map[uint][]uint
+	variants       map[uint]Variant
+	images         map[uint]ItemImage
+
+	nextUserID      uint
+	nextItemID      uint
+	nextCartID      uint
+	nextCartItemID  uint
+	nextOrderID     uint
+	nextOrderItemID uint
+	nextSessionID   uint
+	nextOrderLogID  uint
+	nextIdempID     uint
+	nextItemPriceID uint
+	nextRateID      uint
+	nextCategoryID  uint
+	nextVariantID   uint
+	nextImageID     uint
+}
+
+// NewMemoryStore returns an empty Store that lives only as long as the
+// process.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		users:           make(map[uint]User),
+		items:           make(map[uint]Item),
+		carts:           make(map[uint]Cart),
+		cartItems:       make(map[uint]CartItem),
+		orders:          make(map[uint]Order),
+		orderItems:      make(map[uint]OrderItem),
+		sessions:        make(map[uint]Session),
+		orderLog:        make(map[uint]OrderStatusChange),
+		idemp:           make(map[uint]IdempotencyRecord),
+		itemPrices:      make(map[uint]ItemPrice),
+		rates:           make(map[uint]ExchangeRate),
+		categories:      make(map[uint]Category),
+		itemCategories:  make(map[uint][]uint),
+		variants:        make(map[uint]Variant),
+		images:          make(map[uint]ItemImage),
+		nextUserID:      1,
+		nextItemID:      1,
+		nextCartID:      1,
+		nextCartItemID:  1,
+		nextOrderID:     1,
+		nextOrderItemID: 1,
+		nextSessionID:   1,
+		nextOrderLogID:  1,
+		nextIdempID:     1,
+		nextItemPriceID: 1,
+		nextRateID:      1,
+		nextCategoryID:  1,
+		nextVariantID:   1,
+		nextImageID:     1,
+	}
+}
+
+func (s *memoryStore) Users() UserRepository                 { return memoryUsers{s} }
+func (s *memoryStore) Items() ItemRepository                 { return memoryItems{s} }
+func (s *memoryStore) Carts() CartRepository                 { return memoryCarts{s} }
+func (s *memoryStore) Orders() OrderRepository               { return memoryOrders{s} }
+func (s *memoryStore) Sessions() SessionRepository           { return memorySessions{s} }
+func (s *memoryStore) Idempotency() IdempotencyRepository    { return memoryIdempotency{s} }
+func (s *memoryStore) ExchangeRates() ExchangeRateRepository { return memoryExchangeRates{s} }
+func (s *memoryStore) Categories() CategoryRepository        { return memoryCategories{s} }
+func (s *memoryStore) Variants() VariantRepository           { return memoryVariants{s} }
+func (s *memoryStore) ItemImages() ItemImageRepository       { return memoryItemImages{s} }
+
+type memoryUsers struct{ s *memoryStore }
+
+func (r memoryUsers) Create(ctx context.Context, user *User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, u := range r.s.users {
+		if u.Username == user.Username {
+			return ErrConflict
+		}
+	}
+	user.ID = r.s.nextUserID
+	user.CreatedAt = time.Now()
+	r.s.users[user.ID] = copyUser(*user)
+	r.s.nextUserID++
+	return nil
+}
+
+// copyUser returns u with its own Roles slice.
+func copyUser(u User) User {
+	u.Roles = slices.Clone(u.Roles)
+	return u
+}
+
+func (r memoryUsers) Get(ctx context.Context, id uint) (*User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	u, ok := r.s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	u = copyUser(u)
+	return &u, nil
+}
+
+func (r memoryUsers) GetByUsername(ctx context.Context, username string) (*User, error) {
+	return r.find(func(u *User) bool { return u.Username == username })
+}
+
+func (r memoryUsers) find(match func(*User) bool) (*User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, u := range r.s.users {
+		if match(&u) {
+			u = copyUser(u)
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r memoryUsers) List(ctx context.Context) ([]User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	list := make([]User, 0, len(r.s.users))
+	for _, u := range r.s.users {
+		list = append(list, copyUser(u))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (r memoryUsers) SetPasswordHash(ctx context.Context, id uint, hash string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	u.PasswordHash = hash
+	r.s.users[id] = u
+	return nil
+}
+
+func (r memoryUsers) SetRoles(ctx context.Context, id uint, roles Roles) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	u.Roles = slices.Clone(roles)
+	r.s.users[id] = u
+	return nil
+}
+
+func (r memoryUsers) GrantRole(ctx context.Context, id uint, role string) (*User, bool, error) {
+	return r.changeRoles(id, func(roles Roles) Roles { return roles.With(role) })
+}
+
+func (r memoryUsers) RevokeRole(ctx context.Context, id uint, role string) (*User, bool, error) {
+	return r.changeRoles(id, func(roles Roles) Roles { return roles.Without(role) })
+}
+
+func (r memoryUsers) changeRoles(id uint, change func(Roles) Roles) (*User, bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[id]
+	if !ok {
+		return nil, false, ErrNotFound
+	}
+	roles := change(u.Roles)
+	changed := !slices.Equal(roles, u.Roles)
+	u.Roles = roles
+	r.s.users[id] = u
+	u.Roles = slices.Clone(roles)
+	return &u, changed, nil
+}
+
+type memorySessions struct{ s *memoryStore }
+
+func (r memorySessions) Create(ctx context.Context, session *Session) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.sessions {
+		if existing.TokenHash == session.TokenHash {
+			return ErrConflict
+		}
+	}
+	session.ID = r.s.nextSessionID
+	r.s.sessions[session.ID] = *session
+	r.s.nextSessionID++
+	return nil
+}
+
+func (r memorySessions) GetByTokenHash(ctx context.Context, tokenHash string) (*Session, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, session := range r.s.sessions {
+		if session.TokenHash == tokenHash {
+			return &session, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r memorySessions) Get(ctx context.Context, id uint) (*Session, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	session, ok := r.s.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &session, nil
+}
+
+func (r memorySessions) MarkRotated(ctx context.Context, id uint, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	session, ok := r.s.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if session.RotatedAt != nil {
+		return ErrConflict
+	}
+	session.RotatedAt = &at
+	session.LastSeenAt = at
+	r.s.sessions[id] = session
+	return nil
+}
+
+func (r memorySessions) DeleteFamily(ctx context.Context, familyID string) (int64, error) {
+	return r.deleteWhere(func(s *Session) bool { return s.FamilyID == familyID }), nil
+}
+
+func (r memorySessions) DeleteByUser(ctx context.Context, userID uint) (int64, error) {
+	return r.deleteWhere(func(s *Session) bool { return s.UserID == userID }), nil
+}
+
+func (r memorySessions) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	return r.deleteWhere(func(s *Session) bool { return s.ExpiresAt.Before(now) }), nil
+}
+
+func (r memorySessions) deleteWhere(match func(*Session) bool) int64 {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var n int64
+	for id, session := range r.s.sessions {
+		if match(&session) {
+			delete(r.s.sessions, id)
+			n++
+		}
+	}
+	return n
+}
+
+type memoryIdempotency struct{ s *memoryStore }
+
+func (r memoryIdempotency) Reserve(ctx context.Context, record *IdempotencyRecord) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.idemp {
+		if existing.UserID == record.UserID && existing.Key == record.Key {
+			return ErrConflict
+		}
+	}
+	record.ID = r.s.nextIdempID
+	r.s.idemp[record.ID] = *record
+	r.s.nextIdempID++
+	return nil
+}
+
+func (r memoryIdempotency) Get(ctx context.Context, userID uint, key string) (*IdempotencyRecord, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, record := range r.s.idemp {
+		if record.UserID == userID && record.Key == key {
+			return &record, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r memoryIdempotency) Complete(ctx context.Context, id uint, statusCode int, body string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	record, ok := r.s.idemp[id]
+	if !ok {
+		return ErrNotFound
+	}
+	record.StatusCode = statusCode
+	record.ResponseBody = body
+	r.s.idemp[id] = record
+	return nil
+}
+
+func (r memoryIdempotency) Delete(ctx context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.idemp[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.idemp, id)
+	return nil
+}
+
+func (r memoryIdempotency) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var n int64
+	for id, record := range r.s.idemp {
+		if record.ExpiresAt.Before(now) {
+			delete(r.s.idemp, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+type memoryItems struct{ s *memoryStore }
+
+func (r memoryItems) Create(ctx context.Context, item *Item) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	item.ID = r.s.nextItemID
+	item.CreatedAt = time.Now()
+	item.UpdatedAt = item.CreatedAt
+	item.Version = 1
+	stored := copyItem(*item)
+	stored.Categories = nil
+	stored.Variants = nil
+	stored.Images = nil
+	r.s.items[item.ID] = stored
+	r.s.itemCategories[item.ID] = categoryIDs(item.Categories)
+	r.s.nextItemID++
+	return nil
+}
+
+// categoryIDs returns the IDs of categories.
+func categoryIDs(categories []Category) []uint {
+	ids := make([]uint, len(categories))
+	for i, c := range categories {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
+// copyItem returns item with its own Options.
+func copyItem(item Item) Item {
+	item.Options = slices.Clone(item.Options)
+	for i := range item.Options {
+		item.Options[i].Values = slices.Clone(item.Options[i].Values)
+	}
+	return item
+}
+
+// withAssociations returns a copy of item with Categories, Variants and
+// Images populated. It must be called with s.mu held.
+func (s *memoryStore) withAssociations(item Item) Item {
+	item = copyItem(item)
+	item.Images = s.imagesOf(item.ID)
+	item.Variants = []Variant{}
+	for _, v := range s.variants {
+		if v.ItemID == item.ID {
+			item.Variants = append(item.Variants, copyVariant(v))
+		}
+	}
+	sort.Slice(item.Variants, func(i, j int) bool { return item.Variants[i].ID < item.Variants[j].ID })
+	item.Categories = []Category{}
+	for _, id := range s.itemCategories[item.ID] {
+		if c, ok := s.categories[id]; ok {
+			item.Categories = append(item.Categories, copyCategory(c))
+		}
+	}
+	sort.Slice(item.Categories, func(i, j int) bool {
+		return compareCategories(&item.Categories[i], &item.Categories[j]) < 0
+	})
+	return item
+}
+
+func (r memoryItems) Get(ctx context.Context, id uint) (*Item, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	item, ok := r.s.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	item = r.s.withAssociations(item)
+	return &item, nil
+}
+
+func (r memoryItems) List(ctx context.Context, opts ItemListOptions) ([]Item, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	// Filter and sort copies priced as the listing goes by, and return the
+	// stored items.
+	own := map[uint]money.Money{}
+	if opts.Currency != "" {
+		for _, p := range r.s.itemPrices {
+			if p.Price.Currency == opts.Currency {
+				own[p.ItemID] = p.Price
+			}
+		}
+	}
+	order := func(a, b *Item) int {
+		c := compareItems(a, b, opts.SortBy)
+		if opts.Desc {
+			return -c
+		}
+		return c
+	}
+	list := make([]Item, 0, len(r.s.items))
+	for _, item := range r.s.items {
+		if opts.Currency != "" {
+			price, ok := own[item.ID]
+			if !ok {
+				price = money.New(item.Price.MulRat(opts.Factor).Amount, opts.Currency)
+			}
+			item.Price = price
+		}
+		switch {
+		case item.ArchivedAt != nil:
+		case len(opts.CategoryIDs) > 0 && !slices.ContainsFunc(r.s.itemCategories[item.ID], func(id uint) bool {
+			return slices.Contains(opts.CategoryIDs, id)
+		}):
+		case opts.MinPrice != nil && item.Price.Amount < opts.MinPrice.Amount:
+		case opts.MaxPrice != nil && item.Price.Amount > opts.MaxPrice.Amount:
+		case opts.After != nil && order(&item, opts.After) <= 0:
+		default:
+			list = append(list, item)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return order(&list[i], &list[j]) < 0 })
+	if opts.Limit > 0 && len(list) > opts.Limit {
+		list = list[:opts.Limit]
+	}
+	for i := range list {
+		list[i] = r.s.withAssociations(r.s.items[list[i].ID])
+	}
+	return list, nil
+}
+
+// compareItems orders items by the field named by sortBy, then by ID.
+func compareItems(a, b *Item, sortBy string) int {
+	var c int
+	switch sortBy {
+	case ItemSortPrice:
+		c = cmp.Compare(a.Price.Amount, b.Price.Amount)
+	case ItemSortName:
+		c = strings.Compare(a.Name, b.Name)
+	case ItemSortCreatedAt:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if c == 0 {
+		c = cmp.Compare(a.ID, b.ID)
+	}
+	return c
+}
+
+func (r memoryItems) Update(ctx context.Context, item *Item) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.items[item.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != item.Version {
+		return ErrConflict
+	}
+	stored.Name = item.Name
+	stored.Description = item.Description
+	stored.Price = item.Price
+	stored.Options = copyItem(*item).Options
+	stored.ArchivedAt = item.ArchivedAt
+	stored.Version++
+	stored.UpdatedAt = time.Now()
+	r.s.items[item.ID] = stored
+	r.s.itemCategories[item.ID] = categoryIDs(item.Categories)
+	item.Version = stored.Version
+	item.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+func (r memoryItems) SetStock(ctx context.Context, id uint, quantity int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	item, ok := r.s.items[id]
+	if !ok {
+		return ErrNotFound
+	}
+	item.StockQuantity = quantity
+	r.s.items[id] = item
+	return nil
+}
+
+func (r memoryItems) Available(ctx context.Context, id, variantID, excludeCartID uint, now time.Time) (int, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	if _, ok := r.s.items[id]; !ok {
+		return 0, ErrNotFound
+	}
+	if v, ok := r.s.variants[variantID]; variantID != 0 && (!ok || v.ItemID != id) {
+		return 0, ErrNotFound
+	}
+	return r.s.available(id, variantID, excludeCartID, now), nil
+}
+
+func (r memoryItems) Prices(ctx context.Context, id uint) ([]ItemPrice, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	if _, ok := r.s.items[id]; !ok {
+		return nil, ErrNotFound
+	}
+	list := []ItemPrice{}
+	for _, p := range r.s.itemPrices {
+		if p.ItemID == id {
+			list = append(list, p)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Price.Currency < list[j].Price.Currency })
+	return list, nil
+}
+
+func (r memoryItems) SetPrice(ctx context.Context, id uint, price money.Money) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.items[id]; !ok {
+		return ErrNotFound
+	}
+	for pid, p := range r.s.itemPrices {
+		if p.ItemID == id && p.Price.Currency == price.Currency {
+			p.Price = price
+			r.s.itemPrices[pid] = p
+			return nil
+		}
+	}
+	r.s.itemPrices[r.s.nextItemPriceID] = ItemPrice{ID: r.s.nextItemPriceID, ItemID: id, Price: price}
+	r.s.nextItemPriceID++
+	return nil
+}
+
+func (r memoryItems) DeletePrice(ctx context.Context, id uint, currency string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for pid, p := range r.s.itemPrices {
+		if p.ItemID == id && p.Price.Currency == currency {
+			delete(r.s.itemPrices, pid)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r memoryItems) PricesIn(ctx context.Context, currency string, ids []uint) (map[uint]money.Money, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	prices := make(map[uint]money.Money)
+	for _, p := range r.s.itemPrices {
+		if p.Price.Currency == currency && slices.Contains(ids, p.ItemID) {
+			prices[p.ItemID] = p.Price
+		}
+	}
+	return prices, nil
+}
+
+// available must be called with s.mu held.
+func (s *memoryStore) available(itemID, variantID, excludeCartID uint, now time.Time) int {
+	n := s.items[itemID].StockQuantity
+	if variantID != 0 {
+		n = s.variants[variantID].StockQuantity
+	}
+	for _, ci := range s.cartItems {
+		if ci.ItemID == itemID && ci.VariantID == variantID && ci.CartID != excludeCartID &&
+			ci.ReservedUntil != nil && ci.ReservedUntil.After(now) {
+			n -= ci.Quantity
+		}
+	}
+	return max(n, 0)
+}
+
+type memoryExchangeRates struct{ s *memoryStore }
+
+func (r memoryExchangeRates) Create(ctx context.Context, rate *ExchangeRate) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.rates {
+		if existing.Currency == rate.Currency && existing.EffectiveFrom.Equal(rate.EffectiveFrom) {
+			return ErrConflict
+		}
+	}
+	rate.ID = r.s.nextRateID
+	rate.CreatedAt = time.Now()
+	r.s.rates[rate.ID] = *rate
+	r.s.nextRateID++
+	return nil
+}
+
+func (r memoryExchangeRates) List(ctx context.Context, currency string) ([]ExchangeRate, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	list := []ExchangeRate{}
+	for _, rate := range r.s.rates {
+		if currency == "" || rate.Currency == currency {
+			list = append(list, rate)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Currency != list[j].Currency {
+			return list[i].Currency < list[j].Currency
+		}
+		return list[i].EffectiveFrom.Before(list[j].EffectiveFrom)
+	})
+	return list, nil
+}
+
+func (r memoryExchangeRates) Current(ctx context.Context, currency string, at time.Time) (*ExchangeRate, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var current *ExchangeRate
+	for _, rate := range r.s.rates {
+		if rate.Currency != currency || rate.EffectiveFrom.After(at) {
+			continue
+		}
+		if current == nil || rate.EffectiveFrom.After(current.EffectiveFrom) {
+			current = &rate
+		}
+	}
+	if current == nil {
+		return nil, ErrNotFound
+	}
+	return current, nil
+}
+
+func (r memoryExchangeRates) Delete(ctx context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.rates[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.rates, id)
+	return nil
+}
+
+type memoryCategories struct{ s *memoryStore }
+
+// copyCategory returns c with its own ParentID.
+func copyCategory(c Category) Category {
+	if c.ParentID != nil {
+		parent := *c.ParentID
+		c.ParentID = &parent
+	}
+	return c
+}
+
+// compareCategories orders categories by SortOrder, then name, then ID.
+func compareCategories(a, b *Category) int {
+	return cmp.Or(
+		cmp.Compare(a.SortOrder, b.SortOrder),
+		strings.Compare(a.Name, b.Name),
+		cmp.Compare(a.ID, b.ID))
+}
+
+func (r memoryCategories) Create(ctx context.Context, category *Category) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if err := r.s.checkCategory(category); err != nil {
+		return err
+	}
+	category.ID = r.s.nextCategoryID
+	category.CreatedAt = time.Now()
+	category.UpdatedAt = category.CreatedAt
+	r.s.categories[category.ID] = copyCategory(*category)
+	r.s.nextCategoryID++
+	return nil
+}
+
+// checkCategory returns ErrConflict if another category has the slug and
+// ErrNotFound if the parent does not exist. It must be called with s.mu
+// held.
+func (s *memoryStore) checkCategory(category *Category) error {
+	for _, c := range s.categories {
+		if c.ID != category.ID && c.Slug == category.Slug {
+			return ErrConflict
+		}
+	}
+	if category.ParentID != nil {
+		if _, ok := s.categories[*category.ParentID]; !ok {
+			return ErrNotFound
+		}
+	}
+	return nil
+}
+
+func (r memoryCategories) Get(ctx context.Context, id uint) (*Category, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	c, ok := r.s.categories[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c = copyCategory(c)
+	return &c, nil
+}
+
+func (r memoryCategories) GetBySlug(ctx context.Context, slug string) (*Category, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, c := range r.s.categories {
+		if c.Slug == slug {
+			c = copyCategory(c)
+			return &c, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r memoryCategories) List(ctx context.Context) ([]Category, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	list := make([]Category, 0, len(r.s.categories))
+	for _, c := range r.s.categories {
+		list = append(list, copyCategory(c))
+	}
+	sort.Slice(list, func(i, j int) bool { return compareCategories(&list[i], &list[j]) < 0 })
+	return list, nil
+}
+
+func (r memoryCategories) Update(ctx context.Context, category *Category) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.categories[category.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := r.s.checkCategory(category); err != nil {
+		return err
+	}
+	for parent := category.ParentID; parent != nil; parent = r.s.categories[*parent].ParentID {
+		if *parent == category.ID {
+			return ErrCategoryCycle
+		}
+	}
+	category.CreatedAt = stored.CreatedAt
+	category.UpdatedAt = time.Now()
+	r.s.categories[category.ID] = copyCategory(*category)
+	return nil
+}
+
+func (r memoryCategories) Delete(ctx context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.categories[id]; !ok {
+		return ErrNotFound
+	}
+	for _, c := range r.s.categories {
+		if c.ParentID != nil && *c.ParentID == id {
+			return ErrConflict
+		}
+	}
+	delete(r.s.categories, id)
+	for itemID, ids := range r.s.itemCategories {
+		r.s.itemCategories[itemID] = slices.DeleteFunc(ids, func(c uint) bool { return c == id })
+	}
+	return nil
+}
+
+type memoryVariants struct{ s *memoryStore }
+
+// copyVariant returns v with its own Options and Price.
+func copyVariant(v Variant) Variant {
+	v.Options = maps.Clone(v.Options)
+	if v.Price != nil {
+		price := *v.Price
+		v.Price = &price
+	}
+	return v
+}
+
+func (r memoryVariants) Create(ctx context.Context, variant *Variant) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.items[variant.ItemID]; !ok {
+		return ErrNotFound
+	}
+	if err := r.s.checkVariant(variant); err != nil {
+		return err
+	}
+	variant.ID = r.s.nextVariantID
+	variant.CreatedAt = time.Now()
+	variant.UpdatedAt = variant.CreatedAt
+	r.s.variants[variant.ID] = copyVariant(*variant)
+	r.s.nextVariantID++
+	return nil
+}
+
+// checkVariant returns ErrConflict if another variant has the SKU or, of
+// the same item, the options. It must be called with s.mu held.
+func (s *memoryStore) checkVariant(variant *Variant) error {
+	for _, v := range s.variants {
+		if v.ID == variant.ID {
+			continue
+		}
+		if v.SKU == variant.SKU || v.ItemID == variant.ItemID && maps.Equal(v.Options, variant.Options) {
+			return ErrConflict
+		}
+	}
+	return nil
+}
+
+func (r memoryVariants) Get(ctx context.Context, id uint) (*Variant, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	v, ok := r.s.variants[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	v = copyVariant(v)
+	return &v, nil
+}
+
+func (r memoryVariants) Update(ctx context.Context, variant *Variant) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.variants[variant.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := r.s.checkVariant(variant); err != nil {
+		return err
+	}
+	variant.ItemID = stored.ItemID
+	variant.CreatedAt = stored.CreatedAt
+	variant.UpdatedAt = time.Now()
+	r.s.variants[variant.ID] = copyVariant(*variant)
+	return nil
+}
+
+func (r memoryVariants) Delete(ctx context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.variants[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.variants, id)
+	for lineID, ci := range r.s.cartItems {
+		if ci.VariantID == id {
+			delete(r.s.cartItems, lineID)
+		}
+	}
+	return nil
+}
+
+type memoryItemImages struct{ s *memoryStore }
+
+func (r memoryItemImages) Create(ctx context.Context, image *ItemImage) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.items[image.ItemID]; !ok {
+		return ErrNotFound
+	}
+	images := r.s.imagesOf(image.ItemID)
+	for _, img := range r.s.images {
+		if img.Key == image.Key {
+			return ErrConflict
+		}
+	}
+	image.Primary = image.Primary || len(images) == 0
+	if image.Primary {
+		for _, img := range images {
+			img.Primary = false
+			r.s.images[img.ID] = img
+		}
+	}
+	image.ID = r.s.nextImageID
+	image.Position = len(images)
+	image.CreatedAt = time.Now()
+	r.s.images[image.ID] = *image
+	r.s.nextImageID++
+	return nil
+}
+
+func (r memoryItemImages) Arrange(ctx context.Context, itemID uint, ids []uint, primaryID uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	images := r.s.imagesOf(itemID)
+	if len(ids) != len(images) {
+		return ErrConflict
+	}
+	for _, img := range images {
+		position := slices.Index(ids, img.ID)
+		if position < 0 {
+			return ErrConflict
+		}
+		img.Position = position
+		img.Primary = img.ID == primaryID
+		r.s.images[img.ID] = img
+	}
+	return nil
+}
+
+func (r memoryItemImages) Delete(ctx context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	deleted, ok := r.s.images[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(r.s.images, id)
+	for i, img := range r.s.imagesOf(deleted.ItemID) {
+		img.Position = i
+		img.Primary = img.Primary || deleted.Primary && i == 0
+		r.s.images[img.ID] = img
+	}
+	return nil
+}
+
+// imagesOf returns copies of the item's images ordered by Position. It
+// must be called with s.mu held.
+func (s *memoryStore) imagesOf(itemID uint) []ItemImage {
+	images := []ItemImage{}
+	for _, img := range s.images {
+		if img.ItemID == itemID {
+			images = append(images, img)
+		}
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Position < images[j].Position })
+	return images
+}
+
+type memoryCarts struct{ s *memoryStore }
+
+func (r memoryCarts) GetByUser(ctx context.Context, userID uint) (*Cart, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	cart, ok := r.s.cartByUser(userID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cart, nil
+}
+
+func (r memoryCarts) GetOrCreateForUser(ctx context.Context, userID uint) (*Cart, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if cart, ok := r.s.cartByUser(userID); ok {
+		return cart, nil
+	}
+	cart := Cart{
+		ID:        r.s.nextCartID,
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	}
+	r.s.carts[cart.ID] = cart
+	r.s.nextCartID++
+	cart.CartItems = []CartItem{}
+	return &cart, nil
+}
+
+func (r memoryCarts) AddItem(ctx context.Context, cartItem *CartItem) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.carts[cartItem.CartID]; !ok {
+		return ErrNotFound
+	}
+	if line, ok := r.s.cartLine(cartItem.CartID, cartItem.ItemID, cartItem.VariantID); ok {
+		line.Quantity += cartItem.Quantity
+		line.ReservedUntil = cartItem.ReservedUntil
+		if line.Quantity > MaxCartQuantity {
+			return ErrQuantityTooLarge
+		}
+		if err := r.s.checkStock(line); err != nil {
+			return err
+		}
+		r.s.cartItems[line.ID] = line
+		*cartItem = line
+		return nil
+	}
+	if cartItem.Quantity > MaxCartQuantity {
+		return ErrQuantityTooLarge
+	}
+	if err := r.s.checkStock(*cartItem); err != nil {
+		return err
+	}
+	cartItem.ID = r.s.nextCartItemID
+	r.s.cartItems[cartItem.ID] = *cartItem
+	r.s.nextCartItemID++
+	return nil
+}
+
+func (r memoryCarts) SetItemQuantity(ctx context.Context, cartID, itemID, variantID uint, quantity int, reservedUntil *time.Time) (*CartItem, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.carts[cartID]; !ok {
+		return nil, ErrNotFound
+	}
+	line, ok := r.s.cartLine(cartID, itemID, variantID)
+	if !ok {
+		line = CartItem{CartID: cartID, ItemID: itemID, VariantID: variantID}
+	}
+	line.Quantity = quantity
+	line.ReservedUntil = reservedUntil
+	if err := r.s.checkStock(line); err != nil {
+		return nil, err
+	}
+	if !ok {
+		line.ID = r.s.nextCartItemID
+		r.s.nextCartItemID++
+	}
+	r.s.cartItems[line.ID] = line
+	return &line, nil
+}
+
+func (r memoryCarts) RemoveItem(ctx context.Context, cartID, itemID, variantID uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	line, ok := r.s.cartLine(cartID, itemID, variantID)
+	if !ok {
+		return ErrNotFound
+	}
+	delete(r.s.cartItems, line.ID)
+	return nil
+}
+
+func (r memoryCarts) Clear(ctx context.Context, cartID uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, ci := range r.s.cartItems {
+		if ci.CartID == cartID {
+			delete(r.s.cartItems, id)
+		}
+	}
+	return nil
+}
+
+// checkStock returns an *InsufficientStockError unless stock less what
+// other carts have reserved covers line. It must be called with s.mu held.
+func (s *memoryStore) checkStock(line CartItem) error {
+	n := s.available(line.ItemID, line.VariantID, line.CartID, time.Now())
+	if n < line.Quantity {
+		return &InsufficientStockError{Shortages: []StockShortage{{
+			ItemID:    line.ItemID,
+			VariantID: line.VariantID,
+			Requested: line.Quantity,
+			Available: n,
+		}}}
+	}
+	return nil
+}
+
+// cartLine must be called with s.mu held.
+func (s *memoryStore) cartLine(cartID, itemID, variantID uint) (CartItem, bool) {
+	for _, ci := range s.cartItems {
+		if ci.CartID == cartID && ci.ItemID == itemID && ci.VariantID == variantID {
+			return ci, true
+		}
+	}
+	return CartItem{}, false
+}
+
+// cartByUser must be called with s.mu held.
+func (s *memoryStore) cartByUser(userID uint) (*Cart, bool) {
+	for _, cart := range s.carts {
+		if cart.UserID == userID {
+			cart.CartItems = s.linesOfCart(cart.ID)
+			return &cart, true
+		}
+	}
+	return nil, false
+}
+
+// linesOfCart must be called with s.mu held.
+func (s *memoryStore) linesOfCart(cartID uint) []CartItem {
+	lines := []CartItem{}
+	for _, ci := range s.cartItems {
+		if ci.CartID == cartID {
+			ci.Item = s.withAssociations(s.items[ci.ItemID])
+			if v, ok := s.variants[ci.VariantID]; ok {
+				v = copyVariant(v)
+				ci.Variant = &v
+			}
+			lines = append(lines, ci)
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].ID < lines[j].ID })
+	return lines
+}
+
+type memoryOrders struct{ s *memoryStore }
+
+func (r memoryOrders) Create(ctx context.Context, order *Order, cart *Cart) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, ci := range cart.CartItems {
+		line, ok := r.s.cartItems[ci.ID]
+		if !ok || line.Quantity != ci.Quantity {
+			return ErrConflict
+		}
+	}
+	now := time.Now()
+	var shortages []StockShortage
+	for _, oi := range order.OrderItems {
+		if available := r.s.available(oi.ItemID, oi.VariantID, cart.ID, now); available < oi.Quantity {
+			shortages = append(shortages, StockShortage{
+				ItemID:    oi.ItemID,
+				VariantID: oi.VariantID,
+				Requested: oi.Quantity,
+				Available: available,
+			})
+		}
+	}
+	if len(shortages) > 0 {
+		return &InsufficientStockError{Shortages: shortages}
+	}
+	for _, oi := range order.OrderItems {
+		r.s.addStock(oi.ItemID, oi.VariantID, -oi.Quantity)
+	}
+	for _, ci := range cart.CartItems {
+		delete(r.s.cartItems, ci.ID)
+	}
+
+	order.ID = r.s.nextOrderID
+	order.CreatedAt = time.Now()
+	r.s.nextOrderID++
+	for i := range order.OrderItems {
+		oi := &order.OrderItems[i]
+		oi.ID = r.s.nextOrderItemID
+		oi.OrderID = order.ID
+		stored := *oi
+		stored.Options = maps.Clone(oi.Options)
+		r.s.orderItems[oi.ID] = stored
+		r.s.nextOrderItemID++
+	}
+
+	stored := *order
+	stored.OrderItems = nil
+	r.s.orders[order.ID] = stored
+	r.s.appendOrderLog(&OrderStatusChange{
+		OrderID:  order.ID,
+		ToStatus: order.Status,
+		ActorID:  order.UserID,
+	})
+	return nil
+}
+
+func (r memoryOrders) Get(ctx context.Context, id uint) (*Order, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	order, ok := r.s.orders[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	order.OrderItems = r.s.linesOfOrder(order.ID)
+	return &order, nil
+}
+
+func (r memoryOrders) ChangeStatus(ctx context.Context, change *OrderStatusChange) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	order, ok := r.s.orders[change.OrderID]
+	if !ok {
+		return ErrNotFound
+	}
+	if order.Status != change.FromStatus {
+		return ErrConflict
+	}
+	order.Status = change.ToStatus
+	r.s.orders[order.ID] = order
+	if ReturnsStock(change.FromStatus, change.ToStatus) {
+		for _, oi := range r.s.linesOfOrder(order.ID) {
+			r.s.addStock(oi.ItemID, oi.VariantID, oi.Quantity)
+		}
+	}
+	r.s.appendOrderLog(change)
+	return nil
+}
+
+func (r memoryOrders) History(ctx context.Context, orderID uint) ([]OrderStatusChange, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	list := []OrderStatusChange{}
+	for _, change := range r.s.orderLog {
+		if change.OrderID == orderID {
+			list = append(list, change)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// addStock adds n units to the stock of the variant, or of the item if
+// variantID is zero, if it still exists. It must be called with s.mu held.
+func (s *memoryStore) addStock(itemID, variantID uint, n int) {
+	if variantID != 0 {
+		if v, ok := s.variants[variantID]; ok {
+			v.StockQuantity += n
+			s.variants[variantID] = v
+		}
+		return
+	}
+	if item, ok := s.items[itemID]; ok {
+		item.StockQuantity += n
+		s.items[itemID] = item
+	}
+}
+
+// appendOrderLog must be called with s.mu held.
+func (s *memoryStore) appendOrderLog(change *OrderStatusChange) {
+	change.ID = s.nextOrderLogID
+	change.CreatedAt = time.Now()
+	s.orderLog[change.ID] = *change
+	s.nextOrderLogID++
+}
+
+func (r memoryOrders) ListByUser(ctx context.Context, userID uint, opts OrderListOptions) ([]Order, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	list := []Order{}
+	for _, order := range r.s.orders {
+		if order.UserID == userID {
+			if opts.WithItems {
+				order.OrderItems = r.s.linesOfOrder(order.ID)
+			}
+			list = append(list, order)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// linesOfOrder must be called with s.mu held.
+func (s *memoryStore) linesOfOrder(orderID uint) []OrderItem {
+	lines := []OrderItem{}
+	for _, oi := range s.orderItems {
+		if oi.OrderID == orderID {
+			oi.Options = maps.Clone(oi.Options)
+			lines = append(lines, oi)
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].ID < lines[j].ID })
+	return lines
+}
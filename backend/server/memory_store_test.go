@@ -0,0 +1,14 @@
+package server_test
+
+import (
+	"testing"
+
+	"fullstack-shopping-cart/server"
+	"fullstack-shopping-cart/server/storetest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) server.Store {
+		return server.NewMemoryStore()
+	})
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"fullstack-shopping-cart/money"
+)
+
+// User is an account as stored. Respond with UserResponse instead of
+// serializing it directly.
+type User struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Username     string    `gorm:"unique;not null" json:"username"`
+	PasswordHash string    `gorm:"not null" json:"-"`
+	Roles        Roles     `gorm:"type:text;not null" json:"roles"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Session is one refresh token. Refreshing rotates it: the old row is marked
+// RotatedAt and a new one is issued in the same family, so presenting a
+// rotated token again reveals that it was stolen. LastSeenAt is when the
+// token was last presented, which is when it was issued until it is
+// rotated. The token itself is never stored, only its SHA-256 hash.
+type Session struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"userId"`
+	FamilyID   string     `gorm:"not null;index" json:"-"`
+	TokenHash  string     `gorm:"unique;not null" json:"-"`
+	IssuedAt   time.Time  `gorm:"not null" json:"issuedAt"`
+	ExpiresAt  time.Time  `gorm:"not null;index" json:"expiresAt"`
+	LastSeenAt time.Time  `gorm:"not null" json:"lastSeenAt"`
+	RotatedAt  *time.Time `json:"rotatedAt,omitempty"`
+}
+
+// Item is a catalog entry. Archived items are hidden from the catalog and
+// cannot be added to carts, but stay resolvable for past orders. Version is
+// incremented by every update and backs the item's ETag. An item can be in
+// any number of categories. Items with variants are sold and stocked only
+// as their variants, which differ along the item's Options. Images are
+// ordered by Position.
+type Item struct {
+	ID            uint        `gorm:"primaryKey" json:"id"`
+	Name          string      `gorm:"not null" json:"name"`
+	Description   string      `json:"description"`
+	Price         money.Money `gorm:"embedded;embeddedPrefix:price_" json:"price"`
+	Categories    []Category  `gorm:"many2many:item_categories" json:"categories"`
+	Options       ItemOptions `gorm:"type:text;not null" json:"options"`
+	Variants      []Variant   `gorm:"foreignKey:ItemID" json:"variants"`
+	Images        []ItemImage `gorm:"foreignKey:ItemID" json:"images"`
+	StockQuantity int         `gorm:"not null" json:"stockQuantity"`
+	Version       int         `gorm:"not null" json:"-"`
+	CreatedAt     time.Time   `json:"createdAt"`
+	UpdatedAt     time.Time   `json:"updatedAt"`
+	ArchivedAt    *time.Time  `json:"archivedAt,omitempty"`
+}
+
+// MarshalJSON adds the currency of the item's price, which Money leaves out.
+func (i Item) MarshalJSON() ([]byte, error) {
+	type plain Item
+	return json.Marshal(struct {
+		plain
+		Currency string `json:"currency"`
+	}{plain(i), i.Price.Currency})
+}
+
+// Variant is one version of an item that can be bought, such as its shirt
+// in size M and red, picked by a value for each of the item's options. It
+// has its own stock. A nil Price sells it at the item's price.
+type Variant struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	ItemID        uint           `gorm:"not null" json:"itemId"`
+	SKU           string         `gorm:"column:sku;unique;not null" json:"sku"`
+	Options       VariantOptions `gorm:"type:text;not null" json:"options"`
+	Price         *money.Money   `gorm:"embedded;embeddedPrefix:price_" json:"price"`
+	StockQuantity int            `gorm:"not null" json:"stockQuantity"`
+	Barcode       string         `gorm:"not null" json:"barcode"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	UpdatedAt     time.Time      `json:"updatedAt"`
+}
+
+// ItemImage is a picture of an item. The uploaded file is kept in media
+// storage under Key, next to thumbnails of it in each of thumbnailSizes.
+// An item with images has exactly one Primary image, shown wherever the
+// item gets a single picture. URL and Thumbnails are filled in by the
+// handlers from the media storage in use.
+type ItemImage struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	ItemID      uint      `gorm:"not null" json:"itemId"`
+	Position    int       `gorm:"not null" json:"position"`
+	Primary     bool      `gorm:"column:is_primary;not null" json:"primary"`
+	Key         string    `gorm:"column:storage_key;unique;not null" json:"-"`
+	ContentType string    `gorm:"not null" json:"contentType"`
+	Width       int       `gorm:"not null" json:"width"`
+	Height      int       `gorm:"not null" json:"height"`
+	Size        int64     `gorm:"column:size_bytes;not null" json:"size"`
+	CreatedAt   time.Time `json:"createdAt"`
+
+	URL        string            `gorm:"-" json:"url"`
+	Thumbnails map[string]string `gorm:"-" json:"thumbnails"`
+}
+
+// Category is a node of the catalog taxonomy. Categories without a parent
+// are top-level; siblings are shown by SortOrder, then by name.
+type Category struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ParentID  *uint     `json:"parentId"`
+	Slug      string    `gorm:"unique;not null" json:"slug"`
+	Name      string    `gorm:"not null" json:"name"`
+	SortOrder int       `gorm:"not null" json:"sortOrder"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ItemPrice sets an item's price in a currency other than the shop's own.
+// In currencies it has no ItemPrice for, an item's price is converted at
+// the exchange rate.
+type ItemPrice struct {
+	ID     uint        `gorm:"primaryKey"`
+	ItemID uint        `gorm:"not null"`
+	Price  money.Money `gorm:"embedded;embeddedPrefix:price_"`
+}
+
+// ExchangeRate is how many units of Currency one unit of the shop's currency
+// buys from EffectiveFrom until the currency's next rate takes effect. Rate
+// is a decimal kept as text so that it stays exact.
+type ExchangeRate struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Currency      string    `gorm:"not null" json:"currency"`
+	Rate          string    `gorm:"not null" json:"rate"`
+	EffectiveFrom time.Time `gorm:"not null" json:"effectiveFrom"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type Cart struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"unique;not null" json:"userId"`
+	CreatedAt time.Time  `json:"createdAt"`
+	CartItems []CartItem `gorm:"foreignKey:CartID" json:"cartItems"`
+}
+
+// CartItem is one line of a cart. A cart has at most one line per item and
+// variant; VariantID is zero for items without variants. While
+// ReservedUntil is in the future the line's units are held back from other
+// carts.
+type CartItem struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	CartID        uint       `gorm:"not null;uniqueIndex:idx_cart_items_cart_item" json:"cartId"`
+	ItemID        uint       `gorm:"not null;uniqueIndex:idx_cart_items_cart_item" json:"itemId"`
+	VariantID     uint       `gorm:"not null;uniqueIndex:idx_cart_items_cart_item" json:"variantId,omitempty"`
+	Quantity      int        `gorm:"not null;default:1" json:"quantity"`
+	ReservedUntil *time.Time `json:"reservedUntil,omitempty"`
+	Item          Item       `gorm:"foreignKey:ItemID" json:"item"`
+	Variant       *Variant   `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+}
+
+// Order is a checked-out cart. Its amounts are fixed at checkout and do not
+// follow later catalog price changes. Orders placed in another currency than
+// the shop's record the exchange rate from BaseCurrency they were priced at;
+// it is "1" otherwise.
+type Order struct {
+	ID           uint        `gorm:"primaryKey" json:"id"`
+	UserID       uint        `gorm:"not null" json:"userId"`
+	CartID       uint        `gorm:"not null" json:"cartId"`
+	Subtotal     money.Money `gorm:"embedded;embeddedPrefix:subtotal_" json:"subtotal"`
+	Discount     money.Money `gorm:"embedded;embeddedPrefix:discount_" json:"discount"`
+	Tax          money.Money `gorm:"embedded;embeddedPrefix:tax_" json:"tax"`
+	Shipping     money.Money `gorm:"embedded;embeddedPrefix:shipping_" json:"shipping"`
+	Total        money.Money `gorm:"embedded;embeddedPrefix:total_" json:"total"`
+	Currency     string      `gorm:"not null" json:"currency"`
+	BaseCurrency string      `gorm:"not null" json:"baseCurrency"`
+	ExchangeRate string      `gorm:"not null" json:"exchangeRate"`
+	Status       string      `gorm:"not null;index" json:"status"`
+	CreatedAt    time.Time   `json:"createdAt"`
+	OrderItems   []OrderItem `gorm:"foreignKey:OrderID" json:"orderItems,omitempty"`
+}
+
+// OrderStatusChange is one entry of an order's append-only status history.
+// The first entry of every order has an empty FromStatus.
+type OrderStatusChange struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	OrderID    uint      `gorm:"not null;index" json:"orderId"`
+	FromStatus string    `gorm:"not null" json:"fromStatus"`
+	ToStatus   string    `gorm:"not null" json:"toStatus"`
+	ActorID    uint      `gorm:"not null" json:"actorId"`
+	Note       string    `gorm:"not null" json:"note,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// OrderItem is one order line with the product's name and price, and the
+// SKU and options of its variant if it has one, as they were at checkout.
+// Discount is the line's share of the order's discount.
+type OrderItem struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	OrderID   uint           `gorm:"not null" json:"orderId"`
+	ItemID    uint           `gorm:"not null" json:"itemId"`
+	VariantID uint           `gorm:"not null" json:"variantId,omitempty"`
+	Name      string         `gorm:"not null" json:"name"`
+	SKU       string         `gorm:"column:sku;not null" json:"sku,omitempty"`
+	Options   VariantOptions `gorm:"type:text;not null" json:"options,omitempty"`
+	UnitPrice money.Money    `gorm:"embedded;embeddedPrefix:unit_price_" json:"unitPrice"`
+	Quantity  int            `gorm:"not null;default:1" json:"quantity"`
+	LineTotal money.Money    `gorm:"embedded;embeddedPrefix:line_total_" json:"lineTotal"`
+	Discount  money.Money    `gorm:"embedded;embeddedPrefix:discount_" json:"discount"`
+	Item      Item           `gorm:"foreignKey:ItemID" json:"-"`
+}
+
+// IdempotencyRecord remembers the response to a request sent with an
+// Idempotency-Key header so that retries get the same response. StatusCode
+// is zero while the first request is still being handled.
+type IdempotencyRecord struct {
+	ID           uint      `gorm:"primaryKey"`
+	UserID       uint      `gorm:"not null;uniqueIndex:idx_idempotency_records_user_key"`
+	Key          string    `gorm:"column:idempotency_key;not null;uniqueIndex:idx_idempotency_records_user_key"`
+	RequestHash  string    `gorm:"not null"`
+	StatusCode   int       `gorm:"not null"`
+	ResponseBody string    `gorm:"not null"`
+	CreatedAt    time.Time `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateOrderRequest struct {
+	CartID uint `json:"cartId" binding:"required"`
+}
+
+type ChangeOrderStatusRequest struct {
+	Status string `json:"status" binding:"required"`
+	Note   string `json:"note"`
+}
+
+func (h *handler) createOrder(c *gin.Context) {
+	userObj, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	user := userObj.(*User)
+	p, ok := h.pricerFor(c)
+	if !ok {
+		return
+	}
+
+	var req CreateOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	// Find cart for user
+	cart, err := h.store.Carts().GetByUser(c.Request.Context(), user.ID)
+	if errors.Is(err, ErrNotFound) || (err == nil && cart.ID != req.CartID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if len(cart.CartItems) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+		return
+	}
+	var archived []uint
+	for _, ci := range cart.CartItems {
+		if ci.Item.ArchivedAt != nil {
+			archived = append(archived, ci.ItemID)
+		}
+	}
+	if len(archived) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Some items are no longer sold; remove them from the cart", "itemIds": archived})
+		return
+	}
+	// Lines added before their item got variants say nothing about which
+	// variant to send
+	var unchosen []uint
+	for _, ci := range cart.CartItems {
+		if ci.VariantID == 0 && len(ci.Item.Variants) > 0 {
+			unchosen = append(unchosen, ci.ItemID)
+		}
+	}
+	if len(unchosen) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Some items now come in variants; remove them from the cart and add the variants you want", "itemIds": unchosen})
+		return
+	}
+
+	// Create order with one line per cart line, priced as the cart is
+	// priced right now in the requested currency, and empty the cart in
+	// the same step
+	priced, err := h.newCartResponse(c.Request.Context(), cart, p)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	totals, err := p.pricing(h.pricing).Totals(priced.Subtotal)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	order := &Order{
+		UserID:       user.ID,
+		CartID:       cart.ID,
+		Subtotal:     totals.Subtotal,
+		Discount:     totals.Discount,
+		Tax:          totals.Tax,
+		Shipping:     totals.Shipping,
+		Total:        totals.Total,
+		Currency:     priced.Currency,
+		BaseCurrency: p.base,
+		ExchangeRate: p.rateText,
+		Status:       OrderPending,
+	}
+	for _, line := range priced.Items {
+		order.OrderItems = append(order.OrderItems, OrderItem{
+			ItemID:    line.ItemID,
+			VariantID: line.VariantID,
+			Name:      line.Name,
+			SKU:       line.SKU,
+			Options:   line.Options,
+			UnitPrice: line.UnitPrice,
+			Quantity:  line.Quantity,
+			LineTotal: line.LineTotal,
+		})
+	}
+	allocateDiscount(order)
+	err = h.store.Orders().Create(c.Request.Context(), order, cart)
+	var stockErr *InsufficientStockError
+	if errors.As(err, &stockErr) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Not enough stock", "lines": stockErr.Shortages})
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cart changed during checkout; please review it and try again"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, order)
+}
+
+func (h *handler) orderHistoryList(c *gin.Context) {
+	userObj, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	user := userObj.(*User)
+
+	// ?expand=items embeds each order's line items
+	opts := OrderListOptions{WithItems: c.Query("expand") == "items"}
+	userOrders, err := h.store.Orders().ListByUser(c.Request.Context(), user.ID, opts)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, userOrders)
+}
+
+// fetchOrder returns one of the user's orders with its line items.
+func (h *handler) fetchOrder(c *gin.Context) {
+	user := c.MustGet("user").(*User)
+	order, ok := h.loadOrder(c, user, false)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// cancelOrder lets a customer cancel their own order while it is pending.
+func (h *handler) cancelOrder(c *gin.Context) {
+	user := c.MustGet("user").(*User)
+	order, ok := h.loadOrder(c, user, false)
+	if !ok {
+		return
+	}
+	h.changeOrderStatus(c, order, OrderCancelled, user, "")
+}
+
+// updateOrderStatus lets staff move any order along the transition table.
+func (h *handler) updateOrderStatus(c *gin.Context) {
+	user := c.MustGet("user").(*User)
+	var req ChangeOrderStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !validOrderStatus(req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+	order, ok := h.loadOrder(c, user, true)
+	if !ok {
+		return
+	}
+	h.changeOrderStatus(c, order, req.Status, user, req.Note)
+}
+
+// orderStatusHistory returns an order's status changes, oldest first. Staff
+// may read any order's history, customers only their own.
+func (h *handler) orderStatusHistory(c *gin.Context) {
+	user := c.MustGet("user").(*User)
+	order, ok := h.loadOrder(c, user, user.Roles.Has(RoleStaff, RoleAdmin))
+	if !ok {
+		return
+	}
+	history, err := h.store.Orders().History(c.Request.Context(), order.ID)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+// changeOrderStatus moves order to status on behalf of actor. Transitions the
+// table does not allow, including ones made impossible by a concurrent
+// change, are rejected with 409 and the statuses that are allowed.
+func (h *handler) changeOrderStatus(c *gin.Context, order *Order, status string, actor *User, note string) {
+	ctx := c.Request.Context()
+	if canTransition(order.Status, status) {
+		change := &OrderStatusChange{
+			OrderID:    order.ID,
+			FromStatus: order.Status,
+			ToStatus:   status,
+			ActorID:    actor.ID,
+			Note:       note,
+		}
+		err := h.store.Orders().ChangeStatus(ctx, change)
+		if err == nil {
+			order.Status = status
+			c.JSON(http.StatusOK, order)
+			return
+		}
+		if !errors.Is(err, ErrConflict) {
+			internalError(c, err)
+			return
+		}
+		// Someone else changed the status first; report against the
+		// current one.
+		if order, err = h.store.Orders().Get(ctx, order.ID); err != nil {
+			internalError(c, err)
+			return
+		}
+	}
+	c.JSON(http.StatusConflict, gin.H{
+		"error":   "Cannot change order status from " + order.Status + " to " + status,
+		"status":  order.Status,
+		"allowed": nextOrderStatuses(order.Status),
+	})
+}
+
+// loadOrder fetches the order named by the :id parameter with its line
+// items. Unless anyUser is set, orders of other users are reported as not
+// found.
+func (h *handler) loadOrder(c *gin.Context, user *User, anyUser bool) (*Order, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order id"})
+		return nil, false
+	}
+	order, err := h.store.Orders().Get(c.Request.Context(), uint(id))
+	if errors.Is(err, ErrNotFound) || (err == nil && !anyUser && order.UserID != user.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return nil, false
+	}
+	if err != nil {
+		internalError(c, err)
+		return nil, false
+	}
+	return order, true
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"fullstack-shopping-cart/money"
+)
+
+// placeOrder checks out a cart of one lamp for the customer whose access
+// token is given and returns the order.
+func (s *testServer) placeOrder(token string) Order {
+	s.t.Helper()
+	item := &Item{Name: "Lamp", Price: money.New(1000, DefaultCurrency), StockQuantity: 5}
+	if err := s.store.Items().Create(context.Background(), item); err != nil {
+		s.t.Fatal(err)
+	}
+	var line struct {
+		CartID uint `json:"cartId"`
+	}
+	s.decode(s.do(http.MethodPost, "/carts", token, map[string]any{"itemId": item.ID}), http.StatusOK, &line)
+	var order Order
+	s.decode(s.do(http.MethodPost, "/orders", token, map[string]any{"cartId": line.CartID}), http.StatusCreated, &order)
+	return order
+}
+
+func TestChangeOrderStatus(t *testing.T) {
+	s := newTestServer(t, Config{})
+	s.createUser("alice")
+	s.createUser("staff", RoleStaff)
+	customer, _ := s.login("alice")
+	staff, _ := s.login("staff")
+	order := s.placeOrder(customer)
+	path := fmt.Sprintf("/orders/%d", order.ID)
+
+	type conflict struct {
+		Error   string   `json:"error"`
+		Status  string   `json:"status"`
+		Allowed []string `json:"allowed"`
+	}
+	steps := []struct {
+		name        string
+		token       string
+		target      string
+		status      string
+		want        int
+		wantAllowed []string
+	}{
+		{"skipping ahead", staff, path + "/status", OrderShipped, http.StatusConflict, []string{OrderPaid, OrderCancelled}},
+		{"unknown status", staff, path + "/status", "lost", http.StatusBadRequest, nil},
+		{"paid", staff, path + "/status", OrderPaid, http.StatusOK, nil},
+		{"back to pending", staff, path + "/status", OrderPending, http.StatusConflict, []string{OrderFulfilled, OrderRefunded}},
+		{"customer cancels once paid", customer, path + "/cancel", "", http.StatusConflict, []string{OrderFulfilled, OrderRefunded}},
+		{"refunded", staff, path + "/status", OrderRefunded, http.StatusOK, nil},
+		{"out of a final status", staff, path + "/status", OrderPaid, http.StatusConflict, []string{}},
+	}
+	for _, step := range steps {
+		var body any
+		if step.status != "" {
+			body = map[string]string{"status": step.status}
+		}
+		w := s.do(http.MethodPost, step.target, step.token, body)
+		if w.Code != step.want {
+			t.Fatalf("%s: status = %d; want %d; body %s", step.name, w.Code, step.want, w.Body)
+		}
+		if step.want == http.StatusConflict {
+			var resp conflict
+			s.decode(w, http.StatusConflict, &resp)
+			if resp.Error == "" || !slices.Equal(resp.Allowed, step.wantAllowed) {
+				t.Errorf("%s: response %+v; want allowed %v", step.name, resp, step.wantAllowed)
+			}
+		}
+	}
+
+	// Only the transitions that were allowed made it into the history.
+	var history []OrderStatusChange
+	s.decode(s.do(http.MethodGet, path+"/history", customer, nil), http.StatusOK, &history)
+	var got []string
+	for _, change := range history {
+		got = append(got, change.ToStatus)
+	}
+	if want := []string{OrderPending, OrderPaid, OrderRefunded}; !slices.Equal(got, want) {
+		t.Errorf("history = %v; want %v", got, want)
+	}
+}
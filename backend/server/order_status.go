@@ -0,0 +1,55 @@
+package server
+
+// Order statuses. New orders are pending; cancelled and refunded are final.
+const (
+	OrderPending   = "pending"
+	OrderPaid      = "paid"
+	OrderFulfilled = "fulfilled"
+	OrderShipped   = "shipped"
+	OrderDelivered = "delivered"
+	OrderCancelled = "cancelled"
+	OrderRefunded  = "refunded"
+)
+
+// orderTransitions lists the statuses each status may move to. Statuses not
+// listed as keys are unknown.
+var orderTransitions = map[string][]string{
+	OrderPending:   {OrderPaid, OrderCancelled},
+	OrderPaid:      {OrderFulfilled, OrderRefunded},
+	OrderFulfilled: {OrderShipped, OrderRefunded},
+	OrderShipped:   {OrderDelivered},
+	OrderDelivered: {OrderRefunded},
+	OrderCancelled: {},
+	OrderRefunded:  {},
+}
+
+// validOrderStatus reports whether status is one of the Order constants.
+func validOrderStatus(status string) bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+// nextOrderStatuses returns the statuses an order in status may move to.
+func nextOrderStatuses(status string) []string {
+	return orderTransitions[status]
+}
+
+// canTransition reports whether an order may move from one status to
+// another.
+func canTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ReturnsStock reports whether moving an order from one status to another
+// puts its units back in stock: when it is cancelled, or refunded before it
+// was shipped, while the goods are still on the shelf. Refunding a shipped
+// or delivered order leaves stock alone, since whatever the customer sends
+// back has to be checked before it can be sold again.
+func ReturnsStock(from, to string) bool {
+	return to == OrderCancelled || (to == OrderRefunded && (from == OrderPaid || from == OrderFulfilled))
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes new passwords with one algorithm and verifies hashes
+// produced by any supported one, so the algorithm or its parameters can
+// change without locking out existing accounts.
+type PasswordHasher interface {
+	// Hash returns an encoded hash that carries its own algorithm, salt
+	// and parameters.
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded, and whether encoded
+	// should be replaced by a fresh Hash because it uses an outdated
+	// algorithm or parameters.
+	Verify(password, encoded string) (ok, needsRehash bool)
+}
+
+// NewPasswordHasher returns the hasher for algorithm, "argon2id" (the
+// default when empty) or "bcrypt", with recommended parameters.
+func NewPasswordHasher(algorithm string) (PasswordHasher, error) {
+	switch algorithm {
+	case "", "argon2id":
+		return DefaultArgon2idHasher(), nil
+	case "bcrypt":
+		return BcryptHasher{Cost: bcrypt.DefaultCost}, nil
+	}
+	return nil, fmt.Errorf("unknown password hash algorithm %q", algorithm)
+}
+
+// Argon2idHasher hashes passwords with argon2id and encodes them in the PHC
+// string format: $argon2id$v=19$m=<KiB>,t=<iterations>,p=<threads>$<salt>$<key>
+type Argon2idHasher struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idHasher uses the OWASP recommended minimum parameters.
+func DefaultArgon2idHasher() Argon2idHasher {
+	return Argon2idHasher{
+		Memory:      19 * 1024,
+		Iterations:  2,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) Verify(password, encoded string) (ok, needsRehash bool) {
+	if !verifyPassword(password, encoded) {
+		return false, false
+	}
+	p, err := parseArgon2id(encoded)
+	if err != nil {
+		return true, true
+	}
+	current := p.Memory == h.Memory && p.Iterations == h.Iterations &&
+		p.Parallelism == h.Parallelism && p.KeyLength == h.KeyLength
+	return true, !current
+}
+
+// BcryptHasher hashes passwords with bcrypt at Cost.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h BcryptHasher) Verify(password, encoded string) (ok, needsRehash bool) {
+	if !verifyPassword(password, encoded) {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return true, err != nil || cost != h.Cost
+}
+
+// verifyPassword checks password against a hash in any supported format:
+// argon2id, bcrypt, or the legacy unsalted hex SHA-256.
+func verifyPassword(password, encoded string) bool {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		p, err := parseArgon2id(encoded)
+		if err != nil {
+			return false
+		}
+		key := argon2.IDKey([]byte(password), p.salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+		return subtle.ConstantTimeCompare(key, p.key) == 1
+
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+
+	case len(encoded) == sha256.Size*2:
+		want, err := hex.DecodeString(encoded)
+		if err != nil {
+			return false
+		}
+		got := sha256.Sum256([]byte(password))
+		return subtle.ConstantTimeCompare(got[:], want) == 1
+	}
+	return false
+}
+
+type argon2idHash struct {
+	Argon2idHasher
+	salt []byte
+	key  []byte
+}
+
+var errMalformedHash = errors.New("malformed password hash")
+
+func parseArgon2id(encoded string) (*argon2idHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, errMalformedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, errMalformedHash
+	}
+	var p argon2idHash
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return nil, errMalformedHash
+	}
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, errMalformedHash
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, errMalformedHash
+	}
+	p.SaltLength = uint32(len(p.salt))
+	p.KeyLength = uint32(len(p.key))
+	return &p, nil
+}
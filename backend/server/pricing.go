@@ -0,0 +1,65 @@
+package server
+
+import (
+	"fmt"
+	"math/big"
+
+	"fullstack-shopping-cart/money"
+)
+
+// Pricing holds the rules that turn a cart subtotal into an order total.
+// The zero value charges no tax and no shipping.
+type Pricing struct {
+	// TaxRate is applied to the subtotal after discounts, e.g. 0.08 for 8%.
+	// Nil charges no tax.
+	TaxRate *big.Rat
+
+	// ShippingFee is charged per order.
+	ShippingFee money.Money
+
+	// FreeShippingOver waives the shipping fee for subtotals of at least
+	// this amount. Zero never waives it.
+	FreeShippingOver money.Money
+}
+
+// OrderTotals is the breakdown of what an order costs, all in the currency
+// of the subtotal.
+type OrderTotals struct {
+	Subtotal money.Money
+	Discount money.Money
+	Tax      money.Money
+	Shipping money.Money
+	Total    money.Money
+}
+
+// Totals computes the totals for an order with the given subtotal. Tax is
+// rounded half to even. There are no promotions yet, so Discount is always
+// zero. It returns an error if the fees are in another currency than the
+// subtotal.
+func (p Pricing) Totals(subtotal money.Money) (OrderTotals, error) {
+	for _, fee := range []money.Money{p.ShippingFee, p.FreeShippingOver} {
+		if _, err := money.Sum(subtotal, fee); err != nil {
+			return OrderTotals{}, fmt.Errorf("pricing: %w", err)
+		}
+	}
+	zero := money.New(0, subtotal.Currency)
+	t := OrderTotals{Subtotal: subtotal, Discount: zero, Shipping: zero}
+	t.Tax = t.Subtotal.Sub(t.Discount).MulRat(p.TaxRate)
+	if p.FreeShippingOver.IsZero() || t.Subtotal.Cmp(p.FreeShippingOver) < 0 {
+		t.Shipping = zero.Add(p.ShippingFee)
+	}
+	t.Total = t.Subtotal.Sub(t.Discount).Add(t.Tax).Add(t.Shipping)
+	return t, nil
+}
+
+// allocateDiscount splits the order's discount over its lines in proportion
+// to their totals, so that every minor unit of it lands on exactly one line.
+func allocateDiscount(order *Order) {
+	weights := make([]int64, len(order.OrderItems))
+	for i, line := range order.OrderItems {
+		weights[i] = line.LineTotal.Amount
+	}
+	for i, share := range order.Discount.Allocate(weights...) {
+		order.OrderItems[i].Discount = share
+	}
+}
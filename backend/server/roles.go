@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// Roles a user can hold. Every user is a customer; staff manage the catalog
+// and admins additionally manage users.
+const (
+	RoleCustomer = "customer"
+	RoleStaff    = "staff"
+	RoleAdmin    = "admin"
+)
+
+// validRole reports whether role is one of the Role constants.
+func validRole(role string) bool {
+	return role == RoleCustomer || role == RoleStaff || role == RoleAdmin
+}
+
+// Roles is a set of roles, stored as a comma-separated column.
+type Roles []string
+
+// Has reports whether any of roles is in r.
+func (r Roles) Has(roles ...string) bool {
+	for _, role := range roles {
+		if slices.Contains(r, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// With returns a copy of r that includes role.
+func (r Roles) With(role string) Roles {
+	out := slices.Clone(r)
+	if !out.Has(role) {
+		out = append(out, role)
+		slices.Sort(out)
+	}
+	return out
+}
+
+// Without returns a copy of r that excludes role.
+func (r Roles) Without(role string) Roles {
+	return slices.DeleteFunc(slices.Clone(r), func(have string) bool { return have == role })
+}
+
+// Value implements driver.Valuer.
+func (r Roles) Value() (driver.Value, error) {
+	return strings.Join(r, ","), nil
+}
+
+// Scan implements sql.Scanner.
+func (r *Roles) Scan(src any) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("roles: cannot scan %T", src)
+	}
+	*r = nil
+	for _, role := range strings.Split(s, ",") {
+		if role != "" {
+			*r = append(*r, role)
+		}
+	}
+	return nil
+}
+
+// EnsureAdmin creates an admin account with the given credentials unless a
+// user with that name already exists. An existing user is left untouched
+// so that someone who registered the name first cannot be promoted by it.
+func EnsureAdmin(ctx context.Context, store Store, passwords PasswordHasher, username, password string) error {
+	_, err := store.Users().GetByUsername(ctx, username)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if password == "" {
+		return errors.New("admin password must not be empty")
+	}
+	hash, err := passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+	user := &User{
+		Username:     username,
+		PasswordHash: hash,
+		Roles:        Roles{RoleAdmin, RoleCustomer},
+	}
+	err = store.Users().Create(ctx, user)
+	if errors.Is(err, ErrConflict) {
+		// Another instance created it concurrently.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Created admin user %q", username)
+	return nil
+}
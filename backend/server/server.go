@@ -0,0 +1,305 @@
+// Package server contains the HTTP API shared by the standalone backend
+// binary and the Vercel serverless function.
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"fullstack-shopping-cart/media"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Config controls how NewRouter builds the API.
+type Config struct {
+	// Prefix is prepended to every route, e.g. "/api" for Vercel where the
+	// function is mounted under /api. Leave empty to serve from "/".
+	Prefix string
+
+	// AllowOrigin is sent as Access-Control-Allow-Origin. CORS handling is
+	// disabled when it is empty.
+	AllowOrigin string
+
+	// RequestLogging enables gin's request logger.
+	RequestLogging bool
+
+	// Store persists users, items, carts and orders. NewRouter uses a fresh
+	// in-memory store when it is nil.
+	Store Store
+
+	// PasswordHasher hashes new passwords. Defaults to argon2id.
+	PasswordHasher PasswordHasher
+
+	// SessionTTL is how long a refresh token stays valid. Defaults to
+	// DefaultSessionTTL.
+	SessionTTL time.Duration
+
+	// SigningKeys sign and verify access tokens; the first one signs. When
+	// empty a random key is generated, which only works for a single
+	// long-lived process: tokens stop validating on restart.
+	SigningKeys []SigningKey
+
+	// AccessTokenTTL is how long an access token stays valid. Defaults to
+	// DefaultAccessTokenTTL.
+	AccessTokenTTL time.Duration
+
+	// Currency is the ISO 4217 code catalog prices are in. Prices in other
+	// currencies are set per item or converted at the exchange rates
+	// admins enter. Defaults to DefaultCurrency.
+	Currency string
+
+	// Pricing computes tax and shipping at checkout.
+	Pricing Pricing
+
+	// IdempotencyTTL is how long responses to requests with an
+	// Idempotency-Key are kept for replay. Defaults to
+	// DefaultIdempotencyTTL.
+	IdempotencyTTL time.Duration
+
+	// CartReservationTTL is how long adding an item to a cart holds its
+	// stock for that cart. Zero disables reservations: stock is only taken
+	// at checkout.
+	CartReservationTTL time.Duration
+
+	// Media stores uploaded item images and their thumbnails. Uploads
+	// respond 503 when it is nil.
+	Media media.Storage
+
+	// MaxImageBytes caps the size of an uploaded image. Defaults to
+	// DefaultMaxImageBytes.
+	MaxImageBytes int64
+
+	// SearchRefreshInterval is how old the search index may get before a
+	// search rebuilds it from the store. Zero never rebuilds it, which is
+	// only right for a single instance: the index sees its own instance's
+	// item changes but not other instances'.
+	SearchRefreshInterval time.Duration
+}
+
+// DefaultCurrency is used when Config.Currency is empty.
+const DefaultCurrency = "USD"
+
+// handler holds the dependencies shared by the HTTP handlers.
+type handler struct {
+	store      Store
+	passwords  PasswordHasher
+	tokens     *AccessTokens
+	sessionTTL time.Duration
+	currency   string
+	pricing    Pricing
+
+	// reservationTTL is Config.CartReservationTTL.
+	reservationTTL time.Duration
+
+	// media is Config.Media; image uploads are disabled when it is nil.
+	media         media.Storage
+	maxImageBytes int64
+
+	// catalog is the search index of the items that are not archived. It
+	// is built at startup, kept current by the item handlers and rebuilt
+	// every Config.SearchRefreshInterval.
+	catalog *catalogIndex
+
+	// dummyPasswordHash is verified against when a login names an unknown
+	// user so that the response takes as long as for a wrong password.
+	dummyPasswordHash string
+}
+
+// NewRouter returns a gin engine with every API route registered.
+func NewRouter(cfg Config) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	if cfg.RequestLogging {
+		router.Use(gin.Logger())
+	}
+	if cfg.AllowOrigin != "" {
+		router.Use(corsMiddleware(cfg.AllowOrigin))
+	}
+
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore()
+	}
+	if cfg.PasswordHasher == nil {
+		cfg.PasswordHasher = DefaultArgon2idHasher()
+	}
+	dummyPasswordHash, err := cfg.PasswordHasher.Hash("dummy password")
+	if err != nil {
+		panic(fmt.Sprintf("server: hash dummy password: %v", err))
+	}
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = DefaultSessionTTL
+	}
+	if cfg.Currency == "" {
+		cfg.Currency = DefaultCurrency
+	}
+	if cfg.IdempotencyTTL <= 0 {
+		cfg.IdempotencyTTL = DefaultIdempotencyTTL
+	}
+	if cfg.MaxImageBytes <= 0 {
+		cfg.MaxImageBytes = DefaultMaxImageBytes
+	}
+	if cfg.AccessTokenTTL <= 0 {
+		cfg.AccessTokenTTL = DefaultAccessTokenTTL
+	}
+	if len(cfg.SigningKeys) == 0 {
+		key, err := ephemeralSigningKey()
+		if err != nil {
+			panic(fmt.Sprintf("server: generate signing key: %v", err))
+		}
+		log.Printf("No access-token signing keys configured; using an ephemeral key (%s)", key.ID)
+		cfg.SigningKeys = []SigningKey{key}
+	}
+	tokens, err := NewAccessTokens(cfg.SigningKeys, cfg.AccessTokenTTL)
+	if err != nil {
+		panic(fmt.Sprintf("server: %v", err))
+	}
+	catalog, err := newCatalogIndex(context.Background(), cfg.Store, cfg.SearchRefreshInterval)
+	if err != nil {
+		panic(fmt.Sprintf("server: index catalog: %v", err))
+	}
+	h := &handler{
+		store:             cfg.Store,
+		passwords:         cfg.PasswordHasher,
+		tokens:            tokens,
+		sessionTTL:        cfg.SessionTTL,
+		currency:          cfg.Currency,
+		pricing:           cfg.Pricing,
+		reservationTTL:    cfg.CartReservationTTL,
+		media:             cfg.Media,
+		maxImageBytes:     cfg.MaxImageBytes,
+		catalog:           catalog,
+		dummyPasswordHash: dummyPasswordHash,
+	}
+
+	api := router.Group(strings.TrimSuffix(cfg.Prefix, "/"))
+
+	// Health check
+	api.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	// User endpoints
+	api.POST("/users", h.createNewUser)
+	api.POST("/users/login", h.handleUserLogin)
+	api.POST("/users/token/refresh", h.handleTokenRefresh)
+	userGroup := api.Group("/users")
+	userGroup.Use(AuthMiddleware(tokens))
+	{
+		userGroup.GET("/me", h.fetchCurrentUser)
+		userGroup.POST("/logout", h.handleUserLogout)
+		userGroup.POST("/logout-all", h.handleUserLogoutAll)
+	}
+
+	// User administration (admins only)
+	adminGroup := api.Group("/users")
+	adminGroup.Use(AuthMiddleware(tokens), RequireRole(RoleAdmin))
+	{
+		adminGroup.GET("", h.listAllUsers)
+		adminGroup.POST("/:id/roles", h.grantUserRole)
+		adminGroup.DELETE("/:id/roles/:role", h.revokeUserRole)
+	}
+
+	// Item endpoints
+	api.GET("/items", h.listAllItems)
+	// The search index is per process; see Config.SearchRefreshInterval
+	// for instances sharing a store.
+	api.GET("/items/search", h.searchItems)
+	api.GET("/items/:id", h.fetchItem)
+	catalogGroup := api.Group("/items")
+	catalogGroup.Use(AuthMiddleware(tokens), RequireRole(RoleStaff, RoleAdmin))
+	{
+		catalogGroup.POST("", h.createNewItem)
+		catalogGroup.PUT("/:id", h.replaceItem)
+		catalogGroup.PATCH("/:id", h.patchItem)
+		catalogGroup.DELETE("/:id", h.archiveItem)
+		catalogGroup.PUT("/:id/stock", h.setItemStock)
+		catalogGroup.GET("/:id/prices", h.listItemPrices)
+		catalogGroup.PUT("/:id/prices/:currency", h.setItemPrice)
+		catalogGroup.DELETE("/:id/prices/:currency", h.deleteItemPrice)
+		catalogGroup.POST("/:id/variants", h.createVariant)
+		catalogGroup.PUT("/:id/variants/:variantId", h.replaceVariant)
+		catalogGroup.DELETE("/:id/variants/:variantId", h.deleteVariant)
+		catalogGroup.POST("/:id/images", h.uploadItemImage)
+		catalogGroup.PUT("/:id/images", h.arrangeItemImages)
+		catalogGroup.DELETE("/:id/images/:imageId", h.deleteItemImage)
+	}
+
+	// Category endpoints (admins manage the taxonomy)
+	api.GET("/categories", h.listCategories)
+	api.GET("/categories/:slug/items", h.listCategoryItems)
+	taxonomyGroup := api.Group("/categories")
+	taxonomyGroup.Use(AuthMiddleware(tokens), RequireRole(RoleAdmin))
+	{
+		taxonomyGroup.POST("", h.createCategory)
+		taxonomyGroup.PUT("/:id", h.replaceCategory)
+		taxonomyGroup.DELETE("/:id", h.deleteCategory)
+	}
+
+	// Exchange rate endpoints (admins manage them)
+	api.GET("/exchange-rates", h.listExchangeRates)
+	rateGroup := api.Group("/exchange-rates")
+	rateGroup.Use(AuthMiddleware(tokens), RequireRole(RoleAdmin))
+	{
+		rateGroup.POST("", h.createExchangeRate)
+		rateGroup.DELETE("/:id", h.deleteExchangeRate)
+	}
+
+	// Cart endpoints (protected)
+	cartGroup := api.Group("/carts")
+	cartGroup.Use(AuthMiddleware(tokens))
+	{
+		cartGroup.POST("", idempotent(cfg.Store, cfg.IdempotencyTTL), h.addItemToCart)
+		cartGroup.GET("", h.fetchCartItems)
+		cartGroup.DELETE("", h.clearCart)
+		cartGroup.PUT("/items/:itemId", h.updateCartItem)
+		cartGroup.DELETE("/items/:itemId", h.removeCartItem)
+	}
+
+	// Order endpoints (protected)
+	orderGroup := api.Group("/orders")
+	orderGroup.Use(AuthMiddleware(tokens))
+	{
+		orderGroup.POST("", idempotent(cfg.Store, cfg.IdempotencyTTL), h.createOrder)
+		orderGroup.GET("", h.orderHistoryList)
+		orderGroup.GET("/:id", h.fetchOrder)
+		orderGroup.POST("/:id/cancel", h.cancelOrder)
+		orderGroup.GET("/:id/history", h.orderStatusHistory)
+	}
+
+	// Order fulfilment (staff)
+	fulfilmentGroup := api.Group("/orders")
+	fulfilmentGroup.Use(AuthMiddleware(tokens), RequireRole(RoleStaff, RoleAdmin))
+	{
+		fulfilmentGroup.POST("/:id/status", h.updateOrderStatus)
+	}
+
+	return router
+}
+
+func corsMiddleware(allowOrigin string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", allowOrigin)
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key, If-Match, "+CurrencyHeader)
+		c.Header("Access-Control-Expose-Headers", "ETag")
+
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// internalError logs err and responds with a generic 500 so storage details
+// never reach the client.
+func internalError(c *gin.Context, err error) {
+	log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+}
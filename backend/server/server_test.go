@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testServer is a router on an in-memory store, with helpers to call it as
+// one of its users.
+type testServer struct {
+	t      *testing.T
+	store  Store
+	router *gin.Engine
+}
+
+// newTestServer builds a router from cfg, filling in an in-memory store and
+// a fast password hasher.
+func newTestServer(t *testing.T, cfg Config) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore()
+	}
+	if cfg.PasswordHasher == nil {
+		cfg.PasswordHasher = BcryptHasher{Cost: bcrypt.MinCost}
+	}
+	return &testServer{t: t, store: cfg.Store, router: NewRouter(cfg)}
+}
+
+// createUser adds a user with password "password" and roles besides
+// customer.
+func (s *testServer) createUser(username string, roles ...string) *User {
+	s.t.Helper()
+	hash, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash("password")
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	user := &User{Username: username, PasswordHash: hash, Roles: Roles{RoleCustomer}}
+	for _, role := range roles {
+		user.Roles = user.Roles.With(role)
+	}
+	if err := s.store.Users().Create(context.Background(), user); err != nil {
+		s.t.Fatal(err)
+	}
+	return user
+}
+
+// login logs username in and returns the access and refresh tokens.
+func (s *testServer) login(username string) (token, refreshToken string) {
+	s.t.Helper()
+	var resp struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refreshToken"`
+	}
+	w := s.do(http.MethodPost, "/users/login", "", gin.H{"username": username, "password": "password"})
+	s.decode(w, http.StatusOK, &resp)
+	return resp.Token, resp.RefreshToken
+}
+
+// do sends a request with body encoded as JSON, or without a body if it is
+// nil, authorized with token unless it is empty.
+func (s *testServer) do(method, target, token string, body any) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, target, r)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return s.send(req, token)
+}
+
+// send serves req, authorized with token unless it is empty.
+func (s *testServer) send(req *http.Request, token string) *httptest.ResponseRecorder {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// decode checks that w has status and decodes its body into v.
+func (s *testServer) decode(w *httptest.ResponseRecorder, status int, v any) {
+	s.t.Helper()
+	if w.Code != status {
+		s.t.Fatalf("status = %d; want %d; body %s", w.Code, status, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		s.t.Fatalf("decode %s: %v", w.Body, err)
+	}
+}
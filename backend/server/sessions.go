@@ -0,0 +1,37 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// DefaultSessionTTL is how long a refresh token stays valid when
+// Config.SessionTTL is zero.
+const DefaultSessionTTL = 30 * 24 * time.Hour
+
+// newSessionToken returns a random refresh token and the hash to store for it.
+func newSessionToken() (token, tokenHash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(b)
+	return token, hashSessionToken(token), nil
+}
+
+func hashSessionToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// newSessionFamily returns a random ID shared by all sessions rotated from
+// one login.
+func newSessionFamily() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,334 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"fullstack-shopping-cart/money"
+)
+
+// Errors returned by Store implementations. Callers should compare with
+// errors.Is since implementations may wrap them.
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+
+	// ErrCategoryCycle is returned for moving a category under itself or
+	// one of its descendants.
+	ErrCategoryCycle = errors.New("category cycle")
+
+	// ErrQuantityTooLarge is returned for adding units to a cart line that
+	// would then hold more than MaxCartQuantity.
+	ErrQuantityTooLarge = errors.New("quantity too large")
+)
+
+// StockShortage is a request for more units of an item, or of one of its
+// variants, than are available.
+type StockShortage struct {
+	ItemID    uint `json:"itemId"`
+	VariantID uint `json:"variantId,omitempty"`
+	Requested int  `json:"requested"`
+	Available int  `json:"available"`
+}
+
+// InsufficientStockError lists every line of an order, or the cart line,
+// that stock cannot cover.
+type InsufficientStockError struct {
+	Shortages []StockShortage
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("insufficient stock for %d items", len(e.Shortages))
+}
+
+// Store is the persistence layer used by the HTTP handlers.
+type Store interface {
+	Users() UserRepository
+	Items() ItemRepository
+	Carts() CartRepository
+	Orders() OrderRepository
+	Sessions() SessionRepository
+	Idempotency() IdempotencyRepository
+	ExchangeRates() ExchangeRateRepository
+	Categories() CategoryRepository
+	Variants() VariantRepository
+	ItemImages() ItemImageRepository
+}
+
+// UserRepository persists user accounts.
+type UserRepository interface {
+	// Create assigns user.ID and user.CreatedAt. It returns ErrConflict if
+	// the username is already taken.
+	Create(ctx context.Context, user *User) error
+	Get(ctx context.Context, id uint) (*User, error)
+	GetByUsername(ctx context.Context, username string) (*User, error)
+	List(ctx context.Context) ([]User, error)
+	// SetPasswordHash replaces the user's stored password hash.
+	SetPasswordHash(ctx context.Context, id uint, hash string) error
+	// SetRoles replaces the user's roles.
+	SetRoles(ctx context.Context, id uint, roles Roles) error
+	// GrantRole adds role to the user's roles and RevokeRole removes it.
+	// Each reads and writes the roles as one atomic step, so concurrent
+	// changes of different roles are all kept. They return the updated
+	// user and whether its roles changed.
+	GrantRole(ctx context.Context, id uint, role string) (*User, bool, error)
+	RevokeRole(ctx context.Context, id uint, role string) (*User, bool, error)
+}
+
+// SessionRepository persists refresh-token sessions.
+type SessionRepository interface {
+	// Create assigns session.ID.
+	Create(ctx context.Context, session *Session) error
+	Get(ctx context.Context, id uint) (*Session, error)
+	GetByTokenHash(ctx context.Context, tokenHash string) (*Session, error)
+	// MarkRotated sets RotatedAt and LastSeenAt to at if the session has
+	// not been rotated yet. It returns ErrConflict if it already was, so
+	// two concurrent refreshes with the same token cannot both succeed.
+	MarkRotated(ctx context.Context, id uint, at time.Time) error
+	// DeleteFamily revokes every session descended from the same login and
+	// returns how many there were.
+	DeleteFamily(ctx context.Context, familyID string) (int64, error)
+	// DeleteByUser revokes every session of the user and returns how many
+	// there were.
+	DeleteByUser(ctx context.Context, userID uint) (int64, error)
+	// DeleteExpired removes sessions that expired before now and returns
+	// how many there were.
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// IdempotencyRepository persists the responses replayed for retried
+// requests.
+type IdempotencyRepository interface {
+	// Reserve stores record, assigning record.ID. It returns ErrConflict if
+	// the user already has a record with the same key.
+	Reserve(ctx context.Context, record *IdempotencyRecord) error
+	Get(ctx context.Context, userID uint, key string) (*IdempotencyRecord, error)
+	// Complete stores the response for a reserved record.
+	Complete(ctx context.Context, id uint, statusCode int, body string) error
+	Delete(ctx context.Context, id uint) error
+	// DeleteExpired removes records that expired before now and returns how
+	// many there were.
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// Fields item listings can be sorted by. Ties are broken by ID, so every
+// order is total and pages never overlap.
+const (
+	ItemSortID        = "id"
+	ItemSortPrice     = "price"
+	ItemSortName      = "name"
+	ItemSortCreatedAt = "createdAt"
+)
+
+// ItemListOptions selects and orders the items ItemRepository.List returns.
+// The zero value lists every item by ID.
+type ItemListOptions struct {
+	// SortBy is one of the ItemSort constants; empty means ItemSortID.
+	SortBy string
+	Desc   bool
+
+	// After continues a listing after this item, which needs only its ID
+	// and the field named by SortBy set. For ItemSortPrice that is the
+	// price the listing goes by.
+	After *Item
+
+	// Limit caps the number of items returned; zero means no limit.
+	Limit int
+
+	// MinPrice and MaxPrice bound the price the listing goes by.
+	MinPrice *money.Money
+	MaxPrice *money.Money
+
+	// Currency, unless empty, makes the listing go by prices in it rather
+	// than in the shop's currency: an item's own price in Currency if it
+	// has one and otherwise its price in minor units times Factor, rounded
+	// half to even. money.ConversionFactor gives the Factor that matches
+	// money.Money.Convert.
+	Currency string
+	Factor   *big.Rat
+
+	// CategoryIDs keeps only items in at least one of these categories;
+	// empty means any.
+	CategoryIDs []uint
+}
+
+// ItemRepository persists the product catalog.
+type ItemRepository interface {
+	// Create assigns item.ID, item.CreatedAt and item.UpdatedAt, sets
+	// item.Version to 1 and puts the item in item.Categories, which must
+	// exist. item.Variants and item.Images are ignored; see
+	// VariantRepository and ItemImageRepository.
+	Create(ctx context.Context, item *Item) error
+	// Get returns the item, with Categories, Variants and Images
+	// populated, even if it is archived. Variants are ordered by ID and
+	// Images by Position.
+	Get(ctx context.Context, id uint) (*Item, error)
+	// List returns the items that are not archived and match opts, in the
+	// order opts asks for, with Categories, Variants and Images populated.
+	List(ctx context.Context, opts ItemListOptions) ([]Item, error)
+	// Update saves the item's name, description, price, categories,
+	// options and ArchivedAt if its stored Version still equals
+	// item.Version, then increments item.Version and sets item.UpdatedAt.
+	// It returns ErrConflict if the item was updated in the meantime.
+	Update(ctx context.Context, item *Item) error
+	// SetStock replaces the item's stock quantity.
+	SetStock(ctx context.Context, id uint, quantity int) error
+	// Available returns the stock of the item, or of its variant if
+	// variantID is not zero, minus the units reserved at now by carts other
+	// than excludeCartID. It returns ErrNotFound if the variant is not one
+	// of the item's.
+	Available(ctx context.Context, id, variantID, excludeCartID uint, now time.Time) (int, error)
+	// Prices returns the item's prices in other currencies, ordered by
+	// currency.
+	Prices(ctx context.Context, id uint) ([]ItemPrice, error)
+	// SetPrice sets the item's price in price.Currency, replacing any
+	// earlier one. It returns ErrNotFound if there is no such item.
+	SetPrice(ctx context.Context, id uint, price money.Money) error
+	// DeletePrice removes the item's price in currency. It returns
+	// ErrNotFound if the item has none.
+	DeletePrice(ctx context.Context, id uint, currency string) error
+	// PricesIn returns the prices in currency of those of the given items
+	// that have one, by item ID.
+	PricesIn(ctx context.Context, currency string, ids []uint) (map[uint]money.Money, error)
+}
+
+// ExchangeRateRepository persists the rates that convert prices out of the
+// shop's currency.
+type ExchangeRateRepository interface {
+	// Create assigns rate.ID and rate.CreatedAt. It returns ErrConflict if
+	// the currency already has a rate taking effect at rate.EffectiveFrom.
+	Create(ctx context.Context, rate *ExchangeRate) error
+	// List returns the rates of currency, or of every currency if it is
+	// empty, ordered by currency and then by EffectiveFrom.
+	List(ctx context.Context, currency string) ([]ExchangeRate, error)
+	// Current returns the rate of currency in effect at the given time: the
+	// one that took effect last, not after it. It returns ErrNotFound if
+	// there is none.
+	Current(ctx context.Context, currency string, at time.Time) (*ExchangeRate, error)
+	Delete(ctx context.Context, id uint) error
+}
+
+// CategoryRepository persists the catalog taxonomy.
+type CategoryRepository interface {
+	// Create assigns category.ID, category.CreatedAt and
+	// category.UpdatedAt. It returns ErrConflict if the slug is taken and
+	// ErrNotFound if the parent does not exist.
+	Create(ctx context.Context, category *Category) error
+	Get(ctx context.Context, id uint) (*Category, error)
+	GetBySlug(ctx context.Context, slug string) (*Category, error)
+	// List returns every category, ordered by SortOrder, then name, then
+	// ID.
+	List(ctx context.Context) ([]Category, error)
+	// Update saves the category's parent, slug, name and sort order and
+	// sets category.UpdatedAt. It returns ErrCategoryCycle if the new
+	// parent is the category itself or one of its descendants,
+	// ErrConflict if the slug is taken and ErrNotFound if the category or
+	// its parent does not exist.
+	Update(ctx context.Context, category *Category) error
+	// Delete removes the category and takes its items out of it. It
+	// returns ErrConflict if the category has subcategories.
+	Delete(ctx context.Context, id uint) error
+}
+
+// VariantRepository persists the variants of items.
+type VariantRepository interface {
+	// Create assigns variant.ID, variant.CreatedAt and variant.UpdatedAt.
+	// It returns ErrConflict if the SKU is taken or the item already has a
+	// variant with the same options, and ErrNotFound if there is no such
+	// item.
+	Create(ctx context.Context, variant *Variant) error
+	Get(ctx context.Context, id uint) (*Variant, error)
+	// Update saves the variant's SKU, options, price, stock and barcode and
+	// sets variant.UpdatedAt. It returns ErrConflict as Create does.
+	Update(ctx context.Context, variant *Variant) error
+	// Delete removes the variant and every cart line for it. Orders keep
+	// the SKU and options they were placed with.
+	Delete(ctx context.Context, id uint) error
+}
+
+// ItemImageRepository persists the records of item images. The files are
+// kept in media storage by the handlers.
+type ItemImageRepository interface {
+	// Create assigns image.ID and image.CreatedAt and puts the image after
+	// the item's others, setting image.Position. The image becomes the
+	// item's primary one if image.Primary is set or the item has no other
+	// images. It returns ErrNotFound if there is no such item and
+	// ErrConflict if the key is taken.
+	Create(ctx context.Context, image *ItemImage) error
+	// Arrange orders the item's images as ids lists them and makes the one
+	// with primaryID its primary image. It returns ErrConflict if ids are
+	// not exactly the item's images, which happens if they changed in the
+	// meantime.
+	Arrange(ctx context.Context, itemID uint, ids []uint, primaryID uint) error
+	// Delete removes the image and closes the gap it leaves in the order.
+	// If it was the item's primary image, the first remaining one takes
+	// its place.
+	Delete(ctx context.Context, id uint) error
+}
+
+// MaxCartQuantity is the most units a cart line may hold.
+const MaxCartQuantity = 999
+
+// CartRepository persists carts and their lines.
+type CartRepository interface {
+	// GetByUser returns the user's cart with CartItems and their Item,
+	// including its Variants and Images, and Variant populated.
+	GetByUser(ctx context.Context, userID uint) (*Cart, error)
+	// GetOrCreateForUser returns the user's cart, creating an empty one if
+	// none exists yet.
+	GetOrCreateForUser(ctx context.Context, userID uint) (*Cart, error)
+	// AddItem adds cartItem.Quantity units of cartItem.ItemID and
+	// cartItem.VariantID to its cart, merging them into the existing line
+	// for that item and variant if there is one, and sets the line's
+	// ReservedUntil to cartItem.ReservedUntil. cartItem is updated to the
+	// resulting line. It returns an *InsufficientStockError, and changes
+	// nothing, if stock less what other carts have reserved cannot cover
+	// the resulting line. The check and the change are one atomic step, so
+	// concurrent carts cannot together reserve more than is in stock. It
+	// returns ErrQuantityTooLarge, and changes nothing, if the line would
+	// hold more than MaxCartQuantity units.
+	AddItem(ctx context.Context, cartItem *CartItem) error
+	// SetItemQuantity sets the quantity and reservation of the line for
+	// the item and variant in the cart, creating the line if needed, and
+	// returns the line. Stock is checked as by AddItem.
+	SetItemQuantity(ctx context.Context, cartID, itemID, variantID uint, quantity int, reservedUntil *time.Time) (*CartItem, error)
+	// RemoveItem deletes the line for the item and variant from the cart.
+	// It returns ErrNotFound if the cart has no such line.
+	RemoveItem(ctx context.Context, cartID, itemID, variantID uint) error
+	// Clear deletes every line of the cart.
+	Clear(ctx context.Context, cartID uint) error
+}
+
+// OrderListOptions controls what OrderRepository.ListByUser loads.
+type OrderListOptions struct {
+	// WithItems populates each order's OrderItems.
+	WithItems bool
+}
+
+// OrderRepository persists orders and their lines.
+type OrderRepository interface {
+	// Create assigns IDs to the order and its OrderItems and stores them
+	// together with removing the given lines from cart and taking the
+	// ordered units out of stock, all or nothing. It returns ErrConflict if
+	// any of the lines was changed or removed in the meantime, so a cart
+	// cannot be checked out twice, and an *InsufficientStockError if stock,
+	// less what other carts have reserved, cannot cover every line. Lines
+	// with a variant take its stock rather than the item's. The
+	// order's first status history entry is recorded with the order's user
+	// as actor.
+	Create(ctx context.Context, order *Order, cart *Cart) error
+	// Get returns the order with OrderItems populated.
+	Get(ctx context.Context, id uint) (*Order, error)
+	ListByUser(ctx context.Context, userID uint, opts OrderListOptions) ([]Order, error)
+	// ChangeStatus moves the order from change.FromStatus to
+	// change.ToStatus and appends change to its history, assigning
+	// change.ID and change.CreatedAt. If ReturnsStock says so for the
+	// change, the order's units go back to the stock they were taken from.
+	// It returns ErrConflict if the order is no longer in FromStatus.
+	ChangeStatus(ctx context.Context, change *OrderStatusChange) error
+	// History returns the order's status changes, oldest first.
+	History(ctx context.Context, orderID uint) ([]OrderStatusChange, error)
+}
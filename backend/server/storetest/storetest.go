@@ -0,0 +1,1065 @@
+// Package storetest checks that an implementation of server.Store behaves
+// as the repository interfaces document. Every implementation runs the same
+// suite from its own tests, so the in-memory store used in development and
+// on Vercel cannot drift from the SQL one used in production.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"fullstack-shopping-cart/money"
+	"fullstack-shopping-cart/server"
+)
+
+// Run runs the suite, giving every test a new, empty store from newStore.
+func Run(t *testing.T, newStore func(t *testing.T) server.Store) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s server.Store)
+	}{
+		{"Users", testUsers},
+		{"UserRoles", testUserRoles},
+		{"Sessions", testSessions},
+		{"Idempotency", testIdempotency},
+		{"CartAddItemMerges", testCartAddItemMerges},
+		{"CartStockCheck", testCartStockCheck},
+		{"CartConcurrentReservations", testCartConcurrentReservations},
+		{"OrderCreate", testOrderCreate},
+		{"OrderCreateInsufficientStock", testOrderCreateInsufficientStock},
+		{"OrderChangeStatus", testOrderChangeStatus},
+		{"ItemUpdateVersion", testItemUpdateVersion},
+		{"ItemList", testItemList},
+		{"ItemPrices", testItemPrices},
+		{"ItemListInCurrency", testItemListInCurrency},
+		{"ExchangeRates", testExchangeRates},
+		{"CategoryCycles", testCategoryCycles},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStore(t))
+		})
+	}
+}
+
+func testUsers(t *testing.T, s server.Store) {
+	ctx := t.Context()
+	user := createUser(t, s, "alice")
+	if user.ID == 0 || user.CreatedAt.IsZero() {
+		t.Errorf("Create left ID = %d, CreatedAt = %v; want them set", user.ID, user.CreatedAt)
+	}
+	err := s.Users().Create(ctx, &server.User{Username: "alice", PasswordHash: "x", Roles: server.Roles{server.RoleCustomer}})
+	if !errors.Is(err, server.ErrConflict) {
+		t.Errorf("Create with a taken username = %v; want ErrConflict", err)
+	}
+
+	got, err := s.Users().GetByUsername(ctx, "alice")
+	if err != nil || got.ID != user.ID {
+		t.Fatalf("GetByUsername = %+v, %v; want user %d", got, err, user.ID)
+	}
+	if _, err := s.Users().Get(ctx, user.ID+1000); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("Get of a missing user = %v; want ErrNotFound", err)
+	}
+	if _, err := s.Users().GetByUsername(ctx, "nobody"); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("GetByUsername of a missing user = %v; want ErrNotFound", err)
+	}
+
+	roles := server.Roles{server.RoleAdmin, server.RoleCustomer}
+	if err := s.Users().SetRoles(ctx, user.ID, roles); err != nil {
+		t.Fatalf("SetRoles: %v", err)
+	}
+	if err := s.Users().SetPasswordHash(ctx, user.ID, "new hash"); err != nil {
+		t.Fatalf("SetPasswordHash: %v", err)
+	}
+	got, err = s.Users().Get(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !slices.Equal(got.Roles, roles) || got.PasswordHash != "new hash" {
+		t.Errorf("Get = roles %v, hash %q; want %v, %q", got.Roles, got.PasswordHash, roles, "new hash")
+	}
+}
+
+func testUserRoles(t *testing.T, s server.Store) {
+	ctx := t.Context()
+	user := createUser(t, s, "alice")
+	steps := []struct {
+		name        string
+		update      func(context.Context, uint, string) (*server.User, bool, error)
+		role        string
+		wantChanged bool
+		want        server.Roles
+	}{
+		{"grant", s.Users().GrantRole, server.RoleStaff, true, server.Roles{server.RoleCustomer, server.RoleStaff}},
+		{"grant again", s.Users().GrantRole, server.RoleStaff, false, server.Roles{server.RoleCustomer, server.RoleStaff}},
+		{"revoke", s.Users().RevokeRole, server.RoleStaff, true, server.Roles{server.RoleCustomer}},
+		{"revoke a role not held", s.Users().RevokeRole, server.RoleAdmin, false, server.Roles{server.RoleCustomer}},
+	}
+	for _, step := range steps {
+		got, changed, err := step.update(ctx, user.ID, step.role)
+		if err != nil || changed != step.wantChanged || !slices.Equal(got.Roles, step.want) {
+			t.Fatalf("%s: roles %v, changed %v, %v; want %v, changed %v", step.name, got, changed, err, step.want, step.wantChanged)
+		}
+		if stored, err := s.Users().Get(ctx, user.ID); err != nil || !slices.Equal(stored.Roles, step.want) {
+			t.Errorf("%s: stored roles %v, %v; want %v", step.name, stored, err, step.want)
+		}
+	}
+	if _, _, err := s.Users().GrantRole(ctx, user.ID+1000, server.RoleStaff); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("GrantRole of a missing user = %v; want ErrNotFound", err)
+	}
+
+	// Concurrent grants of different roles must not overwrite each other.
+	const granters = 8
+	var wg sync.WaitGroup
+	errs := make([]error, granters)
+	want := server.Roles{server.RoleCustomer}
+	for i := range granters {
+		role := fmt.Sprintf("role%d", i)
+		want = want.With(role)
+		wg.Go(func() {
+			_, _, errs[i] = s.Users().GrantRole(ctx, user.ID, role)
+		})
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("concurrent GrantRole: %v", err)
+		}
+	}
+	if got, err := s.Users().Get(ctx, user.ID); err != nil || !slices.Equal(got.Roles, want) {
+		t.Errorf("roles after concurrent grants = %v, %v; want %v", got, err, want)
+	}
+}
+
+func testSessions(t *testing.T, s server.Store) {
+	ctx := t.Context()
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+	// Databases keep times to a microsecond at best.
+	now := time.Now().Truncate(time.Millisecond)
+	newSession := func(user *server.User, family, hash string, expiresAt time.Time) *server.Session {
+		t.Helper()
+		session := &server.Session{
+			UserID:     user.ID,
+			FamilyID:   family,
+			TokenHash:  hash,
+			IssuedAt:   now.Add(-time.Hour),
+			ExpiresAt:  expiresAt,
+			LastSeenAt: now.Add(-time.Hour),
+		}
+		if err := s.Sessions().Create(ctx, session); err != nil {
+			t.Fatalf("Create session %s: %v", hash, err)
+		}
+		return session
+	}
+	first := newSession(alice, "f1", "h1", now.Add(time.Hour))
+	newSession(alice, "f1", "h2", now.Add(time.Hour))
+	newSession(alice, "f2", "h3", now.Add(time.Hour))
+	newSession(alice, "f3", "h4", now.Add(-time.Minute))
+	newSession(bob, "f4", "h5", now.Add(time.Hour))
+
+	got, err := s.Sessions().GetByTokenHash(ctx, "h1")
+	if err != nil || got.ID != first.ID || got.UserID != alice.ID || got.FamilyID != "f1" {
+		t.Fatalf("GetByTokenHash = %+v, %v; want session %d", got, err, first.ID)
+	}
+	if _, err := s.Sessions().GetByTokenHash(ctx, "unknown"); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("GetByTokenHash of an unknown token = %v; want ErrNotFound", err)
+	}
+
+	if err := s.Sessions().MarkRotated(ctx, first.ID, now); err != nil {
+		t.Fatalf("MarkRotated: %v", err)
+	}
+	if err := s.Sessions().MarkRotated(ctx, first.ID, now); !errors.Is(err, server.ErrConflict) {
+		t.Errorf("second MarkRotated = %v; want ErrConflict", err)
+	}
+	got, err = s.Sessions().Get(ctx, first.ID)
+	if err != nil || got.RotatedAt == nil || !got.RotatedAt.Equal(now) || !got.LastSeenAt.Equal(now) {
+		t.Errorf("Get after MarkRotated = %+v, %v; want RotatedAt and LastSeenAt %v", got, err, now)
+	}
+
+	for _, step := range []struct {
+		name   string
+		delete func() (int64, error)
+		want   int64
+	}{
+		{"DeleteExpired", func() (int64, error) { return s.Sessions().DeleteExpired(ctx, now) }, 1},
+		{"DeleteFamily", func() (int64, error) { return s.Sessions().DeleteFamily(ctx, "f1") }, 2},
+		{"DeleteByUser", func() (int64, error) { return s.Sessions().DeleteByUser(ctx, alice.ID) }, 1},
+	} {
+		if n, err := step.delete(); err != nil || n != step.want {
+			t.Errorf("%s = %d, %v; want %d", step.name, n, err, step.want)
+		}
+	}
+	if _, err := s.Sessions().GetByTokenHash(ctx, "h5"); err != nil {
+		t.Errorf("another user's session: %v; want it kept", err)
+	}
+}
+
+func testIdempotency(t *testing.T, s server.Store) {
+	ctx := t.Context()
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+	now := time.Now().Truncate(time.Millisecond)
+	reserve := func(user *server.User, key string, expiresAt time.Time) *server.IdempotencyRecord {
+		t.Helper()
+		record := &server.IdempotencyRecord{
+			UserID:      user.ID,
+			Key:         key,
+			RequestHash: "hash-" + key,
+			CreatedAt:   now.Add(-time.Hour),
+			ExpiresAt:   expiresAt,
+		}
+		if err := s.Idempotency().Reserve(ctx, record); err != nil {
+			t.Fatalf("Reserve %s: %v", key, err)
+		}
+		return record
+	}
+	first := reserve(alice, "k1", now.Add(time.Hour))
+	expired := reserve(alice, "k2", now.Add(-time.Minute))
+	reserve(bob, "k1", now.Add(time.Hour))
+	if first.ID == 0 {
+		t.Fatal("Reserve did not assign an ID")
+	}
+
+	err := s.Idempotency().Reserve(ctx, &server.IdempotencyRecord{UserID: alice.ID, Key: "k1", ExpiresAt: now.Add(time.Hour)})
+	if !errors.Is(err, server.ErrConflict) {
+		t.Errorf("Reserve of a used key = %v; want ErrConflict", err)
+	}
+
+	got, err := s.Idempotency().Get(ctx, alice.ID, "k1")
+	if err != nil || got.ID != first.ID || got.RequestHash != "hash-k1" || got.StatusCode != 0 || !got.ExpiresAt.Equal(first.ExpiresAt) {
+		t.Fatalf("Get = %+v, %v; want the reserved record %d", got, err, first.ID)
+	}
+	if _, err := s.Idempotency().Get(ctx, alice.ID, "unknown"); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("Get of an unknown key = %v; want ErrNotFound", err)
+	}
+
+	if err := s.Idempotency().Complete(ctx, first.ID, 201, `{"id":1}`); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	got, err = s.Idempotency().Get(ctx, alice.ID, "k1")
+	if err != nil || got.StatusCode != 201 || got.ResponseBody != `{"id":1}` {
+		t.Errorf("Get after Complete = %+v, %v; want the stored response", got, err)
+	}
+	if got, err := s.Idempotency().Get(ctx, bob.ID, "k1"); err != nil || got.StatusCode != 0 {
+		t.Errorf("another user's record with the key = %+v, %v; want it still reserved", got, err)
+	}
+	if err := s.Idempotency().Complete(ctx, 9999, 200, ""); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("Complete of a missing record = %v; want ErrNotFound", err)
+	}
+
+	if n, err := s.Idempotency().DeleteExpired(ctx, now); err != nil || n != 1 {
+		t.Errorf("DeleteExpired = %d, %v; want 1", n, err)
+	}
+	if _, err := s.Idempotency().Get(ctx, alice.ID, expired.Key); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("Get of an expired record = %v; want ErrNotFound", err)
+	}
+
+	if err := s.Idempotency().Delete(ctx, first.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := s.Idempotency().Delete(ctx, first.ID); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("second Delete = %v; want ErrNotFound", err)
+	}
+	// The key can be used again once its record is gone.
+	reserve(alice, "k1", now.Add(time.Hour))
+}
+
+func testCartAddItemMerges(t *testing.T, s server.Store) {
+	ctx := t.Context()
+	user := createUser(t, s, "alice")
+	item := createItem(t, s, "Lamp", 10)
+	shirt := createItem(t, s, "Shirt", 0)
+	variant := createVariant(t, s, shirt, "SHIRT-M", "M", 10)
+
+	cart, err := s.Carts().GetOrCreateForUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetOrCreateForUser: %v", err)
+	}
+	if again, err := s.Carts().GetOrCreateForUser(ctx, user.ID); err != nil || again.ID != cart.ID {
+		t.Fatalf("second GetOrCreateForUser = %+v, %v; want cart %d", again, err, cart.ID)
+	}
+
+	first := addItem(t, s, cart.ID, item.ID, 0, 2, nil)
+	merged := addItem(t, s, cart.ID, item.ID, 0, 3, nil)
+	if merged.ID != first.ID || merged.Quantity != 5 {
+		t.Errorf("second AddItem = line %d with %d units; want line %d with 5", merged.ID, merged.Quantity, first.ID)
+	}
+	over := &server.CartItem{CartID: cart.ID, ItemID: item.ID, Quantity: server.MaxCartQuantity - 4}
+	if err := s.Carts().AddItem(ctx, over); !errors.Is(err, server.ErrQuantityTooLarge) {
+		t.Errorf("AddItem merging into %d units = %v; want ErrQuantityTooLarge", server.MaxCartQuantity+1, err)
+	}
+	over = &server.CartItem{CartID: cart.ID, ItemID: shirt.ID, VariantID: variant.ID, Quantity: server.MaxCartQuantity + 1}
+	if err := s.Carts().AddItem(ctx, over); !errors.Is(err, server.ErrQuantityTooLarge) {
+		t.Errorf("AddItem of %d units = %v; want ErrQuantityTooLarge", server.MaxCartQuantity+1, err)
+	}
+	variantLine := addItem(t, s, cart.ID, shirt.ID, variant.ID, 1, nil)
+	if variantLine.ID == first.ID {
+		t.Errorf("AddItem of a variant merged into the line of another item")
+	}
+
+	got, err := s.Carts().GetByUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetByUser: %v", err)
+	}
+	if len(got.CartItems) != 2 {
+		t.Fatalf("GetByUser has %d lines; want 2", len(got.CartItems))
+	}
+	for _, ci := range got.CartItems {
+		switch ci.ID {
+		case first.ID:
+			if ci.Quantity != 5 || ci.Item.Name != item.Name || ci.Variant != nil {
+				t.Errorf("item line = %d units of %q, variant %v; want 5 of %q", ci.Quantity, ci.Item.Name, ci.Variant, item.Name)
+			}
+		case variantLine.ID:
+			if ci.Variant == nil || ci.Variant.SKU != variant.SKU || ci.Item.Name != shirt.Name {
+				t.Errorf("variant line = item %q, variant %v; want %q as %s", ci.Item.Name, ci.Variant, shirt.Name, variant.SKU)
+			}
+		default:
+			t.Errorf("unexpected line %+v", ci)
+		}
+	}
+
+	line, err := s.Carts().SetItemQuantity(ctx, cart.ID, item.ID, 0, 1, nil)
+	if err != nil || line.ID != first.ID || line.Quantity != 1 {
+		t.Errorf("SetItemQuantity = %+v, %v; want line %d with 1 unit", line, err, first.ID)
+	}
+	if err := s.Carts().RemoveItem(ctx, cart.ID, item.ID, 0); err != nil {
+		t.Errorf("RemoveItem: %v", err)
+	}
+	if err := s.Carts().RemoveItem(ctx, cart.ID, item.ID, 0); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("RemoveItem of a missing line = %v; want ErrNotFound", err)
+	}
+	if err := s.Carts().Clear(ctx, cart.ID); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	if got := cartLines(t, s, user.ID); len(got) != 0 {
+		t.Errorf("cart has %d lines after Clear; want none", len(got))
+	}
+}
+
+func testCartStockCheck(t *testing.T, s server.Store) {
+	ctx := t.Context()
+	item := createItem(t, s, "Lamp", 3)
+	carts := make([]*server.Cart, 3)
+	users := make([]*server.User, len(carts))
+	for i := range carts {
+		users[i] = createUser(t, s, fmt.Sprintf("user%d", i))
+		var err error
+		if carts[i], err = s.Carts().GetOrCreateForUser(ctx, users[i].ID); err != nil {
+			t.Fatalf("GetOrCreateForUser: %v", err)
+		}
+	}
+	now := time.Now()
+	later, earlier := now.Add(time.Hour), now.Add(-time.Minute)
+
+	// Only unexpired reservations of other carts hold stock back.
+	addItem(t, s, carts[0].ID, item.ID, 0, 2, &later)
+	err := s.Carts().AddItem(ctx, &server.CartItem{CartID: carts[1].ID, ItemID: item.ID, Quantity: 2, ReservedUntil: &later})
+	wantShortage(t, "AddItem beyond what is unreserved", err, server.StockShortage{ItemID: item.ID, Requested: 2, Available: 1})
+	if got := cartLines(t, s, users[1].ID); len(got) != 0 {
+		t.Errorf("failed AddItem left %d lines in the cart", len(got))
+	}
+	addItem(t, s, carts[1].ID, item.ID, 0, 1, &earlier)
+	addItem(t, s, carts[2].ID, item.ID, 0, 1, nil)
+
+	_, err = s.Carts().SetItemQuantity(ctx, carts[0].ID, item.ID, 0, 4, &later)
+	wantShortage(t, "SetItemQuantity beyond stock", err, server.StockShortage{ItemID: item.ID, Requested: 4, Available: 3})
+	if got := cartLines(t, s, users[0].ID); len(got) != 1 || got[0].Quantity != 2 {
+		t.Errorf("failed SetItemQuantity left lines %+v; want 2 units", got)
+	}
+	if _, err := s.Carts().SetItemQuantity(ctx, carts[0].ID, item.ID, 0, 3, &later); err != nil {
+		t.Errorf("SetItemQuantity within stock: %v", err)
+	}
+	if n, err := s.Items().Available(ctx, item.ID, 0, 0, now); err != nil || n != 0 {
+		t.Errorf("Available = %d, %v; want 0", n, err)
+	}
+}
+
+func testCartConcurrentReservations(t *testing.T, s server.Store) {
+	ctx := t.Context()
+	const stock, shoppers = 5, 12
+	item := createItem(t, s, "Lamp", stock)
+	carts := make([]*server.Cart, shoppers)
+	for i := range carts {
+		user := createUser(t, s, fmt.Sprintf("user%d", i))
+		var err error
+		if carts[i], err = s.Carts().GetOrCreateForUser(ctx, user.ID); err != nil {
+			t.Fatalf("GetOrCreateForUser: %v", err)
+		}
+	}
+
+	until := time.Now().Add(time.Hour)
+	var wg sync.WaitGroup
+	errs := make([]error, shoppers)
+	for i, cart := range carts {
+		wg.Go(func() {
+			errs[i] = s.Carts().AddItem(ctx, &server.CartItem{CartID: cart.ID, ItemID: item.ID, Quantity: 1, ReservedUntil: &until})
+		})
+	}
+	wg.Wait()
+
+	reserved := 0
+	for _, err := range errs {
+		var stockErr *server.InsufficientStockError
+		switch {
+		case err == nil:
+			reserved++
+		case !errors.As(err, &stockErr):
+			t.Errorf("AddItem: %v", err)
+		}
+	}
+	if reserved != stock {
+		t.Errorf("%d carts reserved a unit of %d in stock; want %d", reserved, stock, stock)
+	}
+}
+
+func testOrderCreate(t *testing.T, s server.Store) {
+	ctx := t.Context()
+	user := createUser(t, s, "alice")
+	item := createItem(t, s, "Lamp", 5)
+	shirt := createItem(t, s, "Shirt", 0)
+	variant := createVariant(t, s, shirt, "SHIRT-M", "M", 4)
+	cart, err := s.Carts().GetOrCreateForUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetOrCreateForUser: %v", err)
+	}
+	addItem(t, s, cart.ID, item.ID, 0, 2, nil)
+	addItem(t, s, cart.ID, shirt.ID, variant.ID, 3, nil)
+	cart, err = s.Carts().GetByUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetByUser: %v", err)
+	}
+
+	order := newOrder(user, cart)
+	if err := s.Orders().Create(ctx, order, cart); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if order.ID == 0 || order.OrderItems[0].ID == 0 || order.OrderItems[0].OrderID != order.ID {
+		t.Errorf("Create left IDs unset: %+v", order)
+	}
+	wantStock(t, s, item.ID, 0, 3)
+	wantStock(t, s, shirt.ID, variant.ID, 1)
+	if got := cartLines(t, s, user.ID); len(got) != 0 {
+		t.Errorf("cart has %d lines after checkout; want none", len(got))
+	}
+
+	got, err := s.Orders().Get(ctx, order.ID)
+	if err != nil || len(got.OrderItems) != 2 || got.Status != server.OrderPending {
+		t.Errorf("Get = %+v, %v; want a pending order with 2 lines", got, err)
+	}
+	history, err := s.Orders().History(ctx, order.ID)
+	if err != nil || len(history) != 1 || history[0].ToStatus != server.OrderPending || history[0].ActorID != user.ID {
+		t.Errorf("History = %+v, %v; want one entry creating it by user %d", history, err, user.ID)
+	}
+
+	if err := s.Orders().Create(ctx, newOrder(user, cart), cart); !errors.Is(err, server.ErrConflict) {
+		t.Errorf("checking out the same cart again = %v; want ErrConflict", err)
+	}
+	wantStock(t, s, item.ID, 0, 3)
+}
+
+func testOrderCreateInsufficientStock(t *testing.T, s server.Store) {
+	ctx := t.Context()
+	user := createUser(t, s, "alice")
+	other := createUser(t, s, "bob")
+	lamp := createItem(t, s, "Lamp", 5)
+	vase := createItem(t, s, "Vase", 1)
+	spare := createItem(t, s, "Spare", 5)
+	cart, err := s.Carts().GetOrCreateForUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetOrCreateForUser: %v", err)
+	}
+	addItem(t, s, cart.ID, lamp.ID, 0, 2, nil)
+	addItem(t, s, cart.ID, vase.ID, 0, 1, nil)
+	addItem(t, s, cart.ID, spare.ID, 0, 1, nil)
+
+	// The lamp runs low, and another cart reserves the only vase, which
+	// the user's unreserved line does not hold back.
+	if err := s.Items().SetStock(ctx, lamp.ID, 1); err != nil {
+		t.Fatalf("SetStock: %v", err)
+	}
+	otherCart, err := s.Carts().GetOrCreateForUser(ctx, other.ID)
+	if err != nil {
+		t.Fatalf("GetOrCreateForUser: %v", err)
+	}
+	until := time.Now().Add(time.Hour)
+	addItem(t, s, otherCart.ID, vase.ID, 0, 1, &until)
+
+	cart, err = s.Carts().GetByUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetByUser: %v", err)
+	}
+	err = s.Orders().Create(ctx, newOrder(user, cart), cart)
+	wantShortage(t, "Create", err,
+		server.StockShortage{ItemID: lamp.ID, Requested: 2, Available: 1},
+		server.StockShortage{ItemID: vase.ID, Requested: 1, Available: 0})
+	wantStock(t, s, lamp.ID, 0, 1)
+	wantStock(t, s, vase.ID, 0, 1)
+	wantStock(t, s, spare.ID, 0, 5)
+	if got := cartLines(t, s, user.ID); len(got) != 3 {
+		t.Errorf("cart has %d lines after failed checkout; want 3", len(got))
+	}
+}
+
+func testOrderChangeStatus(t *testing.T, s server.Store) {
+	tests := []struct {
+		name     string
+		statuses []string
+		restock  bool
+	}{
+		{"cancelled", []string{server.OrderCancelled}, true},
+		{"paid", []string{server.OrderPaid}, false},
+		{"refunded when paid", []string{server.OrderPaid, server.OrderRefunded}, true},
+		{"refunded when fulfilled", []string{server.OrderPaid, server.OrderFulfilled, server.OrderRefunded}, true},
+		{"refunded when delivered", []string{server.OrderPaid, server.OrderFulfilled, server.OrderShipped, server.OrderDelivered, server.OrderRefunded}, false},
+	}
+	ctx := t.Context()
+	staff := createUser(t, s, "staff")
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createUser(t, s, fmt.Sprintf("user%d", i))
+			item := createItem(t, s, "Lamp", 5)
+			shirt := createItem(t, s, "Shirt", 0)
+			variant := createVariant(t, s, shirt, fmt.Sprintf("SHIRT-%d", i), "M", 4)
+			cart, err := s.Carts().GetOrCreateForUser(ctx, user.ID)
+			if err != nil {
+				t.Fatalf("GetOrCreateForUser: %v", err)
+			}
+			addItem(t, s, cart.ID, item.ID, 0, 2, nil)
+			addItem(t, s, cart.ID, shirt.ID, variant.ID, 1, nil)
+			cart, err = s.Carts().GetByUser(ctx, user.ID)
+			if err != nil {
+				t.Fatalf("GetByUser: %v", err)
+			}
+			order := newOrder(user, cart)
+			if err := s.Orders().Create(ctx, order, cart); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			from := order.Status
+			for _, to := range tt.statuses {
+				change := &server.OrderStatusChange{OrderID: order.ID, FromStatus: from, ToStatus: to, ActorID: staff.ID}
+				if err := s.Orders().ChangeStatus(ctx, change); err != nil {
+					t.Fatalf("ChangeStatus %s -> %s: %v", from, to, err)
+				}
+				if change.ID == 0 || change.CreatedAt.IsZero() {
+					t.Errorf("ChangeStatus left ID = %d, CreatedAt = %v; want them set", change.ID, change.CreatedAt)
+				}
+				from = to
+			}
+			itemStock, variantStock := 3, 3
+			if tt.restock {
+				itemStock, variantStock = 5, 4
+			}
+			wantStock(t, s, item.ID, 0, itemStock)
+			wantStock(t, s, shirt.ID, variant.ID, variantStock)
+
+			stale := &server.OrderStatusChange{OrderID: order.ID, FromStatus: server.OrderPending, ToStatus: server.OrderCancelled, ActorID: staff.ID}
+			if err := s.Orders().ChangeStatus(ctx, stale); !errors.Is(err, server.ErrConflict) {
+				t.Errorf("ChangeStatus from a stale status = %v; want ErrConflict", err)
+			}
+			wantStock(t, s, item.ID, 0, itemStock)
+			history, err := s.Orders().History(ctx, order.ID)
+			if err != nil || len(history) != len(tt.statuses)+1 || history[len(history)-1].ToStatus != from {
+				t.Errorf("History = %+v, %v; want %d entries ending in %s", history, err, len(tt.statuses)+1, from)
+			}
+		})
+	}
+
+	missing := &server.OrderStatusChange{OrderID: 1000, FromStatus: server.OrderPending, ToStatus: server.OrderPaid, ActorID: staff.ID}
+	if err := s.Orders().ChangeStatus(ctx, missing); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("ChangeStatus of a missing order = %v; want ErrNotFound", err)
+	}
+}
+
+func testItemUpdateVersion(t *testing.T, s server.Store) {
+	ctx := t.Context()
+	item := createItem(t, s, "Lamp", 1)
+	if item.Version != 1 {
+		t.Fatalf("Create set Version = %d; want 1", item.Version)
+	}
+	first, err := s.Items().Get(ctx, item.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	second, err := s.Items().Get(ctx, item.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	first.Name = "Desk lamp"
+	if err := s.Items().Update(ctx, first); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if first.Version != 2 {
+		t.Errorf("Update set Version = %d; want 2", first.Version)
+	}
+	second.Name = "Floor lamp"
+	if err := s.Items().Update(ctx, second); !errors.Is(err, server.ErrConflict) {
+		t.Errorf("Update of a stale item = %v; want ErrConflict", err)
+	}
+
+	got, err := s.Items().Get(ctx, item.ID)
+	if err != nil || got.Name != "Desk lamp" || got.Version != 2 {
+		t.Errorf("Get = %+v, %v; want version 2 named Desk lamp", got, err)
+	}
+}
+
+func testItemList(t *testing.T, s server.Store) {
+	ctx := t.Context()
+	tools := createCategory(t, s, "tools", nil)
+	office := createCategory(t, s, "office", nil)
+	item := func(name string, price int64, categories ...*server.Category) *server.Item {
+		t.Helper()
+		it := createItem(t, s, name, 0)
+		it.Price = money.New(price, "USD")
+		for _, c := range categories {
+			it.Categories = append(it.Categories, *c)
+		}
+		if err := s.Items().Update(ctx, it); err != nil {
+			t.Fatalf("Update %s: %v", name, err)
+		}
+		return it
+	}
+	lamp := item("Lamp", 1500, office)
+	saw := item("Saw", 900, tools)
+	desk := item("Desk", 1500, office, tools)
+	archived := item("Anvil", 100, tools)
+	pen := item("Pen", 200)
+	lamp2 := item("Lamp", 700)
+	now := time.Now()
+	archived.ArchivedAt = &now
+	if err := s.Items().Update(ctx, archived); err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+	usd := func(amount int64) *money.Money {
+		m := money.New(amount, "USD")
+		return &m
+	}
+
+	tests := []struct {
+		name string
+		opts server.ItemListOptions
+		want []*server.Item
+	}{
+		{"all by ID", server.ItemListOptions{}, []*server.Item{lamp, saw, desk, pen, lamp2}},
+		{"descending ID", server.ItemListOptions{Desc: true}, []*server.Item{lamp2, pen, desk, saw, lamp}},
+		{"limit", server.ItemListOptions{Limit: 2}, []*server.Item{lamp, saw}},
+		{"after ID", server.ItemListOptions{Limit: 2, After: &server.Item{ID: saw.ID}}, []*server.Item{desk, pen}},
+		{"after the last", server.ItemListOptions{After: &server.Item{ID: lamp2.ID}}, nil},
+
+		// Equal names and prices go by ID, in the same direction.
+		{"by name", server.ItemListOptions{SortBy: server.ItemSortName}, []*server.Item{desk, lamp, lamp2, pen, saw}},
+		{"by name descending", server.ItemListOptions{SortBy: server.ItemSortName, Desc: true}, []*server.Item{saw, pen, lamp2, lamp, desk}},
+		{"after a name", server.ItemListOptions{
+			SortBy: server.ItemSortName, Limit: 2, After: &server.Item{ID: lamp.ID, Name: "Lamp"},
+		}, []*server.Item{lamp2, pen}},
+		{"by price", server.ItemListOptions{SortBy: server.ItemSortPrice}, []*server.Item{pen, lamp2, saw, lamp, desk}},
+		{"by price descending", server.ItemListOptions{SortBy: server.ItemSortPrice, Desc: true}, []*server.Item{desk, lamp, saw, lamp2, pen}},
+		{"after a price", server.ItemListOptions{
+			SortBy: server.ItemSortPrice, After: &server.Item{ID: lamp.ID, Price: money.New(1500, "USD")},
+		}, []*server.Item{desk}},
+		{"by creation", server.ItemListOptions{SortBy: server.ItemSortCreatedAt}, []*server.Item{lamp, saw, desk, pen, lamp2}},
+
+		// Price bounds are inclusive.
+		{"min price", server.ItemListOptions{MinPrice: usd(900)}, []*server.Item{lamp, saw, desk}},
+		{"max price", server.ItemListOptions{MaxPrice: usd(900)}, []*server.Item{saw, pen, lamp2}},
+		{"price range", server.ItemListOptions{MinPrice: usd(700), MaxPrice: usd(900)}, []*server.Item{saw, lamp2}},
+
+		// An item in several of the categories is listed once.
+		{"category", server.ItemListOptions{CategoryIDs: []uint{tools.ID}}, []*server.Item{saw, desk}},
+		{"categories", server.ItemListOptions{CategoryIDs: []uint{tools.ID, office.ID}}, []*server.Item{lamp, saw, desk}},
+		{"category by price", server.ItemListOptions{
+			CategoryIDs: []uint{office.ID}, SortBy: server.ItemSortPrice, Desc: true, Limit: 1,
+		}, []*server.Item{desk}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := s.Items().List(ctx, tt.opts)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			var got, want []uint
+			for _, it := range items {
+				got = append(got, it.ID)
+			}
+			for _, it := range tt.want {
+				want = append(want, it.ID)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("List = %v; want %v", got, want)
+			}
+		})
+	}
+
+	items, err := s.Items().List(ctx, server.ItemListOptions{CategoryIDs: []uint{office.ID}})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(items) != 2 || len(items[1].Categories) != 2 {
+		t.Errorf("List by category = %+v; want desk with both its categories", items)
+	}
+}
+
+func testItemPrices(t *testing.T, s server.Store) {
+	ctx := t.Context()
+	lamp := createItem(t, s, "Lamp", 0)
+	desk := createItem(t, s, "Desk", 0)
+	for _, price := range []money.Money{money.New(900, "EUR"), money.New(950, "EUR"), money.New(800, "GBP")} {
+		if err := s.Items().SetPrice(ctx, lamp.ID, price); err != nil {
+			t.Fatalf("SetPrice %v %s: %v", price, price.Currency, err)
+		}
+	}
+	if err := s.Items().SetPrice(ctx, desk.ID+1000, money.New(100, "EUR")); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("SetPrice of a missing item = %v; want ErrNotFound", err)
+	}
+
+	prices, err := s.Items().Prices(ctx, lamp.ID)
+	if err != nil {
+		t.Fatalf("Prices: %v", err)
+	}
+	var got []money.Money
+	for _, p := range prices {
+		got = append(got, p.Price)
+	}
+	if want := []money.Money{money.New(950, "EUR"), money.New(800, "GBP")}; !slices.Equal(got, want) {
+		t.Errorf("Prices = %v; want %v, the later EUR price replacing the earlier", got, want)
+	}
+	in, err := s.Items().PricesIn(ctx, "EUR", []uint{lamp.ID, desk.ID})
+	if err != nil {
+		t.Fatalf("PricesIn: %v", err)
+	}
+	if len(in) != 1 || in[lamp.ID] != money.New(950, "EUR") {
+		t.Errorf("PricesIn(EUR) = %v; want only the lamp's 9.50", in)
+	}
+
+	if err := s.Items().DeletePrice(ctx, lamp.ID, "EUR"); err != nil {
+		t.Fatalf("DeletePrice: %v", err)
+	}
+	if err := s.Items().DeletePrice(ctx, lamp.ID, "EUR"); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("DeletePrice of a missing price = %v; want ErrNotFound", err)
+	}
+	if in, err := s.Items().PricesIn(ctx, "EUR", []uint{lamp.ID}); err != nil || len(in) != 0 {
+		t.Errorf("PricesIn after DeletePrice = %v, %v; want none", in, err)
+	}
+}
+
+func testItemListInCurrency(t *testing.T, s server.Store) {
+	ctx := t.Context()
+	// At 0.5 EUR to the USD, with prices of their own for some items.
+	item := func(name string, usd int64, eur ...int64) uint {
+		t.Helper()
+		it := createItem(t, s, name, 0)
+		it.Price = money.New(usd, "USD")
+		if err := s.Items().Update(ctx, it); err != nil {
+			t.Fatalf("Update %s: %v", name, err)
+		}
+		for _, amount := range eur {
+			if err := s.Items().SetPrice(ctx, it.ID, money.New(amount, "EUR")); err != nil {
+				t.Fatalf("SetPrice %s: %v", name, err)
+			}
+		}
+		return it.ID
+	}
+	lamp := item("Lamp", 1000)       // 5.00
+	desk := item("Desk", 2000, 400)  // 4.00 of its own
+	pen := item("Pen", 5)            // 0.025, rounded to 0.02
+	clip := item("Clip", 15)         // 0.075, rounded to 0.08
+	chair := item("Chair", 200, 900) // 9.00 of its own
+	eur := func(amount int64) *money.Money {
+		m := money.New(amount, "EUR")
+		return &m
+	}
+
+	tests := []struct {
+		name string
+		opts server.ItemListOptions
+		want []uint
+	}{
+		{"sorted", server.ItemListOptions{SortBy: server.ItemSortPrice}, []uint{pen, clip, desk, lamp, chair}},
+		{"descending", server.ItemListOptions{SortBy: server.ItemSortPrice, Desc: true}, []uint{chair, lamp, desk, clip, pen}},
+		{"min price", server.ItemListOptions{SortBy: server.ItemSortPrice, MinPrice: eur(3)}, []uint{clip, desk, lamp, chair}},
+		{"max price", server.ItemListOptions{SortBy: server.ItemSortPrice, MaxPrice: eur(450)}, []uint{pen, clip, desk}},
+		{"after", server.ItemListOptions{
+			SortBy: server.ItemSortPrice, Limit: 2,
+			After: &server.Item{ID: desk, Price: money.New(400, "EUR")},
+		}, []uint{lamp, chair}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Currency, tt.opts.Factor = "EUR", big.NewRat(1, 2)
+			items, err := s.Items().List(ctx, tt.opts)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			var got []uint
+			for _, it := range items {
+				got = append(got, it.ID)
+				if it.Price.Currency != "USD" {
+					t.Errorf("item %d listed at %v %s; want its stored USD price", it.ID, it.Price, it.Price.Currency)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("List = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testExchangeRates(t *testing.T, s server.Store) {
+	ctx := t.Context()
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	create := func(currency, rate string, from time.Time) *server.ExchangeRate {
+		t.Helper()
+		r := &server.ExchangeRate{Currency: currency, Rate: rate, EffectiveFrom: from}
+		if err := s.ExchangeRates().Create(ctx, r); err != nil {
+			t.Fatalf("Create %s %s: %v", currency, rate, err)
+		}
+		return r
+	}
+	create("EUR", "0.9", day)
+	later := create("EUR", "0.92", day.AddDate(0, 0, 7))
+	create("GBP", "0.8", day)
+	err := s.ExchangeRates().Create(ctx, &server.ExchangeRate{Currency: "EUR", Rate: "1", EffectiveFrom: day})
+	if !errors.Is(err, server.ErrConflict) {
+		t.Errorf("Create a second rate taking effect at the same time = %v; want ErrConflict", err)
+	}
+
+	for _, tt := range []struct {
+		at   time.Time
+		want string
+	}{
+		{day, "0.9"},
+		{day.AddDate(0, 0, 6), "0.9"},
+		{day.AddDate(0, 0, 7), "0.92"},
+		{day.AddDate(1, 0, 0), "0.92"},
+	} {
+		r, err := s.ExchangeRates().Current(ctx, "EUR", tt.at)
+		if err != nil || r.Rate != tt.want {
+			t.Errorf("Current(EUR, %v) = %+v, %v; want %s", tt.at, r, err, tt.want)
+		}
+	}
+	if _, err := s.ExchangeRates().Current(ctx, "EUR", day.Add(-time.Second)); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("Current before any rate = %v; want ErrNotFound", err)
+	}
+	if _, err := s.ExchangeRates().Current(ctx, "JPY", day); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("Current of a currency without rates = %v; want ErrNotFound", err)
+	}
+
+	list, err := s.ExchangeRates().List(ctx, "")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var got []string
+	for _, r := range list {
+		got = append(got, r.Currency+" "+r.Rate)
+	}
+	if want := []string{"EUR 0.9", "EUR 0.92", "GBP 0.8"}; !slices.Equal(got, want) {
+		t.Errorf("List = %v; want %v", got, want)
+	}
+
+	if err := s.ExchangeRates().Delete(ctx, later.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := s.ExchangeRates().Delete(ctx, later.ID); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("Delete of a missing rate = %v; want ErrNotFound", err)
+	}
+	if list, err := s.ExchangeRates().List(ctx, "EUR"); err != nil || len(list) != 1 || list[0].Rate != "0.9" {
+		t.Errorf("List(EUR) after Delete = %+v, %v; want only 0.9", list, err)
+	}
+}
+
+func testCategoryCycles(t *testing.T, s server.Store) {
+	ctx := t.Context()
+	// a > b > c
+	a := createCategory(t, s, "a", nil)
+	b := createCategory(t, s, "b", &a.ID)
+	c := createCategory(t, s, "c", &b.ID)
+	missing := c.ID + 1000
+
+	tests := []struct {
+		name     string
+		category *server.Category
+		parentID *uint
+		want     error
+	}{
+		{"under itself", a, &a.ID, server.ErrCategoryCycle},
+		{"under its child", a, &b.ID, server.ErrCategoryCycle},
+		{"under its grandchild", a, &c.ID, server.ErrCategoryCycle},
+		{"under a missing category", c, &missing, server.ErrNotFound},
+		{"under its grandparent", c, &a.ID, nil},
+		{"to the top level", b, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moved := *tt.category
+			moved.ParentID = tt.parentID
+			err := s.Categories().Update(ctx, &moved)
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("Update = %v; want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			got, err := s.Categories().Get(ctx, moved.ID)
+			if err != nil || !equalParent(got.ParentID, tt.parentID) {
+				t.Errorf("Get = %+v, %v; want parent %v", got, err, tt.parentID)
+			}
+		})
+	}
+	if got, err := s.Categories().Get(ctx, a.ID); err != nil || got.ParentID != nil {
+		t.Errorf("a after refused moves = %+v, %v; want it top-level", got, err)
+	}
+}
+
+func createUser(t *testing.T, s server.Store, username string) *server.User {
+	t.Helper()
+	user := &server.User{Username: username, PasswordHash: "hash", Roles: server.Roles{server.RoleCustomer}}
+	if err := s.Users().Create(context.Background(), user); err != nil {
+		t.Fatalf("Create user %s: %v", username, err)
+	}
+	return user
+}
+
+// createItem adds an item priced at 10.00 USD with stock units in stock.
+// Items named Shirt have a size option.
+func createItem(t *testing.T, s server.Store, name string, stock int) *server.Item {
+	t.Helper()
+	item := &server.Item{Name: name, Price: money.New(1000, "USD"), StockQuantity: stock}
+	if name == "Shirt" {
+		item.Options = server.ItemOptions{{Name: "size", Values: []string{"S", "M"}}}
+	}
+	if err := s.Items().Create(context.Background(), item); err != nil {
+		t.Fatalf("Create item %s: %v", name, err)
+	}
+	return item
+}
+
+func createVariant(t *testing.T, s server.Store, item *server.Item, sku, size string, stock int) *server.Variant {
+	t.Helper()
+	variant := &server.Variant{
+		ItemID:        item.ID,
+		SKU:           sku,
+		Options:       server.VariantOptions{"size": size},
+		StockQuantity: stock,
+	}
+	if err := s.Variants().Create(context.Background(), variant); err != nil {
+		t.Fatalf("Create variant %s: %v", sku, err)
+	}
+	return variant
+}
+
+func createCategory(t *testing.T, s server.Store, slug string, parentID *uint) *server.Category {
+	t.Helper()
+	category := &server.Category{Slug: slug, Name: slug, ParentID: parentID}
+	if err := s.Categories().Create(context.Background(), category); err != nil {
+		t.Fatalf("Create category %s: %v", slug, err)
+	}
+	return category
+}
+
+func addItem(t *testing.T, s server.Store, cartID, itemID, variantID uint, quantity int, reservedUntil *time.Time) *server.CartItem {
+	t.Helper()
+	line := &server.CartItem{CartID: cartID, ItemID: itemID, VariantID: variantID, Quantity: quantity, ReservedUntil: reservedUntil}
+	if err := s.Carts().AddItem(context.Background(), line); err != nil {
+		t.Fatalf("AddItem %d units of item %d: %v", quantity, itemID, err)
+	}
+	return line
+}
+
+// cartLines returns the lines of the user's cart.
+func cartLines(t *testing.T, s server.Store, userID uint) []server.CartItem {
+	t.Helper()
+	cart, err := s.Carts().GetByUser(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("GetByUser: %v", err)
+	}
+	return cart.CartItems
+}
+
+// newOrder returns a pending order for the lines of cart, each unit priced
+// at 10.00 USD.
+func newOrder(user *server.User, cart *server.Cart) *server.Order {
+	order := &server.Order{
+		UserID:       user.ID,
+		CartID:       cart.ID,
+		Currency:     "USD",
+		BaseCurrency: "USD",
+		ExchangeRate: "1",
+		Status:       server.OrderPending,
+		Discount:     money.New(0, "USD"),
+		Tax:          money.New(0, "USD"),
+		Shipping:     money.New(0, "USD"),
+	}
+	order.Subtotal = money.New(0, "USD")
+	for _, ci := range cart.CartItems {
+		line := server.OrderItem{
+			ItemID:    ci.ItemID,
+			VariantID: ci.VariantID,
+			Name:      ci.Item.Name,
+			UnitPrice: money.New(1000, "USD"),
+			Quantity:  ci.Quantity,
+			LineTotal: money.New(1000*int64(ci.Quantity), "USD"),
+		}
+		if ci.Variant != nil {
+			line.SKU = ci.Variant.SKU
+			line.Options = ci.Variant.Options
+		}
+		order.OrderItems = append(order.OrderItems, line)
+		order.Subtotal = order.Subtotal.Add(line.LineTotal)
+	}
+	order.Total = order.Subtotal
+	return order
+}
+
+// wantStock checks the stock of the variant, or of the item if variantID is
+// zero.
+func wantStock(t *testing.T, s server.Store, itemID, variantID uint, want int) {
+	t.Helper()
+	var got int
+	if variantID != 0 {
+		variant, err := s.Variants().Get(context.Background(), variantID)
+		if err != nil {
+			t.Fatalf("Get variant: %v", err)
+		}
+		got = variant.StockQuantity
+	} else {
+		item, err := s.Items().Get(context.Background(), itemID)
+		if err != nil {
+			t.Fatalf("Get item: %v", err)
+		}
+		got = item.StockQuantity
+	}
+	if got != want {
+		t.Errorf("stock of item %d variant %d = %d; want %d", itemID, variantID, got, want)
+	}
+}
+
+// wantShortage checks that err is an *InsufficientStockError listing want,
+// in any order.
+func wantShortage(t *testing.T, op string, err error, want ...server.StockShortage) {
+	t.Helper()
+	var stockErr *server.InsufficientStockError
+	if !errors.As(err, &stockErr) {
+		t.Errorf("%s = %v; want *InsufficientStockError", op, err)
+		return
+	}
+	got := slices.Clone(stockErr.Shortages)
+	less := func(a, b server.StockShortage) int { return int(a.ItemID) - int(b.ItemID) }
+	slices.SortFunc(got, less)
+	slices.SortFunc(want, less)
+	if !slices.Equal(got, want) {
+		t.Errorf("%s shortages = %+v; want %+v", op, got, want)
+	}
+}
+
+func equalParent(a, b *uint) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
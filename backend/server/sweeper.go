@@ -0,0 +1,34 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// StartSweeper deletes expired sessions and idempotency records from store
+// every interval until ctx is cancelled.
+func StartSweeper(ctx context.Context, store Store, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				sweep(ctx, "sessions", now, store.Sessions().DeleteExpired)
+				sweep(ctx, "idempotency records", now, store.Idempotency().DeleteExpired)
+			}
+		}
+	}()
+}
+
+func sweep(ctx context.Context, what string, now time.Time, deleteExpired func(context.Context, time.Time) (int64, error)) {
+	n, err := deleteExpired(ctx, now)
+	if err != nil {
+		log.Printf("sweeper: %s: %v", what, err)
+	} else if n > 0 {
+		log.Printf("sweeper: evicted %d expired %s", n, what)
+	}
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultAccessTokenTTL is how long an access token is valid when
+// Config.AccessTokenTTL is zero. Access tokens cannot be revoked, so this
+// bounds how long a logged-out token keeps working.
+const DefaultAccessTokenTTL = 15 * time.Minute
+
+const accessTokenIssuer = "shopcart"
+
+// Signing algorithms supported for access tokens.
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// SigningKey is one access-token key, identified by the kid JWT header.
+type SigningKey struct {
+	ID        string
+	Algorithm string // AlgHS256 or AlgEdDSA
+	Secret    []byte // HS256
+	Private   ed25519.PrivateKey
+}
+
+func (k SigningKey) verifyKey() any {
+	if k.Algorithm == AlgEdDSA {
+		return k.Private.Public()
+	}
+	return k.Secret
+}
+
+func (k SigningKey) signKey() any {
+	if k.Algorithm == AlgEdDSA {
+		return k.Private
+	}
+	return k.Secret
+}
+
+// ParseSigningKeys parses a comma-separated list of kid:alg:base64 entries,
+// e.g. "2025-06:EdDSA:<32-byte seed>,2025-01:HS256:<secret>". HS256 secrets
+// must be at least 32 bytes; EdDSA keys are 32-byte ed25519 seeds. The first
+// key signs new tokens; the rest are only accepted for verification so keys
+// can be rotated without logging everyone out.
+func ParseSigningKeys(spec string) ([]SigningKey, error) {
+	var keys []SigningKey
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("signing key %q: want kid:alg:base64", entry)
+		}
+		raw, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", parts[0], err)
+		}
+		key := SigningKey{ID: parts[0], Algorithm: parts[1]}
+		switch key.Algorithm {
+		case AlgHS256:
+			if len(raw) < 32 {
+				return nil, fmt.Errorf("signing key %s: HS256 secret must be at least 32 bytes", key.ID)
+			}
+			key.Secret = raw
+		case AlgEdDSA:
+			if len(raw) != ed25519.SeedSize {
+				return nil, fmt.Errorf("signing key %s: EdDSA key must be a %d-byte seed", key.ID, ed25519.SeedSize)
+			}
+			key.Private = ed25519.NewKeyFromSeed(raw)
+		default:
+			return nil, fmt.Errorf("signing key %s: unsupported algorithm %q", key.ID, key.Algorithm)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// AccessClaims are the claims carried by an access token.
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	Username  string `json:"name"`
+	Roles     Roles  `json:"roles"`
+	SessionID uint   `json:"sid"`
+}
+
+// UserID returns the subject as a user ID.
+func (c *AccessClaims) UserID() uint {
+	id, _ := strconv.ParseUint(c.Subject, 10, 64)
+	return uint(id)
+}
+
+// Errors returned by AccessTokens.Verify.
+var (
+	ErrTokenExpired = errors.New("token expired")
+	ErrTokenInvalid = errors.New("invalid token")
+)
+
+// AccessTokens signs and verifies access tokens. Verification needs only the
+// keys, never the store, so it works across stateless instances that share
+// the same key configuration.
+type AccessTokens struct {
+	active SigningKey
+	keys   map[string]SigningKey
+	ttl    time.Duration
+}
+
+// NewAccessTokens signs with keys[0] and accepts tokens signed by any of keys.
+func NewAccessTokens(keys []SigningKey, ttl time.Duration) (*AccessTokens, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+	t := &AccessTokens{active: keys[0], keys: make(map[string]SigningKey, len(keys)), ttl: ttl}
+	for _, k := range keys {
+		if _, dup := t.keys[k.ID]; dup {
+			return nil, fmt.Errorf("duplicate signing key id %q", k.ID)
+		}
+		t.keys[k.ID] = k
+	}
+	return t, nil
+}
+
+// ephemeralSigningKey returns a random HS256 key for deployments that did not
+// configure one. Tokens signed with it stop validating on restart and are not
+// shared between instances.
+func ephemeralSigningKey() (SigningKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return SigningKey{}, err
+	}
+	return SigningKey{ID: "ephemeral-" + hex.EncodeToString(secret[:4]), Algorithm: AlgHS256, Secret: secret}, nil
+}
+
+// Issue returns a signed access token for the user's session and its expiry.
+// The user's roles are embedded, so role changes take effect on the next
+// refresh.
+func (t *AccessTokens) Issue(user *User, sessionID uint) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(t.ttl)
+	claims := AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    accessTokenIssuer,
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Username:  user.Username,
+		Roles:     user.Roles,
+		SessionID: sessionID,
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(t.active.Algorithm), claims)
+	token.Header["kid"] = t.active.ID
+	signed, err := token.SignedString(t.active.signKey())
+	return signed, expiresAt, err
+}
+
+// Verify checks the signature and expiry of raw using the key named by its
+// kid header. It returns ErrTokenExpired or ErrTokenInvalid on failure.
+func (t *AccessTokens) Verify(raw string) (*AccessClaims, error) {
+	var claims AccessClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := t.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+		// Pin the algorithm to the key so a token cannot pick its own.
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("kid %q is not an %s key", kid, token.Method.Alg())
+		}
+		return key.verifyKey(), nil
+	},
+		jwt.WithIssuer(accessTokenIssuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithValidMethods([]string{AlgHS256, AlgEdDSA}),
+	)
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return nil, ErrTokenExpired
+	case err != nil:
+		return nil, ErrTokenInvalid
+	}
+	return &claims, nil
+}
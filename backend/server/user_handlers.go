@@ -0,0 +1,334 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UserRegistrationRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type UserLoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type TokenRefreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+type GrantRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// UserResponse is the public view of a User. Handlers must respond with it
+// rather than User so that credentials and other internal fields added to
+// User later are never serialized.
+type UserResponse struct {
+	ID        uint      `json:"id"`
+	Username  string    `json:"username"`
+	Roles     Roles     `json:"roles"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newUserResponse(user *User) UserResponse {
+	return UserResponse{ID: user.ID, Username: user.Username, Roles: user.Roles, CreatedAt: user.CreatedAt}
+}
+
+func (h *handler) createNewUser(c *gin.Context) {
+	var req UserRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	passwordHash, err := h.passwords.Hash(req.Password)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	user := &User{
+		Username:     req.Username,
+		PasswordHash: passwordHash,
+		Roles:        Roles{RoleCustomer},
+	}
+	err = h.store.Users().Create(c.Request.Context(), user)
+	if errors.Is(err, ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, newUserResponse(user))
+}
+
+// listAllUsers is restricted to admins.
+func (h *handler) listAllUsers(c *gin.Context) {
+	userList, err := h.store.Users().List(c.Request.Context())
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	resp := make([]UserResponse, 0, len(userList))
+	for i := range userList {
+		resp = append(resp, newUserResponse(&userList[i]))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// fetchCurrentUser returns the profile of the user making the request.
+func (h *handler) fetchCurrentUser(c *gin.Context) {
+	claims := c.MustGet("claims").(*AccessClaims)
+	user, err := h.store.Users().Get(c.Request.Context(), claims.UserID())
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+func (h *handler) handleUserLogin(c *gin.Context) {
+	var req UserLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	user, err := h.store.Users().GetByUsername(c.Request.Context(), req.Username)
+	if errors.Is(err, ErrNotFound) {
+		// Burn the same time as a real check so response timing does not
+		// reveal which usernames exist.
+		h.passwords.Verify(req.Password, h.dummyPasswordHash)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username/password"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	ok, needsRehash := h.passwords.Verify(req.Password, user.PasswordHash)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username/password"})
+		return
+	}
+	if needsRehash {
+		// Upgrade legacy or outdated hashes now that we know the password.
+		// Failing to do so is not a reason to refuse the login.
+		if newHash, err := h.passwords.Hash(req.Password); err != nil {
+			log.Printf("rehash password for user %d: %v", user.ID, err)
+		} else if err := h.store.Users().SetPasswordHash(c.Request.Context(), user.ID, newHash); err != nil {
+			log.Printf("store rehashed password for user %d: %v", user.ID, err)
+		}
+	}
+
+	familyID, err := newSessionFamily()
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	resp, err := h.issueTokens(c.Request.Context(), user, familyID)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// handleTokenRefresh exchanges a refresh token for a new access token and a
+// new refresh token. Each refresh token works once: presenting one that was
+// already rotated means it leaked, so the whole login is revoked.
+func (h *handler) handleTokenRefresh(c *gin.Context) {
+	var req TokenRefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	session, err := h.store.Sessions().GetByTokenHash(ctx, hashSessionToken(req.RefreshToken))
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token", "code": "invalid_token"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	now := time.Now()
+	if !now.Before(session.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token expired", "code": "token_expired"})
+		return
+	}
+
+	reused := session.RotatedAt != nil
+	if !reused {
+		err := h.store.Sessions().MarkRotated(ctx, session.ID, now)
+		switch {
+		case errors.Is(err, ErrConflict):
+			// A concurrent refresh with the same token got there first.
+			reused = true
+		case err != nil:
+			internalError(c, err)
+			return
+		}
+	}
+	if reused {
+		if _, err := h.store.Sessions().DeleteFamily(ctx, session.FamilyID); err != nil {
+			internalError(c, err)
+			return
+		}
+		log.Printf("refresh token reuse for user %d; revoked session family", session.UserID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token already used; please log in again", "code": "refresh_token_reused"})
+		return
+	}
+
+	user, err := h.store.Users().Get(ctx, session.UserID)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token", "code": "invalid_token"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	resp, err := h.issueTokens(ctx, user, session.FamilyID)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// issueTokens starts a new session in familyID and returns the login
+// response carrying its refresh token and a matching access token.
+func (h *handler) issueTokens(ctx context.Context, user *User, familyID string) (gin.H, error) {
+	refreshToken, tokenHash, err := newSessionToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := &Session{
+		UserID:     user.ID,
+		FamilyID:   familyID,
+		TokenHash:  tokenHash,
+		IssuedAt:   now,
+		ExpiresAt:  now.Add(h.sessionTTL),
+		LastSeenAt: now,
+	}
+	if err := h.store.Sessions().Create(ctx, session); err != nil {
+		return nil, err
+	}
+	accessToken, expiresAt, err := h.tokens.Issue(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"token":            accessToken,
+		"expiresAt":        expiresAt,
+		"refreshToken":     refreshToken,
+		"refreshExpiresAt": session.ExpiresAt,
+	}, nil
+}
+
+// handleUserLogout revokes the login the access token belongs to, so it can
+// no longer be refreshed. The access token itself stays valid until it
+// expires.
+func (h *handler) handleUserLogout(c *gin.Context) {
+	claims := c.MustGet("claims").(*AccessClaims)
+	ctx := c.Request.Context()
+	session, err := h.store.Sessions().Get(ctx, claims.SessionID)
+	if err == nil && session.UserID == claims.UserID() {
+		_, err = h.store.Sessions().DeleteFamily(ctx, session.FamilyID)
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		internalError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// handleUserLogoutAll revokes every login of the current user, including the
+// one used to make the request.
+func (h *handler) handleUserLogoutAll(c *gin.Context) {
+	user := c.MustGet("user").(*User)
+	n, err := h.store.Sessions().DeleteByUser(c.Request.Context(), user.ID)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revoked": n})
+}
+
+// grantUserRole adds a role to the user named by the :id parameter.
+func (h *handler) grantUserRole(c *gin.Context) {
+	var req GrantRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !validRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+	h.updateUserRoles(c, h.store.Users().GrantRole, req.Role)
+}
+
+// revokeUserRole removes the :role parameter from the user named by :id.
+// Every user stays a customer, and admins cannot revoke their own admin role
+// so the shop is never left without one by accident. The user's logins are
+// revoked so the role cannot come back with a refreshed token, but an access
+// token already issued keeps the role until it expires.
+func (h *handler) revokeUserRole(c *gin.Context) {
+	role := c.Param("role")
+	if !validRole(role) || role == RoleCustomer {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+	current := c.MustGet("user").(*User)
+	if role == RoleAdmin && c.Param("id") == strconv.FormatUint(uint64(current.ID), 10) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot revoke your own admin role"})
+		return
+	}
+	h.updateUserRoles(c, h.store.Users().RevokeRole, role)
+}
+
+// updateUserRoles grants or revokes, as update does, role for the user named
+// by :id and responds with the updated user. The user's access tokens keep
+// their old roles until they are refreshed or expire. If a role was
+// removed, every session of the user is revoked, so they cannot be refreshed
+// either and the user has to log in again.
+func (h *handler) updateUserRoles(c *gin.Context, update func(context.Context, uint, string) (*User, bool, error), role string) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+	ctx := c.Request.Context()
+	user, changed, err := update(ctx, uint(id), role)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if changed && !user.Roles.Has(role) {
+		if _, err := h.store.Sessions().DeleteByUser(ctx, user.ID); err != nil {
+			internalError(c, err)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
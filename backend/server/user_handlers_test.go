@@ -0,0 +1,40 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUpdateUserRolesRevokesSessions(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		body        any
+		wantRefresh int
+	}{
+		{"grant", http.MethodPost, "/users/%d/roles", gin.H{"role": RoleAdmin}, http.StatusOK},
+		{"revoke", http.MethodDelete, "/users/%d/roles/" + RoleStaff, nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, Config{})
+			s.createUser("root", RoleAdmin)
+			user := s.createUser("alice", RoleStaff)
+			adminToken, _ := s.login("root")
+			_, refreshToken := s.login("alice")
+
+			w := s.do(tt.method, fmt.Sprintf(tt.path, user.ID), adminToken, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d; want 200; body %s", w.Code, w.Body)
+			}
+			w = s.do(http.MethodPost, "/users/token/refresh", "", gin.H{"refreshToken": refreshToken})
+			if w.Code != tt.wantRefresh {
+				t.Errorf("refresh status = %d; want %d", w.Code, tt.wantRefresh)
+			}
+		})
+	}
+}
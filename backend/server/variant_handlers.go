@@ -0,0 +1,173 @@
+package server
+
+import (
+	"errors"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"fullstack-shopping-cart/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VariantRequest creates or replaces a variant of an item. Options picks a
+// value for each of the item's options. Without a Price the variant costs
+// what the item does.
+type VariantRequest struct {
+	SKU           string            `json:"sku" binding:"required"`
+	Options       map[string]string `json:"options"`
+	Price         *money.Decimal    `json:"price"`
+	StockQuantity int               `json:"stockQuantity" binding:"min=0"`
+	Barcode       string            `json:"barcode"`
+}
+
+// createVariant adds a variant to the item named by :id. Once an item has
+// variants it can only be bought as one of them.
+func (h *handler) createVariant(c *gin.Context) {
+	item, ok := h.loadVariantItem(c)
+	if !ok {
+		return
+	}
+	variant := &Variant{ItemID: item.ID}
+	if !h.bindVariant(c, item, variant) {
+		return
+	}
+	err := h.store.Variants().Create(c.Request.Context(), variant)
+	if !checkVariantSaved(c, err) {
+		return
+	}
+	c.JSON(http.StatusCreated, variant)
+}
+
+// replaceVariant sets every field of one of an item's variants.
+func (h *handler) replaceVariant(c *gin.Context) {
+	item, ok := h.loadVariantItem(c)
+	if !ok {
+		return
+	}
+	variant, ok := loadVariant(c, item)
+	if !ok || !h.bindVariant(c, item, variant) {
+		return
+	}
+	err := h.store.Variants().Update(c.Request.Context(), variant)
+	if !checkVariantSaved(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, variant)
+}
+
+// deleteVariant removes one of an item's variants and takes it out of every
+// cart. Past orders keep its SKU and options.
+func (h *handler) deleteVariant(c *gin.Context) {
+	item, ok := h.loadItem(c)
+	if !ok {
+		return
+	}
+	variant, ok := loadVariant(c, item)
+	if !ok {
+		return
+	}
+	err := h.store.Variants().Delete(c.Request.Context(), variant.ID)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// loadVariantItem fetches the item named by :id for adding or changing a
+// variant, which it must have options for and not be archived.
+func (h *handler) loadVariantItem(c *gin.Context) (*Item, bool) {
+	item, ok := h.loadItem(c)
+	if !ok {
+		return nil, false
+	}
+	if item.ArchivedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Item is archived"})
+		return nil, false
+	}
+	if len(item.Options) == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Item has no options for variants to differ in; set its options first"})
+		return nil, false
+	}
+	return item, true
+}
+
+// bindVariant reads a VariantRequest into variant, a variant of item,
+// responding 400 or 409 and returning false if it is invalid or another of
+// the item's variants already has its options.
+func (h *handler) bindVariant(c *gin.Context, item *Item, variant *Variant) bool {
+	var req VariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return false
+	}
+	req.SKU = strings.TrimSpace(req.SKU)
+	if req.SKU == "" || strings.ContainsFunc(req.SKU, func(r rune) bool { return r <= ' ' }) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sku must not be empty or contain spaces"})
+		return false
+	}
+	options := VariantOptions(req.Options)
+	if problem := item.Options.matches(options); problem != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": problem})
+		return false
+	}
+	for _, v := range item.Variants {
+		if v.ID != variant.ID && maps.Equal(v.Options, options) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Variant " + v.SKU + " already has these options"})
+			return false
+		}
+	}
+	variant.Price = nil
+	if req.Price != nil {
+		price, ok := h.parsePrice(c, *req.Price, h.currency)
+		if !ok {
+			return false
+		}
+		variant.Price = &price
+	}
+	variant.SKU = req.SKU
+	variant.Options = options
+	variant.StockQuantity = req.StockQuantity
+	variant.Barcode = strings.TrimSpace(req.Barcode)
+	return true
+}
+
+// checkVariantSaved responds to the error of creating or updating a variant
+// and returns whether there was none.
+func checkVariantSaved(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "SKU is already taken"})
+	case errors.Is(err, ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+	default:
+		internalError(c, err)
+	}
+	return false
+}
+
+// loadVariant finds the variant named by the :variantId parameter among the
+// item's.
+func loadVariant(c *gin.Context, item *Item) (*Variant, bool) {
+	id, err := strconv.ParseUint(c.Param("variantId"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant id"})
+		return nil, false
+	}
+	for i := range item.Variants {
+		if item.Variants[i].ID == uint(id) {
+			return &item.Variants[i], true
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+	return nil, false
+}
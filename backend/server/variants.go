@@ -0,0 +1,116 @@
+package server
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ItemOption is an axis an item's variants differ along, such as size, with
+// the values it takes in the order they are shown.
+type ItemOption struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// ItemOptions are an item's option axes, stored as a JSON column.
+type ItemOptions []ItemOption
+
+// Value implements driver.Valuer.
+func (o ItemOptions) Value() (driver.Value, error) {
+	if o == nil {
+		o = ItemOptions{}
+	}
+	b, err := json.Marshal(o)
+	return string(b), err
+}
+
+// Scan implements sql.Scanner.
+func (o *ItemOptions) Scan(src any) error {
+	*o = ItemOptions{}
+	return scanJSON("item options", src, o)
+}
+
+// check trims the names and values of o and returns why it is not a valid
+// set of options, or "" if it is.
+func (o ItemOptions) check() string {
+	for i := range o {
+		opt := &o[i]
+		opt.Name = strings.TrimSpace(opt.Name)
+		if opt.Name == "" {
+			return "every option needs a name"
+		}
+		if slices.ContainsFunc(o[:i], func(prev ItemOption) bool { return prev.Name == opt.Name }) {
+			return "option " + opt.Name + " is listed twice"
+		}
+		if len(opt.Values) == 0 {
+			return "option " + opt.Name + " needs at least one value"
+		}
+		for j := range opt.Values {
+			opt.Values[j] = strings.TrimSpace(opt.Values[j])
+			if opt.Values[j] == "" || slices.Contains(opt.Values[:j], opt.Values[j]) {
+				return "the values of option " + opt.Name + " must be distinct and not empty"
+			}
+		}
+	}
+	return ""
+}
+
+// VariantOptions picks a variant's value for each of its item's options,
+// keyed by option name. It is stored as a JSON object; encoding/json sorts
+// the keys, so equal options are always stored as the same text, which the
+// unique index on a variant's item and options relies on.
+type VariantOptions map[string]string
+
+// Value implements driver.Valuer.
+func (o VariantOptions) Value() (driver.Value, error) {
+	if o == nil {
+		o = VariantOptions{}
+	}
+	b, err := json.Marshal(o)
+	return string(b), err
+}
+
+// Scan implements sql.Scanner.
+func (o *VariantOptions) Scan(src any) error {
+	*o = VariantOptions{}
+	return scanJSON("variant options", src, o)
+}
+
+// scanJSON decodes a JSON column into dst, leaving it alone for NULL.
+func scanJSON(what string, src, dst any) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("%s: cannot scan %T", what, src)
+	}
+	return json.Unmarshal(b, dst)
+}
+
+// matches returns why options does not pick exactly one of the values of
+// each of o, or "" if it does.
+func (o ItemOptions) matches(options VariantOptions) string {
+	for _, opt := range o {
+		value, ok := options[opt.Name]
+		if !ok {
+			return "options must include " + opt.Name
+		}
+		if !slices.Contains(opt.Values, value) {
+			return value + " is not a value of option " + opt.Name
+		}
+	}
+	for name := range options {
+		if !slices.ContainsFunc(o, func(opt ItemOption) bool { return opt.Name == name }) {
+			return "the item has no option " + name
+		}
+	}
+	return ""
+}
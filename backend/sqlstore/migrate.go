@@ -0,0 +1,250 @@
+package sqlstore
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fullstack-shopping-cart/server"
+
+	"gorm.io/gorm"
+)
+
+// Migrations are numbered SQL files, one directory per dialect:
+//
+//	migrations/<dialect>/0001_init.up.sql
+//	migrations/<dialect>/0001_init.down.sql
+//
+// Every migration must exist for every dialect so PostgreSQL and SQLite
+// databases always share the same schema version. Migrations that convert
+// existing data may write {{currency}} for the shop's currency as a SQL
+// string; see Migrator.Currency.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// MigrationsDir is the source directory of the embedded migrations,
+// relative to the backend module root.
+const MigrationsDir = "sqlstore/migrations"
+
+// Dialects lists the migration directories that must be kept in step.
+var Dialects = []string{"postgres", "sqlite"}
+
+const migrationsTable = "schema_migrations"
+
+var (
+	migrationFileRE = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+	currencyRE      = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// Migration is one numbered schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// LoadMigrations returns the embedded migrations for dialect ordered by
+// version.
+func LoadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for dialect %q: %w", dialect, err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		m := migrationFileRE.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected migration file %s/%s", dir, e.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(migrationFiles, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %04d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", mig.Version, mig.Name)
+		}
+		list = append(list, *mig)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// Migrator applies and rolls back the embedded migrations, recording applied
+// versions in the schema_migrations table.
+type Migrator struct {
+	// Currency is the shop's CURRENCY, which existing prices are taken to
+	// be in. It defaults to server.DefaultCurrency.
+	Currency string
+
+	db         *gorm.DB
+	migrations []Migration
+}
+
+type schemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string { return migrationsTable }
+
+// Migrator returns a Migrator for the store's database dialect.
+func (s *Store) Migrator() (*Migrator, error) {
+	migrations, err := LoadMigrations(s.db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{Currency: server.DefaultCurrency, db: s.db, migrations: migrations}, nil
+}
+
+// expand fills the shop's currency into a migration's SQL.
+func (m *Migrator) expand(sql string) (string, error) {
+	if !currencyRE.MatchString(m.Currency) {
+		return "", fmt.Errorf("invalid currency %q", m.Currency)
+	}
+	return strings.ReplaceAll(sql, "{{currency}}", "'"+m.Currency+"'"), nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	return m.db.WithContext(ctx).Exec(`CREATE TABLE IF NOT EXISTS ` + migrationsTable + ` (
+    version    INTEGER PRIMARY KEY,
+    name       TEXT NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+)`).Error
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]schemaMigration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	var rows []schemaMigration
+	if err := m.db.WithContext(ctx).Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]schemaMigration, len(rows))
+	for _, r := range rows {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// Status lists every known migration and when it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		st := MigrationStatus{Migration: mig}
+		if r, ok := applied[mig.Version]; ok {
+			at := r.AppliedAt
+			st.AppliedAt = &at
+		}
+		list = append(list, st)
+	}
+	return list, nil
+}
+
+// Up applies every pending migration in order, each in its own transaction,
+// and returns the ones it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		up, err := m.expand(mig.Up)
+		if err != nil {
+			return done, fmt.Errorf("apply %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{
+				Version:   mig.Version,
+				Name:      mig.Name,
+				AppliedAt: time.Now().UTC(),
+			}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("apply %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Down rolls back the most recently applied steps migrations and returns the
+// ones it reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.Down == "" {
+			return done, fmt.Errorf("migration %04d_%s has no down file", mig.Version, mig.Name)
+		}
+		down, err := m.expand(mig.Down)
+		if err != nil {
+			return done, fmt.Errorf("revert %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{Version: mig.Version}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("revert %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
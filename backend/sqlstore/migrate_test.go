@@ -0,0 +1,128 @@
+package sqlstore
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+
+	"fullstack-shopping-cart/money"
+	"fullstack-shopping-cart/server"
+)
+
+func TestMigratePricesIntoShopCurrency(t *testing.T) {
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "shop.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	migrator, err := s.Migrator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator.Currency = "EUR"
+
+	// Stop before prices became Money, when they were plain numbers in the
+	// shop's currency.
+	all := migrator.migrations
+	migrator.migrations = all[:11]
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.Exec(`INSERT INTO items (name, price) VALUES ('Lamp', 12.5)`).Error; err != nil {
+		t.Fatal(err)
+	}
+	migrator.migrations = all
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := s.Items().Get(t.Context(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := money.New(1250, "EUR"); item.Price != want {
+		t.Errorf("price = %v %s; want %v %s", item.Price, item.Price.Currency, want, want.Currency)
+	}
+}
+
+func TestMigratorRejectsInvalidCurrency(t *testing.T) {
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "shop.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	migrator, err := s.Migrator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator.Currency = "E'; DROP TABLE items; --"
+	if applied, err := migrator.Up(t.Context()); err == nil || len(applied) > 0 {
+		t.Errorf("Up = %d applied, %v; want an error before applying any", len(applied), err)
+	}
+}
+
+func TestMigrateCategoryLabelsToSlugs(t *testing.T) {
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "shop.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	migrator, err := s.Migrator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stop before categories replaced the free-form label.
+	all := migrator.migrations
+	migrator.migrations = all[:13]
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]string{
+		"Blocks":  "Kids' Toys",
+		"Kite":    " kids toys ",
+		"Paint":   "Arts & Crafts",
+		"Rake":    "Garden",
+		"Mystery": "???",
+		"Plain":   "",
+	}
+	for name, label := range labels {
+		if err := s.db.Exec(`INSERT INTO items (name, category) VALUES (?, ?)`, name, label).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	migrator.migrations = all
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pattern category handlers check new slugs against.
+	slugPattern := regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	want := map[string]string{
+		"Blocks": "kids-toys", "Kite": "kids-toys", "Paint": "arts-crafts", "Rake": "garden", "Mystery": "other",
+	}
+	items, err := s.Items().List(t.Context(), server.ItemListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		var slugs []string
+		for _, c := range item.Categories {
+			if !slugPattern.MatchString(c.Slug) {
+				t.Errorf("%s: invalid slug %q", item.Name, c.Slug)
+			}
+			slugs = append(slugs, c.Slug)
+		}
+		if w, ok := want[item.Name]; (ok && !slices.Equal(slugs, []string{w})) || (!ok && len(slugs) > 0) {
+			t.Errorf("%s, labelled %q, is in %v; want %q", item.Name, labels[item.Name], slugs, w)
+		}
+	}
+	categories, err := s.Categories().List(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(categories) != 4 {
+		t.Errorf("%d categories; want 4: %+v", len(categories), categories)
+	}
+}
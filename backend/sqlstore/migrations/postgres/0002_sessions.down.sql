@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN token TEXT UNIQUE;
+DROP TABLE sessions;
@@ -0,0 +1,3 @@
+DROP INDEX idx_sessions_family_id;
+ALTER TABLE sessions DROP COLUMN rotated_at;
+ALTER TABLE sessions DROP COLUMN family_id;
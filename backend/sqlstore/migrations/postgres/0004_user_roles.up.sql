@@ -0,0 +1,2 @@
+-- Roles are stored as a comma-separated set; existing users are customers.
+ALTER TABLE users ADD COLUMN roles TEXT NOT NULL DEFAULT 'customer';
@@ -0,0 +1,3 @@
+ALTER TABLE order_items DROP COLUMN quantity;
+DROP INDEX idx_cart_items_cart_item;
+ALTER TABLE cart_items DROP COLUMN quantity;
@@ -0,0 +1,13 @@
+-- Cart lines carry a quantity instead of one row per unit. Collapse the
+-- duplicate rows of each cart and item into the oldest one first.
+ALTER TABLE cart_items ADD COLUMN quantity INTEGER NOT NULL DEFAULT 1;
+UPDATE cart_items SET quantity = (
+    SELECT COUNT(*) FROM cart_items dup
+    WHERE dup.cart_id = cart_items.cart_id AND dup.item_id = cart_items.item_id
+);
+DELETE FROM cart_items WHERE id NOT IN (
+    SELECT MIN(id) FROM cart_items GROUP BY cart_id, item_id
+);
+CREATE UNIQUE INDEX idx_cart_items_cart_item ON cart_items (cart_id, item_id);
+
+ALTER TABLE order_items ADD COLUMN quantity INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+ALTER TABLE cart_items DROP COLUMN reserved_until;
+ALTER TABLE items DROP COLUMN stock_quantity;
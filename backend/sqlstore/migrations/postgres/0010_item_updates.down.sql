@@ -0,0 +1,3 @@
+ALTER TABLE items DROP COLUMN archived_at;
+ALTER TABLE items DROP COLUMN updated_at;
+ALTER TABLE items DROP COLUMN version;
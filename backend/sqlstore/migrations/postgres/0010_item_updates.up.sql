@@ -0,0 +1,6 @@
+-- Items can be edited and archived. version backs the ETag used for
+-- optimistic concurrency; archived items stay in place for past orders.
+ALTER TABLE items ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE items ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+UPDATE items SET updated_at = created_at;
+ALTER TABLE items ADD COLUMN archived_at TIMESTAMPTZ;
@@ -0,0 +1,5 @@
+DROP INDEX idx_items_created_at;
+DROP INDEX idx_items_name;
+DROP INDEX idx_items_price;
+DROP INDEX idx_items_category;
+ALTER TABLE items DROP COLUMN category;
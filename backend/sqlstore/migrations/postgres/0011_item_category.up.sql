@@ -0,0 +1,7 @@
+-- Items get a category to filter the catalog by, and indexes for the
+-- listing's filters and sort orders.
+ALTER TABLE items ADD COLUMN category TEXT NOT NULL DEFAULT '';
+CREATE INDEX idx_items_category ON items (category);
+CREATE INDEX idx_items_price ON items (price, id);
+CREATE INDEX idx_items_name ON items (name, id);
+CREATE INDEX idx_items_created_at ON items (created_at, id);
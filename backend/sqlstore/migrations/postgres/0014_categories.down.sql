@@ -0,0 +1,11 @@
+-- Items keep the name of one of their categories as their label.
+ALTER TABLE items ADD COLUMN category TEXT NOT NULL DEFAULT '';
+UPDATE items SET category = COALESCE((
+    SELECT MIN(categories.name)
+    FROM item_categories
+    JOIN categories ON categories.id = item_categories.category_id
+    WHERE item_categories.item_id = items.id
+), '');
+CREATE INDEX idx_items_category ON items (category);
+DROP TABLE item_categories;
+DROP TABLE categories;
@@ -0,0 +1,12 @@
+ALTER TABLE order_items DROP COLUMN options;
+ALTER TABLE order_items DROP COLUMN sku;
+ALTER TABLE order_items DROP COLUMN variant_id;
+
+-- Cart lines for variants have nothing to go back to.
+DELETE FROM cart_items WHERE variant_id <> 0;
+DROP INDEX idx_cart_items_cart_item;
+CREATE UNIQUE INDEX idx_cart_items_cart_item ON cart_items (cart_id, item_id);
+ALTER TABLE cart_items DROP COLUMN variant_id;
+
+DROP TABLE variants;
+ALTER TABLE items DROP COLUMN options;
@@ -0,0 +1,5 @@
+-- Order lines record their share of the order's discount. Existing orders
+-- had no discounts.
+ALTER TABLE order_items ADD COLUMN discount_amount BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN discount_currency TEXT NOT NULL DEFAULT '';
+UPDATE order_items SET discount_currency = line_total_currency;
@@ -0,0 +1,3 @@
+DROP TABLE sessions;
+ALTER TABLE users ADD COLUMN token TEXT;
+CREATE UNIQUE INDEX idx_users_token ON users (token);
@@ -0,0 +1,24 @@
+-- Logins move from a single token column on users to one row per session.
+
+-- SQLite cannot drop a UNIQUE column, so rebuild the table without it.
+CREATE TABLE users_new (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    username      TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO users_new (id, username, password_hash, created_at)
+    SELECT id, username, password_hash, created_at FROM users;
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+
+CREATE TABLE sessions (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash   TEXT NOT NULL UNIQUE,
+    issued_at    DATETIME NOT NULL,
+    expires_at   DATETIME NOT NULL,
+    last_seen_at DATETIME NOT NULL
+);
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
+CREATE INDEX idx_sessions_expires_at ON sessions (expires_at);
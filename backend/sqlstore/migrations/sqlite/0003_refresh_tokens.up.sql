@@ -0,0 +1,6 @@
+-- Sessions become rotating refresh tokens. Existing sessions each start
+-- their own family.
+ALTER TABLE sessions ADD COLUMN family_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN rotated_at DATETIME;
+UPDATE sessions SET family_id = CAST(id AS TEXT);
+CREATE INDEX idx_sessions_family_id ON sessions (family_id);
@@ -0,0 +1,9 @@
+ALTER TABLE orders DROP COLUMN currency;
+ALTER TABLE orders DROP COLUMN total;
+ALTER TABLE orders DROP COLUMN shipping;
+ALTER TABLE orders DROP COLUMN tax;
+ALTER TABLE orders DROP COLUMN discount;
+ALTER TABLE orders DROP COLUMN subtotal;
+ALTER TABLE order_items DROP COLUMN line_total;
+ALTER TABLE order_items DROP COLUMN unit_price;
+ALTER TABLE order_items DROP COLUMN name;
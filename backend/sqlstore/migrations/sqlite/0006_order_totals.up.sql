@@ -0,0 +1,19 @@
+-- Orders keep the prices they were placed at. Existing orders are backfilled
+-- from the current catalog, the best record there is of what they cost.
+ALTER TABLE order_items ADD COLUMN name TEXT NOT NULL DEFAULT '';
+ALTER TABLE order_items ADD COLUMN unit_price REAL NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN line_total REAL NOT NULL DEFAULT 0;
+UPDATE order_items SET
+    name = (SELECT name FROM items WHERE items.id = order_items.item_id),
+    unit_price = (SELECT price FROM items WHERE items.id = order_items.item_id);
+UPDATE order_items SET line_total = unit_price * quantity;
+
+ALTER TABLE orders ADD COLUMN subtotal REAL NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN discount REAL NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN tax REAL NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN shipping REAL NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN total REAL NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD';
+UPDATE orders SET subtotal = COALESCE(
+    (SELECT SUM(line_total) FROM order_items WHERE order_items.order_id = orders.id), 0);
+UPDATE orders SET total = subtotal;
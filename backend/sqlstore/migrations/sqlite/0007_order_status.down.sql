@@ -0,0 +1,3 @@
+DROP TABLE order_status_changes;
+DROP INDEX idx_orders_status;
+ALTER TABLE orders DROP COLUMN status;
@@ -0,0 +1,18 @@
+-- Orders get a status and an append-only history of its changes. Existing
+-- orders start out pending, placed by their own user.
+ALTER TABLE orders ADD COLUMN status TEXT NOT NULL DEFAULT 'pending';
+CREATE INDEX idx_orders_status ON orders (status);
+
+CREATE TABLE order_status_changes (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id    INTEGER NOT NULL REFERENCES orders (id),
+    from_status TEXT NOT NULL,
+    to_status   TEXT NOT NULL,
+    actor_id    INTEGER NOT NULL,
+    note        TEXT NOT NULL DEFAULT '',
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_order_status_changes_order_id ON order_status_changes (order_id);
+
+INSERT INTO order_status_changes (order_id, from_status, to_status, actor_id, created_at)
+    SELECT id, '', 'pending', user_id, created_at FROM orders;
@@ -0,0 +1,13 @@
+-- Responses stored for replay to requests retried with an Idempotency-Key.
+CREATE TABLE idempotency_records (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id         INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    idempotency_key TEXT NOT NULL,
+    request_hash    TEXT NOT NULL,
+    status_code     INTEGER NOT NULL,
+    response_body   TEXT NOT NULL,
+    created_at      DATETIME NOT NULL,
+    expires_at      DATETIME NOT NULL
+);
+CREATE UNIQUE INDEX idx_idempotency_records_user_key ON idempotency_records (user_id, idempotency_key);
+CREATE INDEX idx_idempotency_records_expires_at ON idempotency_records (expires_at);
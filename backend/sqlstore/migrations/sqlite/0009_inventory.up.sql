@@ -0,0 +1,4 @@
+-- Items track how many units are on hand, and cart lines can hold some of
+-- them until reserved_until. Existing items start out of stock.
+ALTER TABLE items ADD COLUMN stock_quantity INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE cart_items ADD COLUMN reserved_until DATETIME;
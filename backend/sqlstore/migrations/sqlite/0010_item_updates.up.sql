@@ -0,0 +1,8 @@
+-- Items can be edited and archived. version backs the ETag used for
+-- optimistic concurrency; archived items stay in place for past orders.
+-- SQLite cannot add a column defaulting to CURRENT_TIMESTAMP, so
+-- updated_at is backfilled from created_at.
+ALTER TABLE items ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE items ADD COLUMN updated_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00';
+UPDATE items SET updated_at = created_at;
+ALTER TABLE items ADD COLUMN archived_at DATETIME;
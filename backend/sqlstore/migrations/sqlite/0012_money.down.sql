@@ -0,0 +1,39 @@
+DROP INDEX idx_items_price;
+ALTER TABLE items ADD COLUMN price REAL NOT NULL DEFAULT 0;
+UPDATE items SET
+    price = price_amount / 100.0;
+ALTER TABLE items DROP COLUMN price_currency;
+ALTER TABLE items DROP COLUMN price_amount;
+CREATE INDEX idx_items_price ON items (price, id);
+
+ALTER TABLE order_items ADD COLUMN unit_price REAL NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN line_total REAL NOT NULL DEFAULT 0;
+UPDATE order_items SET
+    unit_price = unit_price_amount / 100.0,
+    line_total = line_total_amount / 100.0;
+ALTER TABLE order_items DROP COLUMN unit_price_currency;
+ALTER TABLE order_items DROP COLUMN unit_price_amount;
+ALTER TABLE order_items DROP COLUMN line_total_currency;
+ALTER TABLE order_items DROP COLUMN line_total_amount;
+
+ALTER TABLE orders ADD COLUMN subtotal REAL NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN discount REAL NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN tax REAL NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN shipping REAL NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN total REAL NOT NULL DEFAULT 0;
+UPDATE orders SET
+    subtotal = subtotal_amount / 100.0,
+    discount = discount_amount / 100.0,
+    tax = tax_amount / 100.0,
+    shipping = shipping_amount / 100.0,
+    total = total_amount / 100.0;
+ALTER TABLE orders DROP COLUMN subtotal_currency;
+ALTER TABLE orders DROP COLUMN subtotal_amount;
+ALTER TABLE orders DROP COLUMN discount_currency;
+ALTER TABLE orders DROP COLUMN discount_amount;
+ALTER TABLE orders DROP COLUMN tax_currency;
+ALTER TABLE orders DROP COLUMN tax_amount;
+ALTER TABLE orders DROP COLUMN shipping_currency;
+ALTER TABLE orders DROP COLUMN shipping_amount;
+ALTER TABLE orders DROP COLUMN total_currency;
+ALTER TABLE orders DROP COLUMN total_amount;
@@ -0,0 +1,52 @@
+-- Amounts become integer minor units plus an ISO 4217 currency code.
+-- Existing amounts are assumed to be in a currency with cents. Order
+-- amounts take the order's currency; items take the shop's CURRENCY, which
+-- their prices have always been shown in.
+
+DROP INDEX idx_items_price;
+ALTER TABLE items ADD COLUMN price_amount INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE items ADD COLUMN price_currency TEXT NOT NULL DEFAULT '';
+UPDATE items SET
+    price_amount = CAST(ROUND(price * 100) AS INTEGER),
+    price_currency = {{currency}};
+ALTER TABLE items DROP COLUMN price;
+CREATE INDEX idx_items_price ON items (price_amount, id);
+
+ALTER TABLE order_items ADD COLUMN unit_price_amount INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN unit_price_currency TEXT NOT NULL DEFAULT '';
+ALTER TABLE order_items ADD COLUMN line_total_amount INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN line_total_currency TEXT NOT NULL DEFAULT '';
+UPDATE order_items SET
+    unit_price_amount = CAST(ROUND(unit_price * 100) AS INTEGER),
+    unit_price_currency = COALESCE((SELECT currency FROM orders WHERE orders.id = order_items.order_id), {{currency}}),
+    line_total_amount = CAST(ROUND(line_total * 100) AS INTEGER),
+    line_total_currency = COALESCE((SELECT currency FROM orders WHERE orders.id = order_items.order_id), {{currency}});
+ALTER TABLE order_items DROP COLUMN unit_price;
+ALTER TABLE order_items DROP COLUMN line_total;
+
+ALTER TABLE orders ADD COLUMN subtotal_amount INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN subtotal_currency TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN discount_amount INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN discount_currency TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN tax_amount INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN tax_currency TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN shipping_amount INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN shipping_currency TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN total_amount INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN total_currency TEXT NOT NULL DEFAULT '';
+UPDATE orders SET
+    subtotal_amount = CAST(ROUND(subtotal * 100) AS INTEGER),
+    subtotal_currency = currency,
+    discount_amount = CAST(ROUND(discount * 100) AS INTEGER),
+    discount_currency = currency,
+    tax_amount = CAST(ROUND(tax * 100) AS INTEGER),
+    tax_currency = currency,
+    shipping_amount = CAST(ROUND(shipping * 100) AS INTEGER),
+    shipping_currency = currency,
+    total_amount = CAST(ROUND(total * 100) AS INTEGER),
+    total_currency = currency;
+ALTER TABLE orders DROP COLUMN subtotal;
+ALTER TABLE orders DROP COLUMN discount;
+ALTER TABLE orders DROP COLUMN tax;
+ALTER TABLE orders DROP COLUMN shipping;
+ALTER TABLE orders DROP COLUMN total;
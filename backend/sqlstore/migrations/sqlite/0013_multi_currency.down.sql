@@ -0,0 +1,4 @@
+ALTER TABLE orders DROP COLUMN exchange_rate;
+ALTER TABLE orders DROP COLUMN base_currency;
+DROP TABLE exchange_rates;
+DROP TABLE item_prices;
@@ -0,0 +1,25 @@
+-- Prices of items in currencies other than the shop's own.
+CREATE TABLE item_prices (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    item_id        INTEGER NOT NULL REFERENCES items (id) ON DELETE CASCADE,
+    price_amount   INTEGER NOT NULL,
+    price_currency TEXT NOT NULL
+);
+CREATE UNIQUE INDEX idx_item_prices_item_currency ON item_prices (item_id, price_currency);
+CREATE INDEX idx_item_prices_currency ON item_prices (price_currency);
+
+-- Rates converting the shop's currency into others, each in effect from
+-- effective_from until the currency's next one.
+CREATE TABLE exchange_rates (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    currency       TEXT NOT NULL,
+    rate           TEXT NOT NULL,
+    effective_from DATETIME NOT NULL,
+    created_at     DATETIME NOT NULL
+);
+CREATE UNIQUE INDEX idx_exchange_rates_currency_effective_from ON exchange_rates (currency, effective_from);
+
+-- Existing orders were all placed in the shop's currency.
+ALTER TABLE orders ADD COLUMN base_currency TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN exchange_rate TEXT NOT NULL DEFAULT '1';
+UPDATE orders SET base_currency = currency;
@@ -0,0 +1,59 @@
+-- A tree of categories replaces the free-form items.category label. Items
+-- can be in any number of categories.
+CREATE TABLE categories (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    parent_id  INTEGER REFERENCES categories (id),
+    slug       TEXT NOT NULL UNIQUE,
+    name       TEXT NOT NULL,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+CREATE INDEX idx_categories_parent_id ON categories (parent_id);
+
+CREATE TABLE item_categories (
+    item_id     INTEGER NOT NULL REFERENCES items (id) ON DELETE CASCADE,
+    category_id INTEGER NOT NULL REFERENCES categories (id) ON DELETE CASCADE,
+    PRIMARY KEY (item_id, category_id)
+);
+CREATE INDEX idx_item_categories_category_id ON item_categories (category_id);
+
+-- Each existing label becomes a top-level category of the items that had
+-- it. Its slug keeps the label's lower-case letters and digits, joining
+-- the runs of them with hyphens, so that it is a valid slug and labels
+-- differing only in case, spacing or punctuation share one. Labels with no
+-- letters or digits at all share the slug "other".
+-- SQLite has no regular expressions, so walk each label a character at a
+-- time.
+CREATE TEMP TABLE category_slugs AS
+WITH RECURSIVE walk (label, rest, slug) AS (
+    SELECT DISTINCT TRIM(category), LOWER(TRIM(category)), ''
+    FROM items
+    WHERE TRIM(category) <> ''
+    UNION ALL
+    SELECT label, SUBSTR(rest, 2),
+           CASE
+               WHEN SUBSTR(rest, 1, 1) BETWEEN 'a' AND 'z' OR SUBSTR(rest, 1, 1) BETWEEN '0' AND '9'
+                   THEN slug || SUBSTR(rest, 1, 1)
+               WHEN slug = '' OR SUBSTR(slug, -1) = '-' THEN slug
+               ELSE slug || '-'
+           END
+    FROM walk
+    WHERE rest <> ''
+)
+SELECT label, COALESCE(NULLIF(TRIM(slug, '-'), ''), 'other') AS slug
+FROM walk
+WHERE rest = '';
+INSERT INTO categories (slug, name, created_at, updated_at)
+SELECT slug, MIN(label), CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+FROM category_slugs
+GROUP BY slug;
+INSERT INTO item_categories (item_id, category_id)
+SELECT items.id, categories.id
+FROM items
+JOIN category_slugs ON category_slugs.label = TRIM(items.category)
+JOIN categories ON categories.slug = category_slugs.slug;
+DROP TABLE category_slugs;
+
+DROP INDEX idx_items_category;
+ALTER TABLE items DROP COLUMN category;
@@ -0,0 +1,28 @@
+-- Items get option axes such as size and colour, kept as a JSON list, and
+-- variants that pick a value of each with their own SKU, stock, barcode
+-- and, optionally, price. Cart and order lines name their variant;
+-- variant_id is 0 for items without variants so that the unique index
+-- still merges repeated adds of the same line.
+ALTER TABLE items ADD COLUMN options TEXT NOT NULL DEFAULT '[]';
+
+CREATE TABLE variants (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    item_id        INTEGER NOT NULL REFERENCES items (id) ON DELETE CASCADE,
+    sku            TEXT NOT NULL UNIQUE,
+    options        TEXT NOT NULL,
+    price_amount   INTEGER,
+    price_currency TEXT,
+    stock_quantity INTEGER NOT NULL DEFAULT 0,
+    barcode        TEXT NOT NULL DEFAULT '',
+    created_at     DATETIME NOT NULL,
+    updated_at     DATETIME NOT NULL
+);
+CREATE UNIQUE INDEX idx_variants_item_options ON variants (item_id, options);
+
+ALTER TABLE cart_items ADD COLUMN variant_id INTEGER NOT NULL DEFAULT 0;
+DROP INDEX idx_cart_items_cart_item;
+CREATE UNIQUE INDEX idx_cart_items_cart_item ON cart_items (cart_id, item_id, variant_id);
+
+ALTER TABLE order_items ADD COLUMN variant_id INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN sku TEXT NOT NULL DEFAULT '';
+ALTER TABLE order_items ADD COLUMN options TEXT NOT NULL DEFAULT '{}';
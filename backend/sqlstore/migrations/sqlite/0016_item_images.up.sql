@@ -0,0 +1,17 @@
+-- Pictures of items. The files live in media storage under storage_key,
+-- next to their thumbnails. The partial unique index keeps each item to
+-- one primary image.
+CREATE TABLE item_images (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    item_id      INTEGER NOT NULL REFERENCES items (id) ON DELETE CASCADE,
+    position     INTEGER NOT NULL,
+    is_primary   BOOLEAN NOT NULL DEFAULT FALSE,
+    storage_key  TEXT NOT NULL UNIQUE,
+    content_type TEXT NOT NULL,
+    width        INTEGER NOT NULL,
+    height       INTEGER NOT NULL,
+    size_bytes   INTEGER NOT NULL,
+    created_at   DATETIME NOT NULL
+);
+CREATE INDEX idx_item_images_item_position ON item_images (item_id, position);
+CREATE UNIQUE INDEX idx_item_images_primary ON item_images (item_id) WHERE is_primary;
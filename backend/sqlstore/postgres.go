@@ -0,0 +1,37 @@
+package sqlstore
+
+import (
+	"fmt"
+
+	"gorm.io/driver/postgres"
+)
+
+// PostgresConfig holds the connection settings read from the DB_* variables
+// in .env.
+type PostgresConfig struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Name     string
+	SSLMode  string
+}
+
+// DSN renders the config as a libpq keyword/value connection string.
+func (c PostgresConfig) DSN() string {
+	sslMode := c.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		c.Host, c.Port, c.User, c.Password, c.Name, sslMode)
+}
+
+// OpenPostgres connects to PostgreSQL using dsn.
+func OpenPostgres(dsn string) (*Store, error) {
+	s, err := open(postgres.Open(dsn))
+	if err != nil {
+		return nil, fmt.Errorf("postgres: %w", err)
+	}
+	return s, nil
+}
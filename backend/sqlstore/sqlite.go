@@ -0,0 +1,25 @@
+package sqlstore
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/glebarez/sqlite"
+)
+
+// OpenSQLite opens (creating if necessary) the SQLite database file at
+// path. The driver is pure Go, so the backend stays a single static binary.
+func OpenSQLite(path string) (*Store, error) {
+	// Foreign keys are off by default in SQLite; the busy timeout lets
+	// concurrent requests wait for the write lock instead of failing.
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+
+	s, err := open(sqlite.Open(path + "?" + params.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("sqlite %s: %w", path, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,33 @@
+package sqlstore
+
+import (
+	"path/filepath"
+	"testing"
+
+	"fullstack-shopping-cart/server"
+	"fullstack-shopping-cart/server/storetest"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) server.Store {
+		s, err := OpenSQLite(filepath.Join(t.TempDir(), "shop.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		migrateUp(t, s)
+		return s
+	})
+}
+
+// migrateUp brings the store's database to the latest schema.
+func migrateUp(t *testing.T, s *Store) {
+	t.Helper()
+	migrator, err := s.Migrator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+}
@@ -0,0 +1,1065 @@
+// Package sqlstore implements server.Store on top of gorm so the shop can
+// persist to a real database.
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"fullstack-shopping-cart/money"
+	"fullstack-shopping-cart/server"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// Store is a server.Store backed by a gorm connection.
+type Store struct {
+	db *gorm.DB
+}
+
+// New wraps an open gorm connection. The connection should be opened with
+// gorm.Config{TranslateError: true} so constraint violations map to
+// server.ErrConflict and server.ErrNotFound.
+func New(db *gorm.DB) *Store {
+	return &Store{db: db}
+}
+
+// open connects through dialector. The schema is managed separately by
+// Migrator.
+func open(dialector gorm.Dialector) (*Store, error) {
+	db, err := gorm.Open(dialector, &gorm.Config{
+		TranslateError: true,
+		// Lookups that find nothing are answered with server.ErrNotFound
+		// and are not worth logging.
+		Logger: logger.New(log.New(os.Stderr, "\r\n", log.LstdFlags), logger.Config{
+			SlowThreshold:             200 * time.Millisecond,
+			LogLevel:                  logger.Warn,
+			IgnoreRecordNotFoundError: true,
+			Colorful:                  true,
+		}),
+		// SQLite compares timestamps as text, so every time is written in
+		// UTC to keep comparisons like expires_at < now correct.
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	return New(db), nil
+}
+
+// Close releases the underlying connection pool.
+func (s *Store) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+func (s *Store) Users() server.UserRepository                 { return users{s.db} }
+func (s *Store) Items() server.ItemRepository                 { return items{s.db} }
+func (s *Store) Carts() server.CartRepository                 { return carts{s.db} }
+func (s *Store) Orders() server.OrderRepository               { return orders{s.db} }
+func (s *Store) Sessions() server.SessionRepository           { return sessions{s.db} }
+func (s *Store) Idempotency() server.IdempotencyRepository    { return idempotency{s.db} }
+func (s *Store) ExchangeRates() server.ExchangeRateRepository { return exchangeRates{s.db} }
+func (s *Store) Categories() server.CategoryRepository        { return categories{s.db} }
+func (s *Store) Variants() server.VariantRepository           { return variants{s.db} }
+func (s *Store) ItemImages() server.ItemImageRepository       { return itemImages{s.db} }
+
+// translate maps gorm errors onto the sentinel errors handlers understand.
+func translate(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, gorm.ErrForeignKeyViolated):
+		return errors.Join(server.ErrNotFound, err)
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return errors.Join(server.ErrConflict, err)
+	}
+	return err
+}
+
+type users struct{ db *gorm.DB }
+
+func (r users) Create(ctx context.Context, user *server.User) error {
+	return translate(r.db.WithContext(ctx).Create(user).Error)
+}
+
+func (r users) Get(ctx context.Context, id uint) (*server.User, error) {
+	var user server.User
+	if err := r.db.WithContext(ctx).First(&user, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &user, nil
+}
+
+func (r users) GetByUsername(ctx context.Context, username string) (*server.User, error) {
+	var user server.User
+	if err := r.db.WithContext(ctx).Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &user, nil
+}
+
+func (r users) List(ctx context.Context) ([]server.User, error) {
+	list := []server.User{}
+	err := r.db.WithContext(ctx).Order("id").Find(&list).Error
+	return list, translate(err)
+}
+
+func (r users) SetPasswordHash(ctx context.Context, id uint, hash string) error {
+	return r.update(ctx, id, "password_hash", hash)
+}
+
+func (r users) SetRoles(ctx context.Context, id uint, roles server.Roles) error {
+	return r.update(ctx, id, "roles", roles)
+}
+
+func (r users) GrantRole(ctx context.Context, id uint, role string) (*server.User, bool, error) {
+	return r.changeRoles(ctx, id, func(roles server.Roles) server.Roles { return roles.With(role) })
+}
+
+func (r users) RevokeRole(ctx context.Context, id uint, role string) (*server.User, bool, error) {
+	return r.changeRoles(ctx, id, func(roles server.Roles) server.Roles { return roles.Without(role) })
+}
+
+// changeRoles applies change to the user's roles in a transaction that
+// writes the user's row before reading it, so that concurrent changes
+// apply one after the other. Writing first locks the row in Postgres and
+// takes SQLite's write lock up front; a read that later upgrades to a
+// write would fail with SQLITE_BUSY instead of waiting.
+func (r users) changeRoles(ctx context.Context, id uint, change func(server.Roles) server.Roles) (*server.User, bool, error) {
+	var user server.User
+	changed := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&server.User{}).Where("id = ?", id).UpdateColumn("roles", gorm.Expr("roles"))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return server.ErrNotFound
+		}
+		if err := tx.First(&user, id).Error; err != nil {
+			return err
+		}
+		roles := change(user.Roles)
+		if slices.Equal(roles, user.Roles) {
+			return nil
+		}
+		changed, user.Roles = true, roles
+		return tx.Model(&server.User{}).Where("id = ?", id).Update("roles", roles).Error
+	})
+	if err != nil {
+		return nil, false, translate(err)
+	}
+	return &user, changed, nil
+}
+
+func (r users) update(ctx context.Context, id uint, column string, value any) error {
+	res := r.db.WithContext(ctx).Model(&server.User{}).Where("id = ?", id).Update(column, value)
+	if res.Error != nil {
+		return translate(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return server.ErrNotFound
+	}
+	return nil
+}
+
+type sessions struct{ db *gorm.DB }
+
+func (r sessions) Create(ctx context.Context, session *server.Session) error {
+	session.IssuedAt = session.IssuedAt.UTC()
+	session.ExpiresAt = session.ExpiresAt.UTC()
+	session.LastSeenAt = session.LastSeenAt.UTC()
+	return translate(r.db.WithContext(ctx).Create(session).Error)
+}
+
+func (r sessions) GetByTokenHash(ctx context.Context, tokenHash string) (*server.Session, error) {
+	var session server.Session
+	if err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&session).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &session, nil
+}
+
+func (r sessions) Get(ctx context.Context, id uint) (*server.Session, error) {
+	var session server.Session
+	if err := r.db.WithContext(ctx).First(&session, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &session, nil
+}
+
+func (r sessions) MarkRotated(ctx context.Context, id uint, at time.Time) error {
+	res := r.db.WithContext(ctx).Model(&server.Session{}).
+		Where("id = ? AND rotated_at IS NULL", id).
+		Updates(map[string]any{"rotated_at": at.UTC(), "last_seen_at": at.UTC()})
+	if res.Error != nil {
+		return translate(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		if _, err := r.Get(ctx, id); err != nil {
+			return err
+		}
+		return server.ErrConflict
+	}
+	return nil
+}
+
+func (r sessions) DeleteFamily(ctx context.Context, familyID string) (int64, error) {
+	res := r.db.WithContext(ctx).Where("family_id = ?", familyID).Delete(&server.Session{})
+	return res.RowsAffected, translate(res.Error)
+}
+
+func (r sessions) DeleteByUser(ctx context.Context, userID uint) (int64, error) {
+	res := r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&server.Session{})
+	return res.RowsAffected, translate(res.Error)
+}
+
+func (r sessions) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).Where("expires_at < ?", now.UTC()).Delete(&server.Session{})
+	return res.RowsAffected, translate(res.Error)
+}
+
+type idempotency struct{ db *gorm.DB }
+
+func (r idempotency) Reserve(ctx context.Context, record *server.IdempotencyRecord) error {
+	record.CreatedAt = record.CreatedAt.UTC()
+	record.ExpiresAt = record.ExpiresAt.UTC()
+	return translate(r.db.WithContext(ctx).Create(record).Error)
+}
+
+func (r idempotency) Get(ctx context.Context, userID uint, key string) (*server.IdempotencyRecord, error) {
+	var record server.IdempotencyRecord
+	err := r.db.WithContext(ctx).Where("user_id = ? AND idempotency_key = ?", userID, key).First(&record).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &record, nil
+}
+
+func (r idempotency) Complete(ctx context.Context, id uint, statusCode int, body string) error {
+	res := r.db.WithContext(ctx).Model(&server.IdempotencyRecord{}).Where("id = ?", id).
+		Updates(map[string]any{"status_code": statusCode, "response_body": body})
+	if res.Error != nil {
+		return translate(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return server.ErrNotFound
+	}
+	return nil
+}
+
+func (r idempotency) Delete(ctx context.Context, id uint) error {
+	res := r.db.WithContext(ctx).Delete(&server.IdempotencyRecord{}, id)
+	if res.Error != nil {
+		return translate(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return server.ErrNotFound
+	}
+	return nil
+}
+
+func (r idempotency) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).Where("expires_at < ?", now.UTC()).Delete(&server.IdempotencyRecord{})
+	return res.RowsAffected, translate(res.Error)
+}
+
+type items struct{ db *gorm.DB }
+
+func (r items) Create(ctx context.Context, item *server.Item) error {
+	item.Version = 1
+	return translate(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(item).Error; err != nil {
+			return err
+		}
+		return setItemCategories(tx, item.ID, item.Categories)
+	}))
+}
+
+// itemCategory is a row of the table assigning items to categories.
+type itemCategory struct {
+	ItemID     uint
+	CategoryID uint
+}
+
+func (itemCategory) TableName() string { return "item_categories" }
+
+// setItemCategories replaces the categories the item is in.
+func setItemCategories(tx *gorm.DB, itemID uint, categories []server.Category) error {
+	if err := tx.Where("item_id = ?", itemID).Delete(&itemCategory{}).Error; err != nil {
+		return err
+	}
+	if len(categories) == 0 {
+		return nil
+	}
+	rows := make([]itemCategory, len(categories))
+	for i, c := range categories {
+		rows[i] = itemCategory{ItemID: itemID, CategoryID: c.ID}
+	}
+	return tx.Create(&rows).Error
+}
+
+// preloadAssociations loads the categories of items in taxonomy order,
+// their variants by ID and their images by position.
+func preloadAssociations(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("Categories", func(db *gorm.DB) *gorm.DB { return db.Order("sort_order, name, id") }).
+		Preload("Variants", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Images", func(db *gorm.DB) *gorm.DB { return db.Order("position") })
+}
+
+func (r items) Get(ctx context.Context, id uint) (*server.Item, error) {
+	var item server.Item
+	if err := preloadAssociations(r.db.WithContext(ctx)).First(&item, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &item, nil
+}
+
+func (r items) List(ctx context.Context, opts server.ItemListOptions) ([]server.Item, error) {
+	q := preloadAssociations(r.db.WithContext(ctx)).Where("archived_at IS NULL")
+	if len(opts.CategoryIDs) > 0 {
+		q = q.Where("id IN (SELECT item_id FROM item_categories WHERE category_id IN ?)", opts.CategoryIDs)
+	}
+	price, priceArgs, err := listPrice(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MinPrice != nil {
+		q = q.Where(price+" >= ?", append(priceArgs, opts.MinPrice.Amount)...)
+	}
+	if opts.MaxPrice != nil {
+		q = q.Where(price+" <= ?", append(priceArgs, opts.MaxPrice.Amount)...)
+	}
+
+	column, columnArgs, dir, op := itemSortColumns[opts.SortBy], []any(nil), "ASC", ">"
+	switch {
+	case column == "":
+		column = "id"
+	case opts.SortBy == server.ItemSortPrice:
+		column, columnArgs = price, priceArgs
+	}
+	if opts.Desc {
+		dir, op = "DESC", "<"
+	}
+	if a := opts.After; a != nil {
+		var after any
+		switch opts.SortBy {
+		case server.ItemSortPrice:
+			after = a.Price.Amount
+		case server.ItemSortName:
+			after = a.Name
+		case server.ItemSortCreatedAt:
+			after = a.CreatedAt.UTC()
+		}
+		if after == nil {
+			q = q.Where("id "+op+" ?", a.ID)
+		} else {
+			args := append(append(append(append([]any{}, columnArgs...), after), columnArgs...), after, a.ID)
+			q = q.Where("("+column+" "+op+" ? OR ("+column+" = ? AND id "+op+" ?))", args...)
+		}
+	}
+	order := column + " " + dir
+	if column != "id" {
+		order += ", id " + dir
+	}
+	q = q.Order(clause.OrderBy{Expression: clause.Expr{SQL: order, Vars: columnArgs, WithoutParentheses: true}})
+	if opts.Limit > 0 {
+		q = q.Limit(opts.Limit)
+	}
+
+	list := []server.Item{}
+	err = q.Find(&list).Error
+	return list, translate(err)
+}
+
+// listPrice returns the SQL for the price of an item that a listing with
+// opts goes by, and its arguments. In another currency that is the item's
+// own price in it or, failing that, price_amount times opts.Factor, n/d,
+// rounded half to even in integer arithmetic so that it matches
+// money.Money.Convert.
+func listPrice(opts server.ItemListOptions) (string, []any, error) {
+	if opts.Currency == "" {
+		return "price_amount", nil, nil
+	}
+	n, d := opts.Factor.Num(), opts.Factor.Denom()
+	if !n.IsInt64() || !d.IsInt64() {
+		return "", nil, fmt.Errorf("conversion factor %s is too precise to list by", opts.Factor.RatString())
+	}
+	const sql = `COALESCE((SELECT ip.price_amount FROM item_prices ip WHERE ip.item_id = items.id AND ip.price_currency = ?),
+	price_amount * ? / ? + CASE WHEN 2 * (price_amount * ? % ?) > ?
+		OR (2 * (price_amount * ? % ?) = ? AND price_amount * ? / ? % 2 = 1) THEN 1 ELSE 0 END)`
+	n64, d64 := n.Int64(), d.Int64()
+	return sql, []any{opts.Currency, n64, d64, n64, d64, d64, n64, d64, d64, n64, d64}, nil
+}
+
+func (r items) Update(ctx context.Context, item *server.Item) error {
+	now := time.Now().UTC()
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&server.Item{}).
+			Where("id = ? AND version = ?", item.ID, item.Version).
+			Updates(map[string]any{
+				"name":           item.Name,
+				"description":    item.Description,
+				"price_amount":   item.Price.Amount,
+				"price_currency": item.Price.Currency,
+				"options":        item.Options,
+				"archived_at":    utcPtr(item.ArchivedAt),
+				"version":        item.Version + 1,
+				"updated_at":     now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			if err := tx.Select("id").First(&server.Item{}, item.ID).Error; err != nil {
+				return err
+			}
+			return server.ErrConflict
+		}
+		return setItemCategories(tx, item.ID, item.Categories)
+	})
+	if err != nil {
+		return translate(err)
+	}
+	item.Version++
+	item.UpdatedAt = now
+	return nil
+}
+
+func (r items) SetStock(ctx context.Context, id uint, quantity int) error {
+	res := r.db.WithContext(ctx).Model(&server.Item{}).Where("id = ?", id).Update("stock_quantity", quantity)
+	if res.Error != nil {
+		return translate(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return server.ErrNotFound
+	}
+	return nil
+}
+
+func (r items) Available(ctx context.Context, id, variantID, excludeCartID uint, now time.Time) (int, error) {
+	return available(r.db.WithContext(ctx), id, variantID, excludeCartID, now)
+}
+
+func (r items) Prices(ctx context.Context, id uint) ([]server.ItemPrice, error) {
+	db := r.db.WithContext(ctx)
+	if err := db.Select("id").First(&server.Item{}, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	list := []server.ItemPrice{}
+	err := db.Where("item_id = ?", id).Order("price_currency").Find(&list).Error
+	return list, translate(err)
+}
+
+func (r items) SetPrice(ctx context.Context, id uint, price money.Money) error {
+	err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "item_id"}, {Name: "price_currency"}},
+			DoUpdates: clause.AssignmentColumns([]string{"price_amount"}),
+		}).
+		Create(&server.ItemPrice{ItemID: id, Price: price}).Error
+	return translate(err)
+}
+
+func (r items) DeletePrice(ctx context.Context, id uint, currency string) error {
+	res := r.db.WithContext(ctx).Where("item_id = ? AND price_currency = ?", id, currency).Delete(&server.ItemPrice{})
+	if res.Error != nil {
+		return translate(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return server.ErrNotFound
+	}
+	return nil
+}
+
+func (r items) PricesIn(ctx context.Context, currency string, ids []uint) (map[uint]money.Money, error) {
+	prices := make(map[uint]money.Money)
+	if len(ids) == 0 {
+		return prices, nil
+	}
+	var list []server.ItemPrice
+	err := r.db.WithContext(ctx).Where("price_currency = ? AND item_id IN ?", currency, ids).Find(&list).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	for _, p := range list {
+		prices[p.ItemID] = p.Price
+	}
+	return prices, nil
+}
+
+// itemSortColumns maps the server.ItemSort constants to columns.
+var itemSortColumns = map[string]string{
+	server.ItemSortID:        "id",
+	server.ItemSortPrice:     "price_amount",
+	server.ItemSortName:      "name",
+	server.ItemSortCreatedAt: "created_at",
+}
+
+// reservedByOthers sums the units of the item and variant given by the first
+// two arguments held by unexpired reservations of carts other than the
+// third, as of the fourth.
+const reservedByOthers = `(SELECT COALESCE(SUM(ci.quantity), 0) FROM cart_items ci
+	WHERE ci.item_id = ? AND ci.variant_id = ? AND ci.cart_id <> ? AND ci.reserved_until > ?)`
+
+// stockOf selects the row holding the stock of the variant, or of the item
+// if variantID is zero.
+func stockOf(db *gorm.DB, itemID, variantID uint) *gorm.DB {
+	if variantID != 0 {
+		return db.Model(&server.Variant{}).Where("id = ? AND item_id = ?", variantID, itemID)
+	}
+	return db.Model(&server.Item{}).Where("id = ?", itemID)
+}
+
+func available(db *gorm.DB, itemID, variantID, excludeCartID uint, now time.Time) (int, error) {
+	var n int
+	res := stockOf(db, itemID, variantID).
+		Select("stock_quantity - "+reservedByOthers, itemID, variantID, excludeCartID, now.UTC()).
+		Scan(&n)
+	if res.Error != nil {
+		return 0, translate(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return 0, server.ErrNotFound
+	}
+	return max(n, 0), nil
+}
+
+// checkStock returns an *server.InsufficientStockError unless stock less
+// what other carts have reserved covers line, which tx has just written; the
+// caller must then roll back. It locks the stock row first, so that
+// concurrent changes to lines of the same item or variant queue up and each
+// sees the lines written before it.
+func checkStock(tx *gorm.DB, line *server.CartItem) error {
+	var ids []uint
+	err := stockOf(tx, line.ItemID, line.VariantID).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+	n, err := available(tx, line.ItemID, line.VariantID, line.CartID, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if n < line.Quantity {
+		return &server.InsufficientStockError{Shortages: []server.StockShortage{{
+			ItemID:    line.ItemID,
+			VariantID: line.VariantID,
+			Requested: line.Quantity,
+			Available: n,
+		}}}
+	}
+	return nil
+}
+
+type categories struct{ db *gorm.DB }
+
+func (r categories) Create(ctx context.Context, category *server.Category) error {
+	return translate(r.db.WithContext(ctx).Create(category).Error)
+}
+
+func (r categories) Get(ctx context.Context, id uint) (*server.Category, error) {
+	var category server.Category
+	if err := r.db.WithContext(ctx).First(&category, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &category, nil
+}
+
+func (r categories) GetBySlug(ctx context.Context, slug string) (*server.Category, error) {
+	var category server.Category
+	if err := r.db.WithContext(ctx).Where("slug = ?", slug).First(&category).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &category, nil
+}
+
+func (r categories) List(ctx context.Context) ([]server.Category, error) {
+	list := []server.Category{}
+	err := r.db.WithContext(ctx).Order("sort_order, name, id").Find(&list).Error
+	return list, translate(err)
+}
+
+func (r categories) Update(ctx context.Context, category *server.Category) error {
+	now := time.Now().UTC()
+	return translate(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if category.ParentID != nil {
+			// Lock every category, in a fixed order so that concurrent
+			// moves queue up instead of deadlocking, and look for the
+			// category among the new parent's ancestors. Moves therefore
+			// see each other and cannot together form a cycle.
+			var all []server.Category
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "parent_id").Order("id").Find(&all).Error
+			if err != nil {
+				return err
+			}
+			parents := make(map[uint]*uint, len(all))
+			for _, c := range all {
+				parents[c.ID] = c.ParentID
+			}
+			for parent := category.ParentID; parent != nil; parent = parents[*parent] {
+				if *parent == category.ID {
+					return server.ErrCategoryCycle
+				}
+			}
+		}
+		res := tx.Model(&server.Category{}).Where("id = ?", category.ID).Updates(map[string]any{
+			"parent_id":  category.ParentID,
+			"slug":       category.Slug,
+			"name":       category.Name,
+			"sort_order": category.SortOrder,
+			"updated_at": now,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return server.ErrNotFound
+		}
+		category.UpdatedAt = now
+		return nil
+	}))
+}
+
+func (r categories) Delete(ctx context.Context, id uint) error {
+	return translate(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var children int64
+		if err := tx.Model(&server.Category{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return err
+		}
+		if children > 0 {
+			return server.ErrConflict
+		}
+		if err := tx.Where("category_id = ?", id).Delete(&itemCategory{}).Error; err != nil {
+			return err
+		}
+		res := tx.Delete(&server.Category{}, id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return server.ErrNotFound
+		}
+		return nil
+	}))
+}
+
+type variants struct{ db *gorm.DB }
+
+func (r variants) Create(ctx context.Context, variant *server.Variant) error {
+	return translate(r.db.WithContext(ctx).Create(variant).Error)
+}
+
+func (r variants) Get(ctx context.Context, id uint) (*server.Variant, error) {
+	var variant server.Variant
+	if err := r.db.WithContext(ctx).First(&variant, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &variant, nil
+}
+
+func (r variants) Update(ctx context.Context, variant *server.Variant) error {
+	now := time.Now().UTC()
+	values := map[string]any{
+		"sku":            variant.SKU,
+		"options":        variant.Options,
+		"price_amount":   nil,
+		"price_currency": nil,
+		"stock_quantity": variant.StockQuantity,
+		"barcode":        variant.Barcode,
+		"updated_at":     now,
+	}
+	if variant.Price != nil {
+		values["price_amount"] = variant.Price.Amount
+		values["price_currency"] = variant.Price.Currency
+	}
+	res := r.db.WithContext(ctx).Model(&server.Variant{}).Where("id = ?", variant.ID).Updates(values)
+	if res.Error != nil {
+		return translate(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return server.ErrNotFound
+	}
+	variant.UpdatedAt = now
+	return nil
+}
+
+func (r variants) Delete(ctx context.Context, id uint) error {
+	return translate(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("variant_id = ?", id).Delete(&server.CartItem{}).Error; err != nil {
+			return err
+		}
+		res := tx.Delete(&server.Variant{}, id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return server.ErrNotFound
+		}
+		return nil
+	}))
+}
+
+type itemImages struct{ db *gorm.DB }
+
+func (r itemImages) Create(ctx context.Context, image *server.ItemImage) error {
+	return translate(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&server.ItemImage{}).Where("item_id = ?", image.ItemID).Count(&count).Error; err != nil {
+			return err
+		}
+		image.Primary = image.Primary || count == 0
+		if image.Primary {
+			if err := tx.Model(&server.ItemImage{}).Where("item_id = ?", image.ItemID).Update("is_primary", false).Error; err != nil {
+				return err
+			}
+		}
+		image.Position = int(count)
+		return tx.Create(image).Error
+	}))
+}
+
+func (r itemImages) Arrange(ctx context.Context, itemID uint, ids []uint, primaryID uint) error {
+	return translate(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current []uint
+		if err := tx.Model(&server.ItemImage{}).Where("item_id = ?", itemID).Pluck("id", &current).Error; err != nil {
+			return err
+		}
+		if len(current) != len(ids) {
+			return server.ErrConflict
+		}
+		for _, id := range current {
+			if !slices.Contains(ids, id) {
+				return server.ErrConflict
+			}
+		}
+		// Clear the old primary image first: at most one may be set at a
+		// time.
+		if err := tx.Model(&server.ItemImage{}).Where("item_id = ?", itemID).Update("is_primary", false).Error; err != nil {
+			return err
+		}
+		for position, id := range ids {
+			err := tx.Model(&server.ItemImage{}).Where("id = ?", id).Updates(map[string]any{
+				"position":   position,
+				"is_primary": id == primaryID,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func (r itemImages) Delete(ctx context.Context, id uint) error {
+	return translate(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var image server.ItemImage
+		if err := tx.First(&image, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&image).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&server.ItemImage{}).
+			Where("item_id = ? AND position > ?", image.ItemID, image.Position).
+			Update("position", gorm.Expr("position - 1")).Error
+		if err != nil || !image.Primary {
+			return err
+		}
+		return tx.Model(&server.ItemImage{}).
+			Where("item_id = ? AND position = 0", image.ItemID).
+			Update("is_primary", true).Error
+	}))
+}
+
+type exchangeRates struct{ db *gorm.DB }
+
+func (r exchangeRates) Create(ctx context.Context, rate *server.ExchangeRate) error {
+	rate.EffectiveFrom = rate.EffectiveFrom.UTC()
+	return translate(r.db.WithContext(ctx).Create(rate).Error)
+}
+
+func (r exchangeRates) List(ctx context.Context, currency string) ([]server.ExchangeRate, error) {
+	list := []server.ExchangeRate{}
+	q := r.db.WithContext(ctx).Order("currency").Order("effective_from")
+	if currency != "" {
+		q = q.Where("currency = ?", currency)
+	}
+	err := q.Find(&list).Error
+	return list, translate(err)
+}
+
+func (r exchangeRates) Current(ctx context.Context, currency string, at time.Time) (*server.ExchangeRate, error) {
+	var rate server.ExchangeRate
+	err := r.db.WithContext(ctx).
+		Where("currency = ? AND effective_from <= ?", currency, at.UTC()).
+		Order("effective_from DESC").
+		First(&rate).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &rate, nil
+}
+
+func (r exchangeRates) Delete(ctx context.Context, id uint) error {
+	res := r.db.WithContext(ctx).Delete(&server.ExchangeRate{}, id)
+	if res.Error != nil {
+		return translate(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return server.ErrNotFound
+	}
+	return nil
+}
+
+type carts struct{ db *gorm.DB }
+
+func (r carts) GetByUser(ctx context.Context, userID uint) (*server.Cart, error) {
+	var cart server.Cart
+	err := r.db.WithContext(ctx).
+		Preload("CartItems", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("CartItems.Item.Variants", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("CartItems.Item.Images", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Preload("CartItems.Variant").
+		Where("user_id = ?", userID).
+		First(&cart).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &cart, nil
+}
+
+func (r carts) GetOrCreateForUser(ctx context.Context, userID uint) (*server.Cart, error) {
+	// Two concurrent requests may both miss the cart; the unique index on
+	// user_id makes the loser's insert a no-op and both read the same row.
+	cart := server.Cart{UserID: userID}
+	err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "user_id"}}, DoNothing: true}).
+		Omit(clause.Associations).
+		Create(&cart).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	return r.GetByUser(ctx, userID)
+}
+
+func (r carts) AddItem(ctx context.Context, cartItem *server.CartItem) error {
+	cartItem.ReservedUntil = utcPtr(cartItem.ReservedUntil)
+	return translate(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Omit(clause.Associations).
+			Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "cart_id"}, {Name: "item_id"}, {Name: "variant_id"}},
+				DoUpdates: clause.Assignments(map[string]any{
+					"quantity":       gorm.Expr("cart_items.quantity + excluded.quantity"),
+					"reserved_until": gorm.Expr("excluded.reserved_until"),
+				}),
+			}).
+			Create(cartItem).Error
+		if err != nil {
+			return err
+		}
+		// The insert may have merged into an existing line, so read back
+		// the line rather than trusting the returned ID.
+		err = tx.Where("cart_id = ? AND item_id = ? AND variant_id = ?", cartItem.CartID, cartItem.ItemID, cartItem.VariantID).
+			First(cartItem).Error
+		if err != nil {
+			return err
+		}
+		if cartItem.Quantity > server.MaxCartQuantity {
+			return server.ErrQuantityTooLarge
+		}
+		return checkStock(tx, cartItem)
+	}))
+}
+
+func (r carts) SetItemQuantity(ctx context.Context, cartID, itemID, variantID uint, quantity int, reservedUntil *time.Time) (*server.CartItem, error) {
+	line := server.CartItem{
+		CartID:        cartID,
+		ItemID:        itemID,
+		VariantID:     variantID,
+		Quantity:      quantity,
+		ReservedUntil: utcPtr(reservedUntil),
+	}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Omit(clause.Associations).
+			Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "cart_id"}, {Name: "item_id"}, {Name: "variant_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"quantity", "reserved_until"}),
+			}).
+			Create(&line).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("cart_id = ? AND item_id = ? AND variant_id = ?", cartID, itemID, variantID).First(&line).Error
+		if err != nil {
+			return err
+		}
+		return checkStock(tx, &line)
+	})
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &line, nil
+}
+
+func (r carts) RemoveItem(ctx context.Context, cartID, itemID, variantID uint) error {
+	res := r.db.WithContext(ctx).
+		Where("cart_id = ? AND item_id = ? AND variant_id = ?", cartID, itemID, variantID).
+		Delete(&server.CartItem{})
+	if res.Error != nil {
+		return translate(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return server.ErrNotFound
+	}
+	return nil
+}
+
+func (r carts) Clear(ctx context.Context, cartID uint) error {
+	return translate(r.db.WithContext(ctx).Where("cart_id = ?", cartID).Delete(&server.CartItem{}).Error)
+}
+
+type orders struct{ db *gorm.DB }
+
+func (r orders) Create(ctx context.Context, order *server.Order, cart *server.Cart) error {
+	return translate(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, ci := range cart.CartItems {
+			res := tx.Where("id = ? AND quantity = ?", ci.ID, ci.Quantity).Delete(&server.CartItem{})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return server.ErrConflict
+			}
+		}
+		if err := takeStock(tx, order.OrderItems, cart.ID); err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Create(order).Error; err != nil {
+			return err
+		}
+		for i := range order.OrderItems {
+			order.OrderItems[i].OrderID = order.ID
+		}
+		if err := tx.Omit(clause.Associations).Create(&order.OrderItems).Error; err != nil {
+			return err
+		}
+		return tx.Create(&server.OrderStatusChange{
+			OrderID:  order.ID,
+			ToStatus: order.Status,
+			ActorID:  order.UserID,
+		}).Error
+	}))
+}
+
+func (r orders) Get(ctx context.Context, id uint) (*server.Order, error) {
+	var order server.Order
+	err := r.db.WithContext(ctx).
+		Preload("OrderItems", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		First(&order, id).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &order, nil
+}
+
+func (r orders) ListByUser(ctx context.Context, userID uint, opts server.OrderListOptions) ([]server.Order, error) {
+	list := []server.Order{}
+	q := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("id")
+	if opts.WithItems {
+		q = q.Preload("OrderItems", func(db *gorm.DB) *gorm.DB { return db.Order("id") })
+	}
+	err := q.Find(&list).Error
+	return list, translate(err)
+}
+
+func (r orders) ChangeStatus(ctx context.Context, change *server.OrderStatusChange) error {
+	return translate(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&server.Order{}).
+			Where("id = ? AND status = ?", change.OrderID, change.FromStatus).
+			Update("status", change.ToStatus)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			if err := tx.Select("id").First(&server.Order{}, change.OrderID).Error; err != nil {
+				return err
+			}
+			return server.ErrConflict
+		}
+		if server.ReturnsStock(change.FromStatus, change.ToStatus) {
+			var lines []server.OrderItem
+			if err := tx.Where("order_id = ?", change.OrderID).Find(&lines).Error; err != nil {
+				return err
+			}
+			for _, oi := range lines {
+				err := stockOf(tx, oi.ItemID, oi.VariantID).
+					Update("stock_quantity", gorm.Expr("stock_quantity + ?", oi.Quantity)).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Create(change).Error
+	}))
+}
+
+// takeStock decrements the stock of every line's item or variant, leaving
+// alone units reserved by carts other than cartID. If any line cannot be
+// covered it returns an *server.InsufficientStockError listing all of them;
+// the caller must roll back.
+func takeStock(tx *gorm.DB, lines []server.OrderItem, cartID uint) error {
+	now := time.Now().UTC()
+	var shortages []server.StockShortage
+	for _, oi := range lines {
+		res := stockOf(tx, oi.ItemID, oi.VariantID).
+			Where("stock_quantity - "+reservedByOthers+" >= ?", oi.ItemID, oi.VariantID, cartID, now, oi.Quantity).
+			Update("stock_quantity", gorm.Expr("stock_quantity - ?", oi.Quantity))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			n, err := available(tx, oi.ItemID, oi.VariantID, cartID, now)
+			if err != nil && !errors.Is(err, server.ErrNotFound) {
+				return err
+			}
+			shortages = append(shortages, server.StockShortage{
+				ItemID:    oi.ItemID,
+				VariantID: oi.VariantID,
+				Requested: oi.Quantity,
+				Available: n,
+			})
+		}
+	}
+	if len(shortages) > 0 {
+		return &server.InsufficientStockError{Shortages: shortages}
+	}
+	return nil
+}
+
+func utcPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+func (r orders) History(ctx context.Context, orderID uint) ([]server.OrderStatusChange, error) {
+	list := []server.OrderStatusChange{}
+	err := r.db.WithContext(ctx).Where("order_id = ?", orderID).Order("id").Find(&list).Error
+	return list, translate(err)
+}
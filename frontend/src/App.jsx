@@ -1,4 +1,5 @@
-import React, { useState } from 'react';
+import React, { useEffect, useState } from 'react';
+import axios from 'axios';
 import LoginScreen from './components/LoginScreen';
 import RegisterScreen from './components/RegisterScreen';
 import ItemsListScreen from './components/ItemsListScreen';
@@ -8,6 +9,33 @@ function App() {
   const [username, setUsername] = useState(localStorage.getItem('username') || '');
   const [showLogin, setShowLogin] = useState(true);
 
+  // Access tokens are short-lived: when one expires, trade the refresh token
+  // for a new pair and retry the request once.
+  useEffect(() => {
+    const id = axios.interceptors.response.use(undefined, async (err) => {
+      const original = err.config;
+      const refreshToken = localStorage.getItem('refreshToken');
+      if (err.response?.data?.code !== 'token_expired' || !refreshToken || original._retried) {
+        throw err;
+      }
+      original._retried = true;
+      try {
+        const res = await axios.post('/api/users/token/refresh', { refreshToken });
+        localStorage.setItem('userToken', res.data.token);
+        localStorage.setItem('refreshToken', res.data.refreshToken);
+        setUserToken(res.data.token);
+        original.headers.Authorization = `Bearer ${res.data.token}`;
+        return axios(original);
+      } catch (refreshErr) {
+        localStorage.removeItem('userToken');
+        localStorage.removeItem('refreshToken');
+        setUserToken('');
+        throw err;
+      }
+    });
+    return () => axios.interceptors.response.eject(id);
+  }, []);
+
   // Routing: show login/register if not logged in, else show items
   return (
     <div>
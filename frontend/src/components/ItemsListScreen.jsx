@@ -5,6 +5,8 @@ function ItemsListScreen({ userToken, username, setUserToken }) {
   const [items, setItems] = useState([]);
   const [loading, setLoading] = useState(true);
   const [checkoutLoading, setCheckoutLoading] = useState(false);
+  // The variant picked for each item that has variants, by item id.
+  const [chosenVariants, setChosenVariants] = useState({});
 
   useEffect(() => {
     fetchItems();
@@ -13,8 +15,15 @@ function ItemsListScreen({ userToken, username, setUserToken }) {
   const fetchItems = async () => {
     setLoading(true);
     try {
-      const res = await axios.get('/api/items');
-      setItems(res.data);
+      // The catalog is paginated; follow next_cursor to show all of it.
+      let all = [];
+      let cursor = '';
+      do {
+        const res = await axios.get('/api/items', { params: { limit: 100, cursor: cursor || undefined } });
+        all = all.concat(res.data.items);
+        cursor = res.data.next_cursor;
+      } while (cursor);
+      setItems(all);
     } catch (err) {
       window.alert('Failed to fetch items');
     } finally {
@@ -22,16 +31,21 @@ function ItemsListScreen({ userToken, username, setUserToken }) {
     }
   };
 
-  const addItemToCart = async (itemId) => {
+  const addItemToCart = async (item) => {
+    const variantId = item.variants.length > 0 ? (chosenVariants[item.id] || item.variants[0].id) : undefined;
     try {
       await axios.post(
         '/api/carts',
-        { itemId },
+        { itemId: item.id, variantId },
         { headers: { Authorization: `Bearer ${userToken}` } }
       );
       window.alert('Item added to cart');
     } catch (err) {
-      window.alert('Failed to add item to cart');
+      if (err.response && err.response.status === 409) {
+        window.alert('Sorry, there is not enough of this item in stock');
+      } else {
+        window.alert('Failed to add item to cart');
+      }
     }
   };
 
@@ -41,8 +55,12 @@ function ItemsListScreen({ userToken, username, setUserToken }) {
         headers: { Authorization: `Bearer ${userToken}` },
       });
       if (res.data.items && res.data.items.length > 0) {
-        const msg = res.data.items.map((ci) => `cart_id: ${res.data.cartId}, item_id: ${ci.itemId}`).join('\n');
-        window.alert(msg);
+        const lines = res.data.items.map((ci) => {
+          const options = ci.options ? ` (${Object.values(ci.options).join(', ')})` : '';
+          return `${ci.name}${options} x ${ci.quantity}: ${ci.lineTotal} ${res.data.currency}`;
+        });
+        lines.push(`Subtotal (${res.data.itemCount} items): ${res.data.subtotal} ${res.data.currency}`);
+        window.alert(lines.join('\n'));
       } else {
         window.alert('Cart is empty');
       }
@@ -57,7 +75,7 @@ function ItemsListScreen({ userToken, username, setUserToken }) {
         headers: { Authorization: `Bearer ${userToken}` },
       });
       if (res.data.length > 0) {
-        const msg = res.data.map((o) => `Order id: ${o.id}`).join('\n');
+        const msg = res.data.map((o) => `Order id: ${o.id}, ${o.status}, total: ${o.total} ${o.currency}`).join('\n');
         window.alert(msg);
       } else {
         window.alert('No orders found');
@@ -79,22 +97,37 @@ function ItemsListScreen({ userToken, username, setUserToken }) {
         setCheckoutLoading(false);
         return;
       }
+      // The key makes a double-clicked or retried checkout place one order.
       await axios.post(
         '/api/orders',
         { cartId: res.data.cartId },
-        { headers: { Authorization: `Bearer ${userToken}` } }
+        { headers: { Authorization: `Bearer ${userToken}`, 'Idempotency-Key': crypto.randomUUID() } }
       );
       window.alert('Order successful');
       fetchItems(); // reload items (if needed)
     } catch (err) {
-      window.alert('Failed to checkout');
+      const lines = err.response && err.response.data && err.response.data.lines;
+      if (lines) {
+        window.alert('Not enough stock:\n' + lines.map((l) => `item ${l.itemId}: ${l.available} of ${l.requested} available`).join('\n'));
+      } else {
+        window.alert('Failed to checkout');
+      }
     } finally {
       setCheckoutLoading(false);
     }
   };
 
-  const handleLogout = () => {
+  const handleLogout = async () => {
+    try {
+      // Revoke the session server-side; logging out locally must not depend on it.
+      await axios.post('/api/users/logout', null, {
+        headers: { Authorization: `Bearer ${userToken}` },
+      });
+    } catch (err) {
+      // The token may already be expired or revoked.
+    }
     localStorage.removeItem('userToken');
+    localStorage.removeItem('refreshToken');
     localStorage.removeItem('username');
     setUserToken('');
   };
@@ -314,18 +347,32 @@ function ItemsListScreen({ userToken, username, setUserToken }) {
                   e.currentTarget.style.boxShadow = '0 10px 30px rgba(0,0,0,0.1)';
                 }}
               >
-                <div style={{
-                  width: '60px',
-                  height: '60px',
-                  background: 'linear-gradient(135deg, #667eea 0%, #764ba2 100%)',
-                  borderRadius: '50%',
-                  display: 'flex',
-                  alignItems: 'center',
-                  justifyContent: 'center',
-                  fontSize: '24px',
-                  color: 'white',
-                  marginBottom: '20px'
-                }}>📦</div>
+                {item.images.some((img) => img.primary) ? (
+                  <img
+                    src={item.images.find((img) => img.primary).thumbnails.medium}
+                    alt={item.name}
+                    style={{
+                      width: '100%',
+                      height: '180px',
+                      objectFit: 'cover',
+                      borderRadius: '10px',
+                      marginBottom: '20px'
+                    }}
+                  />
+                ) : (
+                  <div style={{
+                    width: '60px',
+                    height: '60px',
+                    background: 'linear-gradient(135deg, #667eea 0%, #764ba2 100%)',
+                    borderRadius: '50%',
+                    display: 'flex',
+                    alignItems: 'center',
+                    justifyContent: 'center',
+                    fontSize: '24px',
+                    color: 'white',
+                    marginBottom: '20px'
+                  }}>📦</div>
+                )}
                 <h3 style={{
                   color: '#333',
                   fontSize: '20px',
@@ -340,6 +387,26 @@ function ItemsListScreen({ userToken, username, setUserToken }) {
                   marginBottom: '20px',
                   margin: '0 0 20px 0'
                 }}>{item.description || 'No description available'}</p>
+                {item.variants.length > 0 && (
+                  <select
+                    value={chosenVariants[item.id] || item.variants[0].id}
+                    onChange={(e) => setChosenVariants({ ...chosenVariants, [item.id]: Number(e.target.value) })}
+                    style={{
+                      width: '100%',
+                      padding: '8px',
+                      borderRadius: '8px',
+                      border: '1px solid #ddd',
+                      marginBottom: '20px'
+                    }}
+                  >
+                    {item.variants.map((v) => (
+                      <option key={v.id} value={v.id}>
+                        {item.options.map((o) => v.options[o.name]).join(' / ')}
+                        {v.price ? ` - ${v.price} ${item.currency}` : ''}
+                      </option>
+                    ))}
+                  </select>
+                )}
                 <div style={{
                   display: 'flex',
                   justifyContent: 'space-between',
@@ -349,9 +416,9 @@ function ItemsListScreen({ userToken, username, setUserToken }) {
                     fontSize: '24px',
                     fontWeight: '700',
                     color: '#11998e'
-                  }}>₹{item.price}</div>
+                  }}>{item.price} {item.currency}</div>
                   <button
-                    onClick={() => addItemToCart(item.id)}
+                    onClick={() => addItemToCart(item)}
                     style={{
                       background: 'linear-gradient(135deg, #667eea 0%, #764ba2 100%)',
                       color: 'white',
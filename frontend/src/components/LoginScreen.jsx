@@ -17,6 +17,7 @@ function LoginScreen({ setUserToken, setUsername, setShowLogin }) {
       setUserToken(res.data.token);
       setUsername(usernameInput);
       localStorage.setItem('userToken', res.data.token);
+      localStorage.setItem('refreshToken', res.data.refreshToken);
       localStorage.setItem('username', usernameInput);
     } catch (err) {
       window.alert('Invalid username/password');